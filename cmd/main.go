@@ -1,17 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/ab-dauletkhan/hot-coffee/internal/core"
 	"github.com/ab-dauletkhan/hot-coffee/internal/handler"
+	"github.com/ab-dauletkhan/hot-coffee/internal/notifier"
 	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
 	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 func Start() {
@@ -23,25 +29,65 @@ func Start() {
 	log := core.SetupLogger(core.Env)
 	slog.SetDefault(log)
 
+	models.DefaultCurrency = core.Currency
+
 	log.Info("application started",
 		"version", "1.0.0",
 		"environment", core.Env,
 	)
 
 	// Initialize storage for each entity
-	inventoryStorage, err := repository.NewJSONStorage(filepath.Join(core.Dir, core.InventoryFile))
+	inventoryStorage, err := repository.NewStorage(core.Storage, core.Dir, core.InventoryFile)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	menuStorage, err := repository.NewStorage(core.Storage, core.Dir, core.MenuFile)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	orderStorage, err := repository.NewStorage(core.Storage, core.Dir, core.OrderFile)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	movementStorage, err := repository.NewLedgerStorage(core.Storage, core.Dir, core.MovementFile)
 	if err != nil {
 		log.Error(err.Error())
 		os.Exit(1)
 	}
-	menuStorage, err := repository.NewJSONStorage(filepath.Join(core.Dir, core.MenuFile))
+	supplierStorage, err := repository.NewStorage(core.Storage, core.Dir, core.SupplierFile)
 	if err != nil {
 		log.Error(err.Error())
 		os.Exit(1)
 	}
-	orderStorage, err := repository.NewJSONStorage(filepath.Join(core.Dir, core.OrderFile))
+	purchaseOrderStorage, err := repository.NewStorage(core.Storage, core.Dir, core.PurchaseFile)
 	if err != nil {
-		log.Debug(err.Error())
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	userStorage, err := repository.NewStorage(core.Storage, core.Dir, core.UserFile)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+	sequenceStorage, err := repository.NewStorage(core.Storage, core.Dir, core.SequenceFile)
+	if err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Recover any transaction interrupted by a crash before anything reads
+	// the storages. The in-memory backend has nothing to recover.
+	journalPath := filepath.Join(core.Dir, core.JournalFile)
+	if core.Storage == core.StorageMemory {
+		journalPath = ""
+	}
+	journal, err := repository.NewJournal(journalPath, log,
+		inventoryStorage, menuStorage, orderStorage, movementStorage, supplierStorage, purchaseOrderStorage, userStorage, sequenceStorage)
+	if err != nil {
+		log.Error(err.Error())
 		os.Exit(1)
 	}
 
@@ -49,23 +95,100 @@ func Start() {
 	inventoryRepo := repository.NewInventoryRepository(inventoryStorage, log)
 	menuRepo := repository.NewMenuRepository(menuStorage, log)
 	orderRepo := repository.NewOrderRepository(orderStorage, log)
+	movementRepo := repository.NewMovementRepository(movementStorage, log)
+	supplierRepo := repository.NewSupplierRepository(supplierStorage, log)
+	purchaseOrderRepo := repository.NewPurchaseOrderRepository(purchaseOrderStorage, log)
+	userRepo := repository.NewUserRepository(userStorage, log)
+	sequenceRepo := repository.NewSequenceRepository(sequenceStorage, log)
+
+	// Watch inventory levels in the background
+	var stockNotifier service.Notifier
+	switch core.Notifier {
+	case core.NotifierWebhook:
+		stockNotifier = notifier.NewWebhookNotifier(core.NotifyTo)
+	case core.NotifierFile:
+		stockNotifier, err = notifier.NewFileNotifier(core.NotifyTo)
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+	default:
+		stockNotifier = notifier.NewLogNotifier(log)
+	}
+	stockMonitor := service.NewStockMonitor(inventoryRepo, stockNotifier, core.StockCheckInterval, log)
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		stockMonitor.Run(monitorCtx)
+	}()
 
 	// Initialize services
-	inventoryService := service.NewInventoryService(inventoryRepo, log)
-	menuService := service.NewMenuService(menuRepo, inventoryService, log)
-	orderService := service.NewOrderService(orderRepo, menuService, inventoryService, log)
+	inventoryService := service.NewInventoryService(inventoryRepo, movementRepo, menuRepo, orderRepo, purchaseOrderRepo, stockMonitor, journal, log)
+	menuService := service.NewMenuService(menuRepo, inventoryService, journal, log)
+	orderService := service.NewOrderService(orderRepo, menuService, inventoryService, journal, core.TaxRate, log)
+	supplierService := service.NewSupplierService(supplierRepo, purchaseOrderRepo, journal, log)
+	purchaseOrderService := service.NewPurchaseOrderService(purchaseOrderRepo, sequenceRepo, supplierService, inventoryService, journal, log)
+	userService := service.NewUserService(userRepo, journal, log)
+
+	// Stock the ledger has never seen gets an opening balance, so that every
+	// item's movements add up to its quantity
+	if err := inventoryService.OpenLedger(context.Background()); err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
 
 	// Initialize handlers
 	inventoryHandler := handler.NewInventoryHandler(inventoryService, log)
 	menuHandler := handler.NewMenuHandler(menuService, log)
 	orderHandler := handler.NewOrderHandler(orderService, menuService, inventoryService, log)
+	supplierHandler := handler.NewSupplierHandler(supplierService, log)
+	purchaseOrderHandler := handler.NewPurchaseOrderHandler(purchaseOrderService, log)
+	userHandler := handler.NewUserHandler(userService, log)
+
+	// The server is ready while its storages are valid and, unless nothing
+	// is written to disk, the data directory takes new files
+	checks := []handler.ReadinessCheck{{Name: "storage", Check: journal.Validate}}
+	if core.Storage != core.StorageMemory {
+		checks = append(checks, handler.ReadinessCheck{
+			Name:  "data_dir",
+			Check: func() error { return repository.CheckWritable(core.Dir) },
+		})
+	}
+	healthHandler := handler.NewHealthHandler(checks, log)
 
 	// Initialize router
-	mux := handler.Routes(orderHandler, menuHandler, inventoryHandler)
+	mux := handler.Routes(orderHandler, menuHandler, inventoryHandler, supplierHandler, purchaseOrderHandler, userHandler, healthHandler)
+
+	var root http.Handler = mux
+	if core.Auth {
+		// A new installation gets an admin, with the key from the
+		// environment or one made up and shown once
+		key, err := userService.EnsureAdmin(context.Background(), core.AdminKey)
+		if err != nil {
+			log.Error(err.Error())
+			os.Exit(1)
+		}
+		if key != "" {
+			fmt.Fprintf(os.Stderr, "created user \"admin\" with API key %s\nstore it now, it will not be shown again\n", key)
+		}
+		root = handler.RequireAuth(mux, userService, log)
+	} else {
+		log.Warn("authentication is disabled, every request is served; start with --auth to require API keys")
+	}
+
+	// Every request gets an ID, an access log line, panic recovery and a deadline
+	root = handler.Middleware(root, mux, core.RequestTimeout, core.MaxBodyBytes, log)
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", core.Port),
-		Handler: mux,
+		Addr:              fmt.Sprintf(":%d", core.Port),
+		Handler:           root,
+		ReadHeaderTimeout: core.ReadTimeout,
+		ReadTimeout:       core.ReadTimeout,
+		WriteTimeout:      core.WriteTimeout,
+		IdleTimeout:       core.IdleTimeout,
+		MaxHeaderBytes:    core.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelError),
 	}
 
 	log.Info(
@@ -73,6 +196,51 @@ func Start() {
 		slog.String("Env", core.Env),
 		slog.String("addr", fmt.Sprintf("http://127.0.0.1:%d", core.Port)),
 		slog.String("dir", core.Dir),
+		slog.String("storage", core.Storage),
+		slog.Bool("auth", core.Auth),
+		slog.String("request_timeout", core.RequestTimeout.String()),
 	)
-	log.Debug(fmt.Sprint(srv.ListenAndServe()))
+
+	// Stop on SIGINT or SIGTERM; a second signal kills the process at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error(fmt.Sprintf("http server failed: %v", err))
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Info("shutting down", slog.String("grace_period", core.ShutdownTimeout.String()))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), core.ShutdownTimeout)
+
+	exitCode := 0
+
+	// Stop accepting connections and let the requests in flight finish
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error(fmt.Sprintf("requests still running after the grace period, closing connections: %v", err))
+		srv.Close()
+		exitCode = 1
+	}
+
+	stopMonitor()
+	<-monitorDone
+
+	// Wait for the last transaction, then flush and close every storage
+	if err := journal.Close(shutdownCtx); err != nil {
+		log.Error(fmt.Sprintf("failed to close storage: %v", err))
+		exitCode = 1
+	}
+	cancel()
+
+	log.Info("server stopped")
+	os.Exit(exitCode)
 }
@@ -1,5 +1,7 @@
 package core
 
+import "time"
+
 const (
 	DirPerm  = 0o755
 	FilePerm = 0o644
@@ -8,12 +10,39 @@ const (
 	MenuFile      = "menu_items.json"
 	InventoryFile = "inventory.json"
 	OrderFile     = "order.json"
+	MovementFile  = "inventory_movements.json"
+	SupplierFile  = "suppliers.json"
+	PurchaseFile  = "purchase_orders.json"
+	UserFile      = "users.json"
+	SequenceFile  = "sequences.json"
+
+	// Write-ahead journal for operations spanning several files
+	JournalFile = "journal.wal"
 
 	// Environments
 	EnvLocal = "local"
 	EnvDev   = "dev"
 	EnvProd  = "prod"
 
+	// Storage backends
+	StorageJSON   = "json"
+	StorageLog    = "log"
+	StorageMemory = "memory"
+
+	// Low-stock notifiers
+	NotifierLog     = "log"
+	NotifierWebhook = "webhook"
+	NotifierFile    = "file"
+
+	// Default file of the file notifier, in the data directory
+	AlertFile = "low_stock_alerts.log"
+
+	// Environment variable holding the key of the first admin
+	AdminKeyEnv = "HOT_COFFEE_ADMIN_KEY"
+
+	// How often inventory levels are checked besides after every change
+	StockCheckInterval = time.Minute
+
 	// Log file
 	LogFile = "logs.log"
 )
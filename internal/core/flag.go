@@ -5,23 +5,63 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"time"
 )
 
+var validCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
 var (
-	Port int
-	Dir  string
-	Help bool
-	Env  string
+	Port     int
+	Dir      string
+	Help     bool
+	Env      string
+	Storage  string
+	TaxRate  float64
+	Currency string
+	Notifier string
+	NotifyTo string
+	Auth     bool
+	AdminKey string // from the environment, never a flag that shows in ps
+
+	RequestTimeout  time.Duration
+	ShutdownTimeout time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxHeaderBytes  int
+	MaxBodyBytes    int64
 )
 
+// ParseFlags reads the command line into the flag variables and checks them
 func ParseFlags() error {
-	flag.IntVar(&Port, "port", 8080, "port to bind the server to")
-	flag.StringVar(&Dir, "dir", "./data", "directory to serve static files from")
-	flag.BoolVar(&Help, "help", false, "display help message")
-	flag.StringVar(&Env, "env", "local", "environment to run the server in, accepted values are: 'local', 'dev', 'prod'")
+	return parseFlags(flag.CommandLine, os.Args[1:])
+}
 
-	flag.Usage = printUsage
-	flag.Parse()
+// parseFlags registers the flags on fs and parses args with it
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.IntVar(&Port, "port", 8080, "port to bind the server to")
+	fs.StringVar(&Dir, "dir", "./data", "directory to serve static files from")
+	fs.BoolVar(&Help, "help", false, "display help message")
+	fs.StringVar(&Env, "env", "local", "environment to run the server in, accepted values are: 'local', 'dev', 'prod'")
+	fs.StringVar(&Storage, "storage", StorageJSON, "storage backend, accepted values are: 'json', 'log', 'memory'")
+	fs.Float64Var(&TaxRate, "tax-rate", 0, "sales tax in percent added to every order")
+	fs.StringVar(&Currency, "currency", "USD", "three letter code of the currency prices are in")
+	fs.StringVar(&Notifier, "notifier", NotifierLog, "where low stock alerts go, accepted values are: 'log', 'webhook', 'file'")
+	fs.StringVar(&NotifyTo, "notify-to", "", "webhook URL or file path for low stock alerts")
+	fs.BoolVar(&Auth, "auth", false, "require an API key on every request")
+	fs.DurationVar(&RequestTimeout, "request-timeout", 30*time.Second, "time a request may take before it is given up, 0 for no limit")
+	fs.DurationVar(&ShutdownTimeout, "shutdown-timeout", 15*time.Second, "time given to requests in flight to finish when the server stops")
+	fs.DurationVar(&ReadTimeout, "read-timeout", 15*time.Second, "time allowed to read a request, 0 for no limit")
+	fs.DurationVar(&WriteTimeout, "write-timeout", 60*time.Second, "time allowed to write a response, 0 for no limit")
+	fs.DurationVar(&IdleTimeout, "idle-timeout", 2*time.Minute, "time a keep-alive connection may stay idle, 0 for no limit")
+	fs.IntVar(&MaxHeaderBytes, "max-header-bytes", 1<<20, "largest size of request headers in bytes")
+	fs.Int64Var(&MaxBodyBytes, "max-body-bytes", 10<<20, "largest size of a request body in bytes")
+
+	fs.Usage = printUsage
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
 	if Help {
 		printUsage()
@@ -32,6 +72,55 @@ func ParseFlags() error {
 		return fmt.Errorf("invalid environment: %s, accepted values are: 'local', 'dev', 'prod'", Env)
 	}
 
+	if Storage != StorageJSON && Storage != StorageLog && Storage != StorageMemory {
+		return fmt.Errorf("invalid storage backend: %s, accepted values are: 'json', 'log', 'memory'", Storage)
+	}
+
+	if TaxRate < 0 || TaxRate > 100 {
+		return fmt.Errorf("invalid tax rate: %v, accepted range is 0 - 100", TaxRate)
+	}
+
+	if !validCurrency.MatchString(Currency) {
+		return fmt.Errorf("invalid currency: %s, expected a three letter code such as 'USD'", Currency)
+	}
+
+	switch Notifier {
+	case NotifierLog:
+	case NotifierWebhook:
+		if NotifyTo == "" {
+			return fmt.Errorf("--notify-to must be set to a URL for the webhook notifier")
+		}
+	case NotifierFile:
+		if NotifyTo == "" {
+			NotifyTo = filepath.Join(Dir, AlertFile)
+		}
+	default:
+		return fmt.Errorf("invalid notifier: %s, accepted values are: 'log', 'webhook', 'file'", Notifier)
+	}
+
+	for name, d := range map[string]time.Duration{
+		"request": RequestTimeout, "shutdown": ShutdownTimeout,
+		"read": ReadTimeout, "write": WriteTimeout, "idle": IdleTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("invalid %s timeout: %v, must not be negative", name, d)
+		}
+	}
+
+	// A response must be written before the connection is cut
+	if RequestTimeout > 0 && WriteTimeout > 0 && WriteTimeout <= RequestTimeout {
+		return fmt.Errorf("invalid write timeout: %v, must be longer than the request timeout (%v)", WriteTimeout, RequestTimeout)
+	}
+
+	if MaxHeaderBytes <= 0 || MaxBodyBytes <= 0 {
+		return fmt.Errorf("invalid size limit, --max-header-bytes and --max-body-bytes must be positive")
+	}
+
+	AdminKey = os.Getenv(AdminKeyEnv)
+	if Auth && Storage == StorageMemory && AdminKey == "" {
+		return fmt.Errorf("--auth with the memory backend needs the admin key in %s, as users do not survive a restart", AdminKeyEnv)
+	}
+
 	filepath.Clean(Dir)
 	if Port < 1024 || Port > 49151 {
 		return fmt.Errorf("invalid port number: %d, accepted range is 1024 - 49151", Port)
@@ -44,11 +133,38 @@ func printUsage() {
 Coffee Shop Management System
 
 Usage:
-  hot-coffee [--port <N>] [--dir <S>]
+  hot-coffee [--port <N>] [--dir <S>] [--storage <S>] [--tax-rate <F>] [--currency <S>]
+            [--notifier <S>] [--notify-to <S>] [--auth] [--request-timeout <D>]
+            [--shutdown-timeout <D>] [--read-timeout <D>] [--write-timeout <D>] [--idle-timeout <D>]
+            [--max-header-bytes <N>] [--max-body-bytes <N>]
   hot-coffee --help
 
 Options:
   --help       Show this screen.
   --port N     Port number.
-  --dir S      Path to the data directory.`)
+  --dir S      Path to the data directory.
+  --storage S  Storage backend: json (default), log or memory.
+  --tax-rate F Sales tax in percent added to every order (default 0).
+  --currency S Currency prices are in (default USD).
+  --notifier S Where low stock alerts go: log (default), webhook or file.
+  --notify-to S
+               Webhook URL, or alert file path (default <dir>/low_stock_alerts.log).
+  --auth       Require an API key on every request (default: off, every request
+               is served). On first start an admin is created; its key is read
+               from HOT_COFFEE_ADMIN_KEY, or made up and printed once.
+  --request-timeout D
+               Time a request may take, such as 10s (default 30s, 0 for no limit).
+  --shutdown-timeout D
+               Time requests in flight get to finish on SIGINT or SIGTERM (default 15s).
+  --read-timeout D
+               Time allowed to read a request (default 15s, 0 for no limit).
+  --write-timeout D
+               Time allowed to write a response, longer than the request timeout
+               (default 60s, 0 for no limit).
+  --idle-timeout D
+               Time a keep-alive connection may stay idle (default 2m, 0 for no limit).
+  --max-header-bytes N
+               Largest size of request headers (default 1048576).
+  --max-body-bytes N
+               Largest size of a request body (default 10485760).`)
 }
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		adminKey string
+		wantErr  string // part of the error, "" for none
+	}{
+		{name: "defaults", args: nil},
+		{name: "all valid", args: []string{"--port", "9090", "--env", "prod", "--storage", "log", "--tax-rate", "8.5", "--currency", "EUR"}},
+		{name: "unknown environment", args: []string{"--env", "staging"}, wantErr: "invalid environment"},
+		{name: "unknown storage", args: []string{"--storage", "sqlite"}, wantErr: "invalid storage backend"},
+		{name: "negative tax", args: []string{"--tax-rate", "-1"}, wantErr: "invalid tax rate"},
+		{name: "tax over 100", args: []string{"--tax-rate", "100.5"}, wantErr: "invalid tax rate"},
+		{name: "lower case currency", args: []string{"--currency", "usd"}, wantErr: "invalid currency"},
+		{name: "long currency", args: []string{"--currency", "USDT"}, wantErr: "invalid currency"},
+		{name: "unknown notifier", args: []string{"--notifier", "email"}, wantErr: "invalid notifier"},
+		{name: "webhook without URL", args: []string{"--notifier", "webhook"}, wantErr: "--notify-to"},
+		{name: "webhook", args: []string{"--notifier", "webhook", "--notify-to", "http://localhost/alerts"}},
+		{name: "negative timeout", args: []string{"--idle-timeout", "-1s"}, wantErr: "invalid idle timeout"},
+		{name: "write timeout as short as the request timeout", args: []string{"--request-timeout", "30s", "--write-timeout", "30s"}, wantErr: "invalid write timeout"},
+		{name: "no request timeout", args: []string{"--request-timeout", "0", "--write-timeout", "5s"}},
+		{name: "no write timeout", args: []string{"--write-timeout", "0"}},
+		{name: "zero body limit", args: []string{"--max-body-bytes", "0"}, wantErr: "invalid size limit"},
+		{name: "negative header limit", args: []string{"--max-header-bytes", "-1"}, wantErr: "invalid size limit"},
+		{name: "auth in memory without a key", args: []string{"--auth", "--storage", "memory"}, wantErr: AdminKeyEnv},
+		{name: "auth in memory with a key", args: []string{"--auth", "--storage", "memory"}, adminKey: "0123456789abcdefghij"},
+		{name: "auth on disk without a key", args: []string{"--auth"}},
+		{name: "privileged port", args: []string{"--port", "80"}, wantErr: "invalid port number"},
+		{name: "port past the registered range", args: []string{"--port", "49152"}, wantErr: "invalid port number"},
+		{name: "lowest port", args: []string{"--port", "1024"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(AdminKeyEnv, tt.adminKey)
+
+			err := parseFlags(flag.NewFlagSet("hot-coffee", flag.ContinueOnError), tt.args)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("parseFlags(%v) error = %v", tt.args, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("parseFlags(%v) error = %v, want one about %q", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFlagsAlertFile(t *testing.T) {
+	t.Setenv(AdminKeyEnv, "")
+
+	args := []string{"--dir", "/srv/coffee", "--notifier", "file"}
+	if err := parseFlags(flag.NewFlagSet("hot-coffee", flag.ContinueOnError), args); err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if want := filepath.Join("/srv/coffee", AlertFile); NotifyTo != want {
+		t.Errorf("NotifyTo = %q, want %q", NotifyTo, want)
+	}
+
+	args = append(args, "--notify-to", "/var/log/alerts.log")
+	if err := parseFlags(flag.NewFlagSet("hot-coffee", flag.ContinueOnError), args); err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
+	if NotifyTo != "/var/log/alerts.log" {
+		t.Errorf("NotifyTo = %q, want the path given", NotifyTo)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -40,6 +41,40 @@ func sourceRelativeToRoot(projectRoot string) func(groups []string, a slog.Attr)
 	}
 }
 
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx serves, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID found in the context of a log call to
+// the record, so every line logged while serving a request can be matched
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
 // SetupLogger configures and returns a logger based on the environment
 func SetupLogger(env string) *slog.Logger {
 	projectRoot := getProjectRoot()
@@ -101,5 +136,5 @@ func SetupLogger(env string) *slog.Logger {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(contextHandler{handler})
 }
@@ -0,0 +1,213 @@
+// Package export writes tables as CSV or as XLSX spreadsheets
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Content types of the export formats
+const (
+	ContentTypeCSV  = "text/csv; charset=utf-8"
+	ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// flushEvery is the number of CSV rows written between flushes to the client
+const flushEvery = 100
+
+// Column is a column of a sheet. Numeric columns are stored as numbers in
+// spreadsheets; CSV does not tell them apart.
+type Column struct {
+	Name    string
+	Numeric bool
+}
+
+// Sheet is a table with a fixed column order. Rows are produced as they are
+// written, so a large table is never held in memory as a whole.
+type Sheet struct {
+	Name    string
+	Columns []Column
+	Rows    iter.Seq[[]string]
+}
+
+// formulaPrefixes are the characters that make spreadsheet programs read a
+// cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// cellText returns the text of a cell in column i. Text that a spreadsheet
+// would run as a formula is quoted with a leading apostrophe; numbers in
+// numeric columns are left alone, so negative amounts stay numbers.
+func cellText(columns []Column, i int, value string) string {
+	if i < len(columns) && columns[i].Numeric {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+	}
+	if value != "" && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// WriteCSV writes the header and rows of sheet as CSV. Rows are flushed to
+// w as they are written when w supports it.
+func WriteCSV(w io.Writer, sheet Sheet) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(sheet.Columns))
+	for i, column := range sheet.Columns {
+		header[i] = column.Name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	flusher, _ := w.(http.Flusher)
+	n := 0
+	for row := range sheet.Rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = cellText(sheet.Columns, i, value)
+		}
+		if err := cw.Write(cells); err != nil {
+			return err
+		}
+		if n++; flusher != nil && n%flushEvery == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteXLSX writes sheet as a workbook with a single worksheet. Strings are
+// stored inline, so the workbook needs no shared string table.
+func WriteXLSX(w io.Writer, sheet Sheet) error {
+	zw := zip.NewWriter(w)
+
+	name := sheet.Name
+	if name == "" {
+		name = "Sheet1"
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(name))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeWorksheet(f, sheet); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeWorksheet(w io.Writer, sheet Sheet) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]string, len(sheet.Columns))
+	for i, column := range sheet.Columns {
+		header[i] = column.Name
+	}
+	writeRow(&b, 1, header, nil)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+
+	n := 2
+	for row := range sheet.Rows {
+		b.Reset()
+		writeRow(&b, n, row, sheet.Columns)
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+		n++
+	}
+
+	_, err := io.WriteString(w, `</sheetData></worksheet>`)
+	return err
+}
+
+// writeRow writes a row of cells. Values of numeric columns that parse as
+// numbers become number cells, everything else an inline string.
+func writeRow(b *strings.Builder, n int, values []string, columns []Column) {
+	fmt.Fprintf(b, `<row r="%d">`, n)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(n)
+		if i < len(columns) && columns[i].Numeric {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				fmt.Fprintf(b, `<c r="%s"><v>%s</v></c>`, ref, value)
+				continue
+			}
+		}
+		fmt.Fprintf(b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(cellText(columns, i, value)))
+	}
+	b.WriteString(`</row>`)
+}
+
+// columnName returns the spreadsheet name of the zero based column i: A, B,
+// ..., Z, AA, AB and so on
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const contentTypesXML = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookXML = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const workbookRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
@@ -0,0 +1,110 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testColumns = []Column{{Name: "name"}, {Name: "amount", Numeric: true}}
+
+func TestCellText(t *testing.T) {
+	tests := []struct {
+		name  string
+		i     int
+		value string
+		want  string
+	}{
+		{name: "plain text", i: 0, value: "Latte", want: "Latte"},
+		{name: "empty", i: 0, value: "", want: ""},
+		{name: "formula", i: 0, value: "=1+2", want: "'=1+2"},
+		{name: "plus", i: 0, value: "+1", want: "'+1"},
+		{name: "minus", i: 0, value: "-cmd", want: "'-cmd"},
+		{name: "at", i: 0, value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "tab", i: 0, value: "\t=1", want: "'\t=1"},
+		{name: "negative number", i: 1, value: "-3.5", want: "-3.5"},
+		{name: "formula in a numeric column", i: 1, value: "=1+2", want: "'=1+2"},
+		{name: "past the columns", i: 5, value: "-1", want: "'-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cellText(testColumns, tt.i, tt.value); got != tt.want {
+				t.Errorf("cellText(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	sheet := Sheet{
+		Columns: testColumns,
+		Rows:    slices.Values([][]string{{"Latte", "3.50"}, {"=HYPERLINK(\"x\")", "-1"}, {"a,b", ""}}),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, sheet); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+
+	want := "name,amount\nLatte,3.50\n\"'=HYPERLINK(\"\"x\"\")\",-1\n\"a,b\",\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	sheet := Sheet{
+		Name:    "menu & more",
+		Columns: testColumns,
+		Rows:    slices.Values([][]string{{"<Latte>", "3.50"}, {"=1+2", "n/a"}}),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, sheet); err != nil {
+		t.Fatalf("WriteXLSX() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("workbook is not a zip archive: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(data)
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="menu &amp; more"`) {
+		t.Errorf("workbook does not name the sheet: %s", parts["xl/workbook.xml"])
+	}
+
+	worksheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;Latte&gt;</t></is></c>`,
+		`<c r="B2"><v>3.50</v></c>`,
+		`<c r="A3" t="inlineStr"><is><t xml:space="preserve">&#39;=1+2</t></is></c>`,
+		`<c r="B3" t="inlineStr"><is><t xml:space="preserve">n/a</t></is></c>`,
+	} {
+		if !strings.Contains(worksheet, want) {
+			t.Errorf("worksheet lacks %s:\n%s", want, worksheet)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// permissions is the least privileged role allowed to use each route, by
+// route pattern and method. A pattern without a method entry applies to
+// every method. Routes missing from the table are for admins only.
+var permissions = map[string]map[string]string{
+	"/orders":              {http.MethodGet: models.RoleBarista, http.MethodPost: models.RoleBarista},
+	"/orders/{id}":         {http.MethodGet: models.RoleBarista, http.MethodPut: models.RoleBarista, http.MethodDelete: models.RoleManager},
+	"/orders/{id}/close":   {"": models.RoleBarista},
+	"/orders/{id}/start":   {"": models.RoleBarista},
+	"/orders/{id}/ready":   {"": models.RoleBarista},
+	"/orders/{id}/cancel":  {"": models.RoleBarista},
+	"/menu":                {http.MethodGet: models.RoleBarista, http.MethodPost: models.RoleManager},
+	"/menu/available":      {"": models.RoleBarista},
+	"/menu/import":         {"": models.RoleManager},
+	"/menu/{id}":           {http.MethodGet: models.RoleBarista, http.MethodPut: models.RoleManager, http.MethodDelete: models.RoleManager},
+	"/inventory":           {http.MethodGet: models.RoleBarista, http.MethodPost: models.RoleManager},
+	"/inventory/low-stock": {"": models.RoleBarista},
+	"/inventory/import":    {"": models.RoleManager},
+	"/inventory/{id}":      {http.MethodGet: models.RoleBarista, http.MethodPut: models.RoleManager, http.MethodDelete: models.RoleManager},
+
+	"/inventory/{id}/movements":  {http.MethodGet: models.RoleBarista, http.MethodPost: models.RoleManager},
+	"/inventory/{id}/menu-items": {"": models.RoleBarista},
+
+	"/suppliers":                    {"": models.RoleManager},
+	"/suppliers/{id}":               {"": models.RoleManager},
+	"/purchase-orders":              {"": models.RoleManager},
+	"/purchase-orders/generate":     {"": models.RoleManager},
+	"/purchase-orders/{id}":         {"": models.RoleManager},
+	"/purchase-orders/{id}/submit":  {"": models.RoleManager},
+	"/purchase-orders/{id}/receive": {"": models.RoleManager},
+	"/purchase-orders/{id}/cancel":  {"": models.RoleManager},
+	"/reports/total-sales":          {"": models.RoleManager},
+	"/reports/sales":                {"": models.RoleManager},
+	"/reports/popular-items":        {"": models.RoleManager},
+	"/users/me":                     {"": models.RoleBarista},
+	"/users":                        {"": models.RoleAdmin},
+	"/users/{username}":             {"": models.RoleAdmin},
+	"/users/{username}/key":         {"": models.RoleAdmin},
+	"/metrics":                      {"": models.RoleManager},
+}
+
+// publicRoutes are served without an API key, for process supervisors.
+// Metrics hold business figures, so scrapers need a key like anyone else.
+var publicRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// requiredRole returns the least privileged role allowed to use the route
+func requiredRole(pattern, method string) string {
+	byMethod, ok := permissions[pattern]
+	if !ok {
+		return models.RoleAdmin
+	}
+	if role, ok := byMethod[method]; ok {
+		return role
+	}
+	if role, ok := byMethod[""]; ok {
+		return role
+	}
+	return models.RoleAdmin
+}
+
+type userKey struct{}
+
+// currentUser returns the user a request was authenticated as
+func currentUser(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userKey{}).(*models.User)
+	return user, ok
+}
+
+// apiKey reads the key from an "Authorization: Bearer" or an X-API-Key header
+func apiKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, key, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(key)
+		}
+		return ""
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// RequireAuth wraps mux so every request must carry the API key of a user
+// whose role may use the route
+func RequireAuth(mux *http.ServeMux, userService service.UserService, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if publicRoutes[pattern] {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := userService.Authenticate(r.Context(), apiKey(r))
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAPIKey) {
+				log.InfoContext(r.Context(), fmt.Sprintf("unauthenticated request: %s %s", r.Method, r.URL.Path))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="hot-coffee"`)
+				writeError(w, http.StatusUnauthorized, "a valid API key is required")
+				return
+			}
+			log.ErrorContext(r.Context(), fmt.Sprintf("error authenticating request: %v", err))
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+			return
+		}
+
+		// Unknown routes are left to the mux to answer
+		if pattern != "" {
+			if role := requiredRole(pattern, r.Method); !user.HasRole(role) {
+				log.InfoContext(r.Context(), fmt.Sprintf("forbidden: %s (%s) %s %s", user.Username, user.Role, r.Method, r.URL.Path))
+				writeError(w, http.StatusForbidden, fmt.Sprintf("this action requires the %s role", role))
+				return
+			}
+		}
+
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
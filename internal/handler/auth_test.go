@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// keyedUsers authenticates the users in byKey, or fails every call with err
+type keyedUsers struct {
+	service.UserService
+	byKey map[string]models.User
+	err   error
+}
+
+func (s keyedUsers) Authenticate(ctx context.Context, key string) (*models.User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	user, ok := s.byKey[key]
+	if !ok {
+		return nil, service.ErrInvalidAPIKey
+	}
+	return &user, nil
+}
+
+func TestRequireAuth(t *testing.T) {
+	users := keyedUsers{byKey: map[string]models.User{
+		"barista-key": {Username: "bea", Role: models.RoleBarista},
+		"manager-key": {Username: "max", Role: models.RoleManager},
+		"admin-key":   {Username: "ada", Role: models.RoleAdmin},
+	}}
+
+	// Every route answers with the user it was served for
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"/orders", "/orders/{id}", "/menu", "/metrics", "/users", "/users/me", "/healthz", "/readyz", "/unlisted"} {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := currentUser(r.Context()); ok {
+				w.Write([]byte(user.Username))
+			}
+		})
+	}
+	h := RequireAuth(mux, users, discardLog)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     string // "Name: value" of the header carrying the key
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no key", method: http.MethodGet, path: "/orders", wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodGet, path: "/orders", header: "X-API-Key: nope", wantStatus: http.StatusUnauthorized},
+		{name: "other scheme", method: http.MethodGet, path: "/orders", header: "Authorization: Basic barista-key", wantStatus: http.StatusUnauthorized},
+		{name: "bearer key", method: http.MethodGet, path: "/orders", header: "Authorization: Bearer barista-key", wantStatus: http.StatusOK, wantBody: "bea"},
+		{name: "X-API-Key header", method: http.MethodGet, path: "/orders", header: "X-API-Key: barista-key", wantStatus: http.StatusOK, wantBody: "bea"},
+
+		{name: "barista takes orders", method: http.MethodPost, path: "/orders", header: "X-API-Key: barista-key", wantStatus: http.StatusOK},
+		{name: "barista cannot delete orders", method: http.MethodDelete, path: "/orders/o1", header: "X-API-Key: barista-key", wantStatus: http.StatusForbidden},
+		{name: "manager deletes orders", method: http.MethodDelete, path: "/orders/o1", header: "X-API-Key: manager-key", wantStatus: http.StatusOK},
+		{name: "barista reads the menu", method: http.MethodGet, path: "/menu", header: "X-API-Key: barista-key", wantStatus: http.StatusOK},
+		{name: "barista cannot change the menu", method: http.MethodPost, path: "/menu", header: "X-API-Key: barista-key", wantStatus: http.StatusForbidden},
+		{name: "barista cannot read metrics", method: http.MethodGet, path: "/metrics", header: "X-API-Key: barista-key", wantStatus: http.StatusForbidden},
+		{name: "manager reads metrics", method: http.MethodGet, path: "/metrics", header: "X-API-Key: manager-key", wantStatus: http.StatusOK},
+		{name: "barista sees itself", method: http.MethodGet, path: "/users/me", header: "X-API-Key: barista-key", wantStatus: http.StatusOK},
+		{name: "manager cannot manage users", method: http.MethodGet, path: "/users", header: "X-API-Key: manager-key", wantStatus: http.StatusForbidden},
+		{name: "admin manages users", method: http.MethodGet, path: "/users", header: "X-API-Key: admin-key", wantStatus: http.StatusOK, wantBody: "ada"},
+		{name: "route missing from the table is for admins", method: http.MethodGet, path: "/unlisted", header: "X-API-Key: manager-key", wantStatus: http.StatusForbidden},
+		{name: "admin uses a route missing from the table", method: http.MethodGet, path: "/unlisted", header: "X-API-Key: admin-key", wantStatus: http.StatusOK},
+		{name: "unknown route with a key", method: http.MethodGet, path: "/nowhere", header: "X-API-Key: barista-key", wantStatus: http.StatusNotFound},
+
+		{name: "liveness is public", method: http.MethodGet, path: "/healthz", wantStatus: http.StatusOK},
+		{name: "readiness is public", method: http.MethodGet, path: "/readyz", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if name, value, ok := strings.Cut(tt.header, ": "); ok {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("served for %q, want %q", w.Body, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestRequireAuthFailure(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {})
+	h := RequireAuth(mux, keyedUsers{err: errors.New("users.json: permission denied")}, discardLog)
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("X-API-Key", "barista-key")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "users.json") {
+		t.Errorf("body leaks the internal error: %s", w.Body)
+	}
+}
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		want    string
+	}{
+		{pattern: "/orders", method: http.MethodGet, want: models.RoleBarista},
+		{pattern: "/orders/{id}", method: http.MethodDelete, want: models.RoleManager},
+		{pattern: "/orders/{id}/cancel", method: http.MethodPost, want: models.RoleBarista},
+		{pattern: "/menu", method: http.MethodPost, want: models.RoleManager},
+		{pattern: "/inventory/{id}/movements", method: http.MethodPost, want: models.RoleManager},
+		{pattern: "/users/me", method: http.MethodGet, want: models.RoleBarista},
+		{pattern: "/users", method: http.MethodGet, want: models.RoleAdmin},
+		{pattern: "/metrics", method: http.MethodGet, want: models.RoleManager},
+		{pattern: "/orders", method: http.MethodPatch, want: models.RoleAdmin}, // method not in the table
+		{pattern: "/unlisted", method: http.MethodGet, want: models.RoleAdmin}, // route not in the table
+	}
+
+	for _, tt := range tests {
+		if got := requiredRole(tt.pattern, tt.method); got != tt.want {
+			t.Errorf("requiredRole(%s, %s) = %s, want %s", tt.pattern, tt.method, got, tt.want)
+		}
+	}
+}
+
+// TestPermissionsMatchRoutes makes sure every entry of the permission table
+// names a route the server has, so a renamed route cannot quietly fall back
+// to admins only
+func TestPermissionsMatchRoutes(t *testing.T) {
+	mux := Routes(nil, nil, nil, nil, nil, nil, nil)
+	replacer := strings.NewReplacer("{id}", "x1", "{username}", "bea")
+
+	for pattern := range permissions {
+		r := httptest.NewRequest(http.MethodGet, replacer.Replace(pattern), nil)
+		if _, got := mux.Handler(r); got != pattern {
+			t.Errorf("permission for %s, but the request is routed to %q", pattern, got)
+		}
+	}
+	for pattern := range publicRoutes {
+		if _, ok := permissions[pattern]; ok {
+			t.Errorf("public route %s is in the permission table", pattern)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"fmt"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// Output formats of list and report endpoints
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// outputFormat picks the format of a response from the ?format= parameter
+// or, without one, from the Accept header. JSON is the default.
+func outputFormat(r *http.Request) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		switch format {
+		case formatJSON, formatCSV, formatXLSX:
+			return format, nil
+		}
+		return "", fmt.Errorf("format must be one of: json, csv, xlsx")
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return formatCSV, nil
+		case export.ContentTypeXLSX:
+			return formatXLSX, nil
+		case "application/json":
+			return formatJSON, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// writeTable writes data as JSON, or the sheet built from it as a CSV or
+// XLSX attachment named after the sheet, as the request asks
+func writeTable(w http.ResponseWriter, r *http.Request, log *slog.Logger, data interface{}, sheet func() export.Sheet) {
+	format, err := outputFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if format == formatJSON {
+		writeJSON(w, http.StatusOK, data)
+		return
+	}
+
+	s := sheet()
+	filename := fmt.Sprintf("%s.%s", s.Name, format)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	// The status is sent before the body, so a failure part way through can
+	// only cut the file short and be logged
+	write, contentType := export.WriteXLSX, export.ContentTypeXLSX
+	if format == formatCSV {
+		write, contentType = export.WriteCSV, export.ContentTypeCSV
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := write(w, s); err != nil {
+		log.ErrorContext(r.Context(), fmt.Sprintf("error writing %s: %v", filename, err))
+	}
+}
+
+func formatQuantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// rowsOf yields the row of each item, formatting it only when the writer
+// asks for it
+func rowsOf[T any](items []T, row func(T) []string) iter.Seq[[]string] {
+	return func(yield func([]string) bool) {
+		for _, item := range items {
+			if !yield(row(item)) {
+				return
+			}
+		}
+	}
+}
+
+func ordersSheet(orders []models.Order) export.Sheet {
+	return export.Sheet{
+		Name: "orders",
+		Columns: []export.Column{
+			{Name: "order_id"},
+			{Name: "customer_name"},
+			{Name: "status"},
+			{Name: "created_at"},
+			{Name: "items"},
+			{Name: "item_count", Numeric: true},
+			{Name: "subtotal", Numeric: true},
+			{Name: "discount", Numeric: true},
+			{Name: "tax", Numeric: true},
+			{Name: "total", Numeric: true},
+			{Name: "currency"},
+		},
+		Rows: rowsOf(orders, func(order models.Order) []string {
+			items := make([]string, len(order.Items))
+			count := 0
+			for i, item := range order.Items {
+				items[i] = fmt.Sprintf("%s x%d", item.ProductID, item.Quantity)
+				count += item.Quantity
+			}
+
+			return []string{
+				order.ID,
+				order.CustomerName,
+				order.Status,
+				order.CreatedAt,
+				strings.Join(items, "; "),
+				strconv.Itoa(count),
+				order.Subtotal.Decimal(),
+				order.Discount.Decimal(),
+				order.Tax.Decimal(),
+				order.Total.Decimal(),
+				order.Total.Currency,
+			}
+		}),
+	}
+}
+
+func inventorySheet(items []models.InventoryItem) export.Sheet {
+	return export.Sheet{
+		Name: "inventory",
+		Columns: []export.Column{
+			{Name: "ingredient_id"},
+			{Name: "name"},
+			{Name: "quantity", Numeric: true},
+			{Name: "unit"},
+			{Name: "reorder_threshold", Numeric: true},
+			{Name: "reorder_quantity", Numeric: true},
+			{Name: "supplier_id"},
+			{Name: "shot_size", Numeric: true},
+		},
+		Rows: rowsOf(items, func(item models.InventoryItem) []string {
+			return []string{
+				item.IngredientID,
+				item.Name,
+				formatQuantity(item.Quantity),
+				item.Unit,
+				formatQuantity(item.ReorderThreshold),
+				formatQuantity(item.ReorderQuantity),
+				item.SupplierID,
+				formatQuantity(item.ShotSize),
+			}
+		}),
+	}
+}
+
+func menuSheet(items []models.MenuItem) export.Sheet {
+	return export.Sheet{
+		Name: "menu",
+		Columns: []export.Column{
+			{Name: "product_id"},
+			{Name: "name"},
+			{Name: "description"},
+			{Name: "price", Numeric: true},
+			{Name: "currency"},
+			{Name: "ingredients"},
+		},
+		Rows: rowsOf(items, func(item models.MenuItem) []string {
+			ingredients := make([]string, len(item.Ingredients))
+			for i, ingredient := range item.Ingredients {
+				ingredients[i] = strings.TrimSpace(fmt.Sprintf("%s %s %s",
+					ingredient.IngredientID, formatQuantity(ingredient.Quantity), ingredient.Unit))
+			}
+
+			return []string{
+				item.ID,
+				item.Name,
+				item.Description,
+				item.Price.Decimal(),
+				item.Price.Currency,
+				strings.Join(ingredients, "; "),
+			}
+		}),
+	}
+}
+
+func totalSalesSheet(sales models.Sales) export.Sheet {
+	return export.Sheet{
+		Name: "total_sales",
+		Columns: []export.Column{
+			{Name: "from"},
+			{Name: "to"},
+			{Name: "statuses"},
+			{Name: "order_count", Numeric: true},
+			{Name: "total_revenue", Numeric: true},
+			{Name: "currency"},
+			{Name: "total_items_sold", Numeric: true},
+		},
+		Rows: rowsOf([]models.Sales{sales}, func(sales models.Sales) []string {
+			return []string{
+				sales.From,
+				sales.To,
+				strings.Join(sales.Statuses, ","),
+				strconv.Itoa(sales.OrderCount),
+				sales.TotalRevenue.Decimal(),
+				sales.TotalRevenue.Currency,
+				strconv.Itoa(sales.TotalItemsSold),
+			}
+		}),
+	}
+}
+
+func salesSheet(report models.SalesReport) export.Sheet {
+	return export.Sheet{
+		Name: "sales_by_" + report.GroupBy,
+		Columns: []export.Column{
+			{Name: report.GroupBy},
+			{Name: "name"},
+			{Name: "order_count", Numeric: true},
+			{Name: "revenue", Numeric: true},
+			{Name: "currency"},
+			{Name: "items_sold", Numeric: true},
+		},
+		Rows: rowsOf(report.Groups, func(group models.SalesGroup) []string {
+			return []string{
+				group.Key,
+				group.Name,
+				strconv.Itoa(group.OrderCount),
+				group.Revenue.Decimal(),
+				group.Revenue.Currency,
+				strconv.Itoa(group.ItemsSold),
+			}
+		}),
+	}
+}
+
+func popularItemsSheet(report models.PopularItems) export.Sheet {
+	return export.Sheet{
+		Name: "popular_items",
+		Columns: []export.Column{
+			{Name: "rank", Numeric: true},
+			{Name: "product_id"},
+			{Name: "product_name"},
+			{Name: "quantity_sold", Numeric: true},
+			{Name: "revenue", Numeric: true},
+			{Name: "currency"},
+			{Name: "share", Numeric: true},
+		},
+		Rows: rowsOf(report.List, func(item models.PopularItem) []string {
+			return []string{
+				strconv.Itoa(item.Rank),
+				item.ProductID,
+				item.ProductName,
+				strconv.Itoa(item.QuantitySold),
+				item.Revenue.Decimal(),
+				item.Revenue.Currency,
+				formatQuantity(item.Share),
+			}
+		}),
+	}
+}
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -22,3 +24,20 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 func writeError(w http.ResponseWriter, status int, err string) {
 	writeJSON(w, status, response{Error: err})
 }
+
+// bodyTooLarge tells whether err comes from reading a request body past the
+// size limit
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// writeBodyError answers a request whose body could not be read
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/metrics"
+)
+
+// ReadinessCheck is one condition the server must meet to take requests
+type ReadinessCheck struct {
+	Name  string
+	Check func() error
+}
+
+// HealthHandler answers the process supervisor and metrics scrapers
+type HealthHandler struct {
+	checks []ReadinessCheck
+	log    *slog.Logger
+}
+
+func NewHealthHandler(checks []ReadinessCheck, log *slog.Logger) *HealthHandler {
+	return &HealthHandler{
+		checks: checks,
+		log:    log,
+	}
+}
+
+// healthStatus is the body of the health and readiness answers
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// GetHealth answers as long as the process serves requests
+func (h HealthHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// GetReadiness runs every readiness check and answers 503 if one fails
+func (h HealthHandler) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	status := healthStatus{Status: "ready", Checks: make(map[string]string, len(h.checks))}
+	code := http.StatusOK
+
+	for _, check := range h.checks {
+		if err := check.Check(); err != nil {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("readiness check %s failed: %v", check.Name, err))
+			status.Checks[check.Name] = err.Error()
+			status.Status = "not ready"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		status.Checks[check.Name] = "ok"
+	}
+
+	writeJSON(w, code, status)
+}
+
+// GetMetrics writes the server metrics in the Prometheus text format
+func (h HealthHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.Default.WriteText(w); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error writing metrics: %v", err))
+	}
+}
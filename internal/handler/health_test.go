@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/internal/metrics"
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+)
+
+func TestGetHealth(t *testing.T) {
+	// Liveness does not depend on the readiness checks
+	h := NewHealthHandler([]ReadinessCheck{{Name: "storage", Check: func() error { return os.ErrClosed }}}, discardLog)
+	w := httptest.NewRecorder()
+	h.GetHealth(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"ok"`) {
+		t.Errorf("GetHealth() = %d %s, want 200 ok", w.Code, w.Body)
+	}
+}
+
+func TestGetReadiness(t *testing.T) {
+	tests := []struct {
+		name       string
+		breakData  func(t *testing.T, dir, file string)
+		wantStatus int
+		wantChecks map[string]string // check to "ok" or "failed"
+	}{
+		{
+			name:       "ready",
+			breakData:  func(t *testing.T, dir, file string) {},
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"storage": "ok", "data_dir": "ok"},
+		},
+		{
+			name: "storage file corrupted",
+			breakData: func(t *testing.T, dir, file string) {
+				if err := os.WriteFile(file, []byte(`{"not": "a list"`), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"storage": "failed", "data_dir": "ok"},
+		},
+		{
+			name: "storage file removed",
+			breakData: func(t *testing.T, dir, file string) {
+				if err := os.Remove(file); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"storage": "failed", "data_dir": "ok"},
+		},
+		{
+			name: "data directory gone",
+			breakData: func(t *testing.T, dir, file string) {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"storage": "failed", "data_dir": "failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "data")
+			file := filepath.Join(dir, core.SupplierFile)
+			storage, err := repository.NewJSONStorage(file)
+			if err != nil {
+				t.Fatalf("NewJSONStorage() error = %v", err)
+			}
+			journal, err := repository.NewJournal("", discardLog, storage)
+			if err != nil {
+				t.Fatalf("NewJournal() error = %v", err)
+			}
+
+			// The checks the server runs
+			h := NewHealthHandler([]ReadinessCheck{
+				{Name: "storage", Check: journal.Validate},
+				{Name: "data_dir", Check: func() error { return repository.CheckWritable(dir) }},
+			}, discardLog)
+
+			tt.breakData(t, dir, file)
+			w := httptest.NewRecorder()
+			h.GetReadiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			var got healthStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body unreadable: %v", err)
+			}
+			if wantReady := tt.wantStatus == http.StatusOK; (got.Status == "ready") != wantReady {
+				t.Errorf("status field = %q", got.Status)
+			}
+			for name, want := range tt.wantChecks {
+				if result := got.Checks[name]; (result == "ok") != (want == "ok") {
+					t.Errorf("check %s = %q, want %s", name, result, want)
+				}
+			}
+		})
+	}
+}
+
+// sampleLine is a metric line of the text exposition format
+var sampleLine = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\]|\\.)*",?)*\})? -?([0-9.e+-]+|\+Inf|NaN)$`)
+
+func TestGetMetrics(t *testing.T) {
+	// Make sure every kind of family has a sample
+	metrics.HTTPRequests.Inc("/orders/{id}", http.MethodGet, "200")
+	metrics.HTTPRequestDuration.Observe(0.02, "/orders/{id}", http.MethodGet)
+
+	h := NewHealthHandler(nil, discardLog)
+	w := httptest.NewRecorder()
+	h.GetMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+	}
+
+	body := w.Body.String()
+	if !strings.HasSuffix(body, "\n") {
+		t.Error("exposition does not end with a newline")
+	}
+	typed := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				t.Errorf("malformed TYPE line %q", line)
+				continue
+			}
+			typed[fields[2]] = fields[3]
+		case sampleLine.MatchString(line):
+			name := line[:strings.IndexAny(line, "{ ")]
+			base := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+			if _, ok := typed[name]; !ok {
+				if _, ok := typed[base]; !ok {
+					t.Errorf("sample %q before the TYPE of its family", line)
+				}
+			}
+		default:
+			t.Errorf("malformed line %q", line)
+		}
+	}
+
+	for name, kind := range map[string]string{
+		"hotcoffee_http_requests_total":           "counter",
+		"hotcoffee_http_request_duration_seconds": "histogram",
+		"hotcoffee_orders_created_total":          "counter",
+		"hotcoffee_storage_writes_total":          "counter",
+		"hotcoffee_storage_errors_total":          "counter",
+	} {
+		if typed[name] != kind {
+			t.Errorf("%s has type %q, want %s", name, typed[name], kind)
+		}
+	}
+	for _, want := range []string{
+		`hotcoffee_http_requests_total{route="/orders/{id}",method="GET",status="200"} `,
+		`hotcoffee_http_request_duration_seconds_bucket{route="/orders/{id}",method="GET",le="+Inf"} `,
+		"hotcoffee_orders_created_total ",
+	} {
+		if !strings.Contains(body, "\n"+want) {
+			t.Errorf("exposition has no sample %q", want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// csvRecord is a data row of an imported CSV file with its columns looked
+// up by header name
+type csvRecord struct {
+	columns map[string]int
+	values  []string
+}
+
+func (c csvRecord) get(name string) string {
+	i, ok := c.columns[name]
+	if !ok || i >= len(c.values) {
+		return ""
+	}
+	return strings.TrimSpace(c.values[i])
+}
+
+func (c csvRecord) float(name string) (float64, error) {
+	value := c.get(name)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	return f, nil
+}
+
+// readImport reads the CSV of an import, sent either as the request body or
+// as the "file" field of a multipart form. The header must name every
+// required column and may only use the columns of the matching export, in
+// any order.
+func readImport(r *http.Request, sheet export.Sheet, required ...string) ([]csvRecord, error) {
+	var body io.Reader = r.Body
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("multipart upload must have a file field: %w", err)
+		}
+		defer file.Close()
+		body = file
+	}
+
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("CSV has no header")
+	}
+
+	known := make(map[string]bool, len(sheet.Columns))
+	for _, column := range sheet.Columns {
+		known[column.Name] = true
+	}
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		columns[name] = i
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column: %s", name)
+		}
+	}
+
+	rows := make([]csvRecord, 0, len(records)-1)
+	for _, values := range records[1:] {
+		rows = append(rows, csvRecord{columns: columns, values: values})
+	}
+	return rows, nil
+}
+
+// importOptions reads the ?upsert= and ?dry_run= parameters of an import
+func importOptions(r *http.Request) (upsert, dryRun bool, err error) {
+	query := r.URL.Query()
+	for name, value := range map[string]*bool{"upsert": &upsert, "dry_run": &dryRun} {
+		if v := query.Get(name); v != "" {
+			if *value, err = strconv.ParseBool(v); err != nil {
+				return false, false, fmt.Errorf("%s must be true or false", name)
+			}
+		}
+	}
+	return upsert, dryRun, nil
+}
+
+// writeImportResult answers an import. Rejected rows make it a bad request;
+// the result lists them.
+func writeImportResult(w http.ResponseWriter, result *models.ImportResult, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, result)
+	case errors.Is(err, service.ErrImportFailed):
+		writeJSON(w, http.StatusBadRequest, result)
+	default:
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+func inventoryItemFromCSV(row csvRecord) (models.InventoryItem, error) {
+	item := models.InventoryItem{
+		IngredientID: row.get("ingredient_id"),
+		Name:         row.get("name"),
+		Unit:         row.get("unit"),
+		SupplierID:   row.get("supplier_id"),
+	}
+
+	var err error
+	if item.Quantity, err = row.float("quantity"); err != nil {
+		return item, err
+	}
+	if item.ReorderThreshold, err = row.float("reorder_threshold"); err != nil {
+		return item, err
+	}
+	if item.ReorderQuantity, err = row.float("reorder_quantity"); err != nil {
+		return item, err
+	}
+	if item.ShotSize, err = row.float("shot_size"); err != nil {
+		return item, err
+	}
+
+	return item, item.IsValid()
+}
+
+// menuItemFromCSV reads a menu row. Ingredients are written as in the
+// export: "beans 18; milk 0.2 l", the unit being optional.
+func menuItemFromCSV(row csvRecord) (models.MenuItem, error) {
+	item := models.MenuItem{
+		ID:          row.get("product_id"),
+		Name:        row.get("name"),
+		Description: row.get("description"),
+		Ingredients: []models.MenuItemIngredient{},
+	}
+
+	currency := models.DefaultCurrency
+	if c := row.get("currency"); c != "" {
+		currency = strings.ToUpper(c)
+	}
+	if price := row.get("price"); price != "" {
+		var err error
+		if item.Price, err = models.ParseMoney(price, currency); err != nil {
+			return item, errors.New("price must be a number")
+		}
+	}
+
+	for _, part := range strings.Split(row.get("ingredients"), ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 {
+			return item, fmt.Errorf("ingredient %q must be an ID, a quantity and an optional unit", strings.TrimSpace(part))
+		}
+
+		ingredient := models.MenuItemIngredient{IngredientID: fields[0]}
+		if len(fields) > 1 {
+			quantity, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return item, fmt.Errorf("quantity of ingredient %s must be a number", fields[0])
+			}
+			ingredient.Quantity = quantity
+		}
+		if len(fields) > 2 {
+			ingredient.Unit = fields[2]
+		}
+		item.Ingredients = append(item.Ingredients, ingredient)
+	}
+
+	return item, item.IsValid()
+}
+
+func (h InventoryHandler) ImportInventory(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "ImportInventory called")
+
+	upsert, dryRun, err := importOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := readImport(r, inventorySheet(nil), "ingredient_id", "name", "quantity", "unit")
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading inventory import: %v", err))
+		if bodyTooLarge(err) {
+			writeBodyError(w, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	result := models.NewImportResult(dryRun, upsert)
+	items := make([]models.InventoryItem, len(rows))
+	for i, row := range rows {
+		if items[i], err = inventoryItemFromCSV(row); err != nil {
+			result.AddError(i+2, items[i].IngredientID, err)
+		}
+	}
+	if len(result.Errors) > 0 {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("inventory import has %d invalid rows", len(result.Errors)))
+		writeJSON(w, http.StatusBadRequest, result)
+		return
+	}
+
+	result, err = h.inventoryService.ImportInventoryItems(r.Context(), items, upsert, dryRun)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error importing inventory: %v", err))
+	} else {
+		h.log.InfoContext(r.Context(), fmt.Sprintf("imported inventory: %d created, %d updated, dry run %t", len(result.Created), len(result.Updated), dryRun))
+	}
+	writeImportResult(w, result, err)
+}
+
+func (h MenuHandler) ImportMenu(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "ImportMenu called")
+
+	upsert, dryRun, err := importOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := readImport(r, menuSheet(nil), "product_id", "name", "price")
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading menu import: %v", err))
+		if bodyTooLarge(err) {
+			writeBodyError(w, err)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	result := models.NewImportResult(dryRun, upsert)
+	items := make([]models.MenuItem, len(rows))
+	for i, row := range rows {
+		if items[i], err = menuItemFromCSV(row); err != nil {
+			result.AddError(i+2, items[i].ID, err)
+		}
+	}
+	if len(result.Errors) > 0 {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("menu import has %d invalid rows", len(result.Errors)))
+		writeJSON(w, http.StatusBadRequest, result)
+		return
+	}
+
+	result, err = h.menuService.ImportMenuItems(r.Context(), items, upsert, dryRun)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error importing menu: %v", err))
+	} else {
+		h.log.InfoContext(r.Context(), fmt.Sprintf("imported menu: %d created, %d updated, dry run %t", len(result.Created), len(result.Updated), dryRun))
+	}
+	writeImportResult(w, result, err)
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// importRequest returns a request posting csv as its body
+func importRequest(csv string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/inventory/import", strings.NewReader(csv))
+	r.Header.Set("Content-Type", "text/csv")
+	return r
+}
+
+func TestReadImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		wantRows int
+		wantErr  string
+	}{
+		{name: "rows", csv: "ingredient_id,name,quantity,unit\nbeans,Beans,1000,g\nmilk,Milk,2,l\n", wantRows: 2},
+		{name: "header only", csv: "ingredient_id,name,quantity,unit\n", wantRows: 0},
+		{name: "columns in any order and case", csv: "Unit, QUANTITY ,name,ingredient_id\ng,1000,Beans,beans\n", wantRows: 1},
+		{name: "short rows are allowed", csv: "ingredient_id,name,quantity,unit,supplier_id\nbeans,Beans,1000,g\n", wantRows: 1},
+		{name: "empty", csv: "", wantErr: "CSV has no header"},
+		{name: "missing column", csv: "ingredient_id,name,quantity\nbeans,Beans,1000\n", wantErr: "missing column: unit"},
+		{name: "unknown column", csv: "ingredient_id,name,quantity,unit,colour\n", wantErr: "unknown column: colour"},
+		{name: "invalid CSV", csv: "ingredient_id,name,quantity,unit\n\"beans,Beans,1000,g\n", wantErr: "invalid CSV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImport(importRequest(tt.csv), inventorySheet(nil), "ingredient_id", "name", "quantity", "unit")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readImport() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readImport() error = %v", err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("rows = %d, want %d", len(rows), tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestReadImportMultipart(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "inventory.csv")
+	file.Write([]byte("ingredient_id,name,quantity,unit\nbeans,Beans,1000,g\n"))
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/inventory/import", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	rows, err := readImport(r, inventorySheet(nil), "ingredient_id")
+	if err != nil {
+		t.Fatalf("readImport() error = %v", err)
+	}
+	if len(rows) != 1 || rows[0].get("ingredient_id") != "beans" {
+		t.Errorf("rows = %+v, want the beans row", rows)
+	}
+}
+
+func TestInventoryItemFromCSV(t *testing.T) {
+	header := "ingredient_id,name,quantity,unit,reorder_threshold,reorder_quantity,supplier_id,shot_size\n"
+	tests := []struct {
+		name    string
+		row     string
+		want    models.InventoryItem
+		wantErr string
+	}{
+		{
+			name: "every column",
+			row:  "beans,Beans,1000,g,200,1000,roaster,",
+			want: models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g", ReorderThreshold: 200, ReorderQuantity: 1000, SupplierID: "roaster"},
+		},
+		{
+			name: "empty numbers are zero",
+			row:  " milk , Milk ,2.5,l,,,,30",
+			want: models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 2.5, Unit: "l", ShotSize: 30},
+		},
+		{name: "quantity not a number", row: "beans,Beans,lots,g,,,,", wantErr: "quantity must be a number"},
+		{name: "threshold not a number", row: "beans,Beans,1,g,low,,,", wantErr: "reorder_threshold must be a number"},
+		{name: "invalid item", row: "beans,Beans,-1,g,,,,", wantErr: "quantity"},
+		{name: "unknown unit", row: "beans,Beans,1,cups,,,,", wantErr: "unit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImport(importRequest(header+tt.row+"\n"), inventorySheet(nil))
+			if err != nil {
+				t.Fatalf("readImport() error = %v", err)
+			}
+
+			item, err := inventoryItemFromCSV(rows[0])
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("inventoryItemFromCSV() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("inventoryItemFromCSV() error = %v", err)
+			}
+			if item != tt.want {
+				t.Errorf("item = %+v, want %+v", item, tt.want)
+			}
+		})
+	}
+}
+
+func TestMenuItemFromCSV(t *testing.T) {
+	header := "product_id,name,description,price,currency,ingredients\n"
+	tests := []struct {
+		name    string
+		row     string
+		want    models.MenuItem
+		wantErr string
+	}{
+		{
+			name: "ingredients with and without unit",
+			row:  `latte,Latte,Milky,3.5,,"beans 18; milk 0.2 l"`,
+			want: models.MenuItem{
+				ID: "latte", Name: "Latte", Description: "Milky", Price: models.NewMoney(350, "USD"),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}, {IngredientID: "milk", Quantity: 0.2, Unit: "l"}},
+			},
+		},
+		{
+			name: "currency, rounding and empty parts",
+			row:  `tea,Tea,,4.505,usd,"leaves 3;;"`,
+			want: models.MenuItem{
+				ID: "tea", Name: "Tea", Price: models.NewMoney(451, "USD"),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: "leaves", Quantity: 3}},
+			},
+		},
+		{name: "price in another currency", row: `tea,Tea,,450,JPY,`, wantErr: "price must be in USD"},
+		{name: "price not a number", row: `tea,Tea,,cheap,,`, wantErr: "price must be a number"},
+		{name: "quantity not a number", row: `tea,Tea,,1,,"leaves some"`, wantErr: "quantity of ingredient leaves must be a number"},
+		{name: "too many fields", row: `tea,Tea,,1,,"leaves 3 g extra"`, wantErr: "an ID, a quantity and an optional unit"},
+		{name: "invalid item", row: `tea,,,1,,`, wantErr: "name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImport(importRequest(header+tt.row+"\n"), menuSheet(nil))
+			if err != nil {
+				t.Fatalf("readImport() error = %v", err)
+			}
+
+			item, err := menuItemFromCSV(rows[0])
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("menuItemFromCSV() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("menuItemFromCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(item, tt.want) {
+				t.Errorf("item = %+v, want %+v", item, tt.want)
+			}
+		})
+	}
+}
+
+// What is exported reads back as the same items
+func TestImportReadsExport(t *testing.T) {
+	inventory := []models.InventoryItem{
+		{IngredientID: "beans", Name: "Beans", Quantity: 1000.5, Unit: "g", ReorderThreshold: 200, SupplierID: "roaster"},
+		{IngredientID: "syrup", Name: "Syrup", Quantity: 750, Unit: "ml", ShotSize: 25},
+	}
+	menu := []models.MenuItem{
+		{
+			ID: "latte", Name: "Latte", Description: "=milk and coffee", Price: models.NewMoney(350, "USD"),
+			Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}, {IngredientID: "milk", Quantity: 0.2, Unit: "l"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteCSV(&buf, inventorySheet(inventory)); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	rows, err := readImport(importRequest(buf.String()), inventorySheet(nil))
+	if err != nil {
+		t.Fatalf("readImport() error = %v", err)
+	}
+	for i, row := range rows {
+		item, err := inventoryItemFromCSV(row)
+		if err != nil || item != inventory[i] {
+			t.Errorf("inventory row %d = %+v, %v, want %+v", i, item, err, inventory[i])
+		}
+	}
+
+	buf.Reset()
+	if err := export.WriteCSV(&buf, menuSheet(menu)); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	rows, err = readImport(importRequest(buf.String()), menuSheet(nil))
+	if err != nil {
+		t.Fatalf("readImport() error = %v", err)
+	}
+	item, err := menuItemFromCSV(rows[0])
+	if err != nil {
+		t.Fatalf("menuItemFromCSV() error = %v", err)
+	}
+	// Formula-like text comes back with the quote that disarms it
+	want := menu[0]
+	want.Description = "'" + want.Description
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("menu item = %+v, want %+v", item, want)
+	}
+}
+
+func TestImportOptions(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantUpsert bool
+		wantDryRun bool
+		wantErr    bool
+	}{
+		{query: ""},
+		{query: "upsert=true", wantUpsert: true},
+		{query: "dry_run=1&upsert=false", wantDryRun: true},
+		{query: "upsert=maybe", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/menu/import?"+tt.query, nil)
+		upsert, dryRun, err := importOptions(r)
+		if (err != nil) != tt.wantErr || upsert != tt.wantUpsert || dryRun != tt.wantDryRun {
+			t.Errorf("importOptions(%q) = %v, %v, %v, want %v, %v, error %v", tt.query, upsert, dryRun, err, tt.wantUpsert, tt.wantDryRun, tt.wantErr)
+		}
+	}
+}
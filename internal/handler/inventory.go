@@ -7,7 +7,9 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
 	"github.com/ab-dauletkhan/hot-coffee/internal/service"
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
@@ -26,12 +28,12 @@ func NewInventoryHandler(inventoryService service.InventoryService, log *slog.Lo
 }
 
 func (h InventoryHandler) AddInventoryItems(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("AddInventoryItems called")
+	h.log.InfoContext(r.Context(), "AddInventoryItems called")
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
@@ -40,166 +42,320 @@ func (h InventoryHandler) AddInventoryItems(w http.ResponseWriter, r *http.Reque
 	var singleItem models.InventoryItem
 	if err := json.Unmarshal(data, &singleItem); err == nil {
 		// If successful, handle single item addition
-		h.handleSingleInventoryItem(singleItem, w)
+		h.handleSingleInventoryItem(singleItem, w, r)
 		return
 	}
 
 	// Otherwise, try to unmarshal into an array of items
 	var items []models.InventoryItem
 	if err := json.Unmarshal(data, &items); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling request body: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
 		writeError(w, http.StatusBadRequest, "Invalid format: expected single or multiple inventory items")
 		return
 	}
 
 	// Handle multiple items
-	h.handleMultipleInventoryItems(items, w)
+	h.handleMultipleInventoryItems(items, w, r)
 }
 
 // Private helper to handle single inventory item addition
-func (h InventoryHandler) handleSingleInventoryItem(item models.InventoryItem, w http.ResponseWriter) {
-	h.log.Info("handling single inventory item")
+func (h InventoryHandler) handleSingleInventoryItem(item models.InventoryItem, w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "handling single inventory item")
 
 	if err := item.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("invalid inventory item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid inventory item: %v", err))
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", item.Name, err))
 		return
 	}
 
-	if err := h.inventoryService.CreateInventoryItem(&item); err != nil {
-		h.log.Error(fmt.Sprintf("error creating single inventory item: %v", err))
+	if err := h.inventoryService.CreateInventoryItem(r.Context(), &item); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error creating single inventory item: %v", err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	h.log.Info("successfully created single inventory item")
+	h.log.InfoContext(r.Context(), "successfully created single inventory item")
 	writeJSON(w, http.StatusCreated, item)
 }
 
 // Private helper to handle multiple inventory items addition
-func (h InventoryHandler) handleMultipleInventoryItems(items []models.InventoryItem, w http.ResponseWriter) {
-	h.log.Info("handling multiple inventory items")
+func (h InventoryHandler) handleMultipleInventoryItems(items []models.InventoryItem, w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "handling multiple inventory items")
 
 	for _, item := range items {
 		if err := item.IsValid(); err != nil {
-			h.log.Error(fmt.Sprintf("invalid inventory item: %v", err))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid inventory item: %v", err))
 			writeError(w, http.StatusBadRequest, fmt.Sprintf("Item %s: %v", item.Name, err))
 			return
 		}
 	}
 
-	if err := h.inventoryService.CreateInventoryItems(&items); err != nil {
-		h.log.Error(fmt.Sprintf("error creating multiple inventory items: %v", err))
+	if err := h.inventoryService.CreateInventoryItems(r.Context(), &items); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error creating multiple inventory items: %v", err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	h.log.Info("successfully created multiple inventory items")
+	h.log.InfoContext(r.Context(), "successfully created multiple inventory items")
 	writeJSON(w, http.StatusCreated, items)
 }
 
 func (h InventoryHandler) GetAllInventory(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetAllInventory called")
+	h.log.InfoContext(r.Context(), "GetAllInventory called")
+
+	var filter models.InventoryFilter
+	if value := r.URL.Query().Get("low_stock"); value != "" {
+		var err error
+		if filter.LowStock, err = strconv.ParseBool(value); err != nil {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid low_stock value: %s", value))
+			writeError(w, http.StatusBadRequest, "low_stock must be true or false")
+			return
+		}
+	}
 
-	items, err := h.inventoryService.GetAllInventoryItems()
+	opts, err := parseListOptions(r, models.InventorySortFields)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting inventory items: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid list options: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, total, err := h.inventoryService.ListInventoryItems(r.Context(), filter, opts)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting inventory items: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
-	h.log.Info(fmt.Sprintf("got all inventory items: %v", items))
-	writeJSON(w, http.StatusOK, items)
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got inventory items: %d of %d", len(*items), total))
+	setTotalCount(w, total)
+	writeTable(w, r, h.log, items, func() export.Sheet { return inventorySheet(*items) })
+}
+
+func (h InventoryHandler) GetLowStock(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetLowStock called")
+
+	items, err := h.inventoryService.GetLowStockItems(r.Context())
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting low stock items: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got %d low stock items", len(*items)))
+	writeTable(w, r, h.log, items, func() export.Sheet {
+		sheet := inventorySheet(*items)
+		sheet.Name = "low_stock"
+		return sheet
+	})
 }
 
 func (h InventoryHandler) GetInventory(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetInventory called")
+	h.log.InfoContext(r.Context(), "GetInventory called")
 
 	id := r.PathValue("id")
 
-	item, err := h.inventoryService.GetInventoryItem(id)
+	item, err := h.inventoryService.GetInventoryItem(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, service.ErrInventoryItemNotFound) {
-			h.log.Error(fmt.Sprintf("item not found: %s", id))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
 			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
 			return
 		}
 
-		h.log.Error(fmt.Sprintf("error getting inventory item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting inventory item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("got inventory item: %v", item))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got inventory item: %v", item))
 	writeJSON(w, http.StatusOK, item)
 }
 
 func (h InventoryHandler) PutInventory(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("PutInventory called")
+	h.log.InfoContext(r.Context(), "PutInventory called")
 
 	id := r.PathValue("id")
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
 
 	var item models.InventoryItem
 	if err := json.Unmarshal(data, &item); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling request body: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
 		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
 		return
 	}
 
 	if err := item.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("invalid item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid item: %v", err))
 		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", item.Name, err))
 		return
 	}
 
 	if id != item.IngredientID {
-		h.log.Error(fmt.Sprintf("ID mismatch: have (%s), want (%s)", item.IngredientID, id))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("ID mismatch: have (%s), want (%s)", item.IngredientID, id))
 		writeError(w, http.StatusBadRequest, "ID mismatch in request body and URL")
 		return
 	}
 
-	err = h.inventoryService.UpdateInventoryItem(id, &item)
+	err = h.inventoryService.UpdateInventoryItem(r.Context(), id, &item)
 	if err != nil {
 		if errors.Is(err, service.ErrInventoryItemNotFound) {
-			h.log.Error(fmt.Sprintf("item not found: %s", id))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
 			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
 			return
 		}
+		if errors.Is(err, models.ErrIncompatibleUnits) || errors.Is(err, models.ErrUnknownUnit) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("unit change breaks recipes or orders: %v", err))
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 
-		h.log.Error(fmt.Sprintf("error updating inventory item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error updating inventory item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("updated inventory item: %v", item))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("updated inventory item: %v", item))
 	writeJSON(w, http.StatusOK, item)
 }
 
 func (h InventoryHandler) DeleteInventory(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("DeleteInventory called")
+	h.log.InfoContext(r.Context(), "DeleteInventory called")
 
 	id := r.PathValue("id")
 
-	err := h.inventoryService.DeleteInventoryItem(id)
+	cascade := false
+	if value := r.URL.Query().Get("cascade"); value != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(value); err != nil {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid cascade value: %s", value))
+			writeError(w, http.StatusBadRequest, "cascade must be true or false")
+			return
+		}
+	}
+
+	err := h.inventoryService.DeleteInventoryItem(r.Context(), id, cascade)
 	if err != nil {
 		if errors.Is(err, service.ErrInventoryItemNotFound) {
-			h.log.Error(fmt.Sprintf("item not found: %s", id))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
 			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
 			return
 		}
+		if errors.Is(err, service.ErrInventoryItemInUse) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item still in use: %v", err))
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 
-		h.log.Error(fmt.Sprintf("error deleting inventory item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error deleting inventory item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("deleted inventory item: %s", id))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("deleted inventory item: %s", id))
 	writeJSON(w, http.StatusNoContent, nil)
 }
+
+func (h InventoryHandler) GetInventoryMenuItems(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetInventoryMenuItems called")
+
+	id := r.PathValue("id")
+
+	menuItems, err := h.inventoryService.GetMenuItemsUsing(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrInventoryItemNotFound) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting menu items using inventory item: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got %d menu items using %s", len(*menuItems), id))
+	writeJSON(w, http.StatusOK, menuItems)
+}
+
+func (h InventoryHandler) GetInventoryMovements(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetInventoryMovements called")
+
+	id := r.PathValue("id")
+
+	ledger, err := h.inventoryService.GetMovements(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrInventoryItemNotFound) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting inventory movements: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got %d inventory movements for %s", len(ledger.Movements), id))
+	writeJSON(w, http.StatusOK, ledger)
+}
+
+func (h InventoryHandler) AddInventoryMovement(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "AddInventoryMovement called")
+
+	id := r.PathValue("id")
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var movement models.InventoryMovement
+	if err := json.Unmarshal(data, &movement); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
+		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if movement.IngredientID != "" && movement.IngredientID != id {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("ID mismatch: have (%s), want (%s)", movement.IngredientID, id))
+		writeError(w, http.StatusBadRequest, "ID mismatch in request body and URL")
+		return
+	}
+
+	if err := movement.IsValid(); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid movement: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.inventoryService.RecordMovement(r.Context(), id, &movement)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInventoryItemNotFound):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("item not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("item not found: %s", id))
+		case errors.Is(err, service.ErrInsufficientQuantity):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("movement exceeds stock: %v", err))
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, models.ErrIncompatibleUnits), errors.Is(err, models.ErrUnknownUnit):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid movement unit: %v", err))
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("error recording inventory movement: %v", err))
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("recorded inventory movement: %v", movement))
+	writeJSON(w, http.StatusCreated, movement)
+}
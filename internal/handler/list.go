@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// parseListOptions reads the ?offset=, ?limit=, ?sort= and ?order= (asc or
+// desc) parameters of a list endpoint. fields are the fields it sorts by.
+func parseListOptions(r *http.Request, fields []string) (models.ListOptions, error) {
+	var opts models.ListOptions
+	query := r.URL.Query()
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return opts, errors.New("offset must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return opts, errors.New("limit must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+
+	opts.Sort = query.Get("sort")
+	if err := opts.CheckSort(fields); err != nil {
+		return opts, err
+	}
+
+	switch strings.ToLower(query.Get("order")) {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+
+	return opts, nil
+}
+
+// parseOrderFilter reads the ?status=, ?customer=, ?from= and ?to=
+// parameters of the order list, the same way reports read them
+func parseOrderFilter(r *http.Request) (models.OrderFilter, error) {
+	report, err := parseReportFilter(r)
+	if err != nil {
+		return models.OrderFilter{}, err
+	}
+
+	return models.OrderFilter{
+		Statuses: report.Statuses,
+		Customer: strings.TrimSpace(r.URL.Query().Get("customer")),
+		From:     report.From,
+		To:       report.To,
+	}, nil
+}
+
+// setTotalCount tells the client how many records the list has before paging
+func setTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", fmt.Sprint(total))
+}
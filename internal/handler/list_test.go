@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestParseListOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    models.ListOptions
+		wantErr bool
+	}{
+		{name: "none", query: ""},
+		{name: "page", query: "offset=20&limit=10", want: models.ListOptions{Offset: 20, Limit: 10}},
+		{name: "sort ascending", query: "sort=name&order=asc", want: models.ListOptions{Sort: "name"}},
+		{name: "sort descending", query: "sort=quantity&order=DESC", want: models.ListOptions{Sort: "quantity", Desc: true}},
+		{name: "descending without sort", query: "order=desc", want: models.ListOptions{Desc: true}},
+		{name: "zero offset", query: "offset=0", want: models.ListOptions{}},
+		{name: "negative offset", query: "offset=-1", wantErr: true},
+		{name: "offset not a number", query: "offset=ten", wantErr: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit not a number", query: "limit=1.5", wantErr: true},
+		{name: "unknown sort field", query: "sort=price", wantErr: true},
+		{name: "unknown order", query: "sort=name&order=up", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/inventory?"+tt.query, nil)
+			got, err := parseListOptions(r, models.InventorySortFields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseListOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
 	"github.com/ab-dauletkhan/hot-coffee/internal/service"
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
@@ -26,12 +27,12 @@ func NewMenuHandler(menuService service.MenuService, log *slog.Logger) *MenuHand
 }
 
 func (h MenuHandler) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("CreateMenuItem called")
+	h.log.InfoContext(r.Context(), "CreateMenuItem called")
 
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 	defer r.Body.Close()
@@ -40,182 +41,205 @@ func (h MenuHandler) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 	var singleItem models.MenuItem
 	if err := json.Unmarshal(data, &singleItem); err == nil {
 		// If successful, handle single item addition
-		h.handleSingleMenuItem(singleItem, w)
+		h.handleSingleMenuItem(singleItem, w, r)
 		return
 	}
 
 	// Otherwise, try to unmarshal into an array of items
 	var items []models.MenuItem
 	if err := json.Unmarshal(data, &items); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling request body: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
 		writeError(w, http.StatusBadRequest, "Invalid format: expected single or multiple menu items")
 		return
 	}
 
 	// Handle multiple items
-	h.handleMultipleMenuItems(items, w)
+	h.handleMultipleMenuItems(items, w, r)
 }
 
-func (h MenuHandler) handleSingleMenuItem(item models.MenuItem, w http.ResponseWriter) {
-	h.log.Info("handleSingleMenuItem called")
+func (h MenuHandler) handleSingleMenuItem(item models.MenuItem, w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "handleSingleMenuItem called")
 
 	if err := item.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("error validating menu item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error validating menu item: %v", err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := h.menuService.CreateMenuItem(&item); err != nil {
-		h.log.Error(err.Error())
+	if err := h.menuService.CreateMenuItem(r.Context(), &item); err != nil {
+		h.log.ErrorContext(r.Context(), err.Error())
 		if errors.Is(err, service.ErrMenuItemAlreadyExists) {
-			h.log.Error(fmt.Sprintf("menu item already exists: %v", item))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("menu item already exists: %v", item))
 			writeError(w, http.StatusConflict, "Menu item already exists")
 			return
 		}
-		h.log.Error(fmt.Sprintf("error adding menu item: %v", err))
+		if errors.Is(err, service.ErrInventoryItemNotFound) || errors.Is(err, models.ErrIncompatibleUnits) || errors.Is(err, models.ErrUnknownUnit) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error adding menu item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu item added: %v", item))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu item added: %v", item))
 	w.WriteHeader(http.StatusCreated)
 }
 
-func (h MenuHandler) handleMultipleMenuItems(items []models.MenuItem, w http.ResponseWriter) {
-	h.log.Info("handleMultipleMenuItems called")
+func (h MenuHandler) handleMultipleMenuItems(items []models.MenuItem, w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "handleMultipleMenuItems called")
 
-	for _, item := range items {
-		if err := item.IsValid(); err != nil {
-			h.log.Error(fmt.Sprintf("error validating menu item: %v", err))
+	for i := range items {
+		if err := items[i].IsValid(); err != nil {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("error validating menu item: %v", err))
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
 	}
 
-	if errItem, err := h.menuService.CreateMenuItems(&items); err != nil {
+	if errItem, err := h.menuService.CreateMenuItems(r.Context(), &items); err != nil {
 		if errors.Is(err, service.ErrMenuItemAlreadyExists) {
-			h.log.Error(fmt.Sprintf("some menu item already exists: %v", errItem))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("some menu item already exists: %v", errItem))
 			writeError(w, http.StatusConflict, fmt.Sprintf("%s already exists", errItem.Name))
 			return
 		}
-		h.log.Error(fmt.Sprintf("error adding menu items: %v", err))
+		if errors.Is(err, service.ErrInventoryItemNotFound) || errors.Is(err, models.ErrIncompatibleUnits) || errors.Is(err, models.ErrUnknownUnit) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", errItem.Name, err))
+			return
+		}
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error adding menu items: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu items added: %v", items))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu items added: %v", items))
 	w.WriteHeader(http.StatusCreated)
 }
 
 func (h MenuHandler) GetAllMenu(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetAllMenu called")
+	h.log.InfoContext(r.Context(), "GetAllMenu called")
+
+	filter := models.MenuFilter{IngredientID: r.URL.Query().Get("ingredient")}
 
-	items, err := h.menuService.GetAllMenuItems()
+	opts, err := parseListOptions(r, models.MenuSortFields)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting menu items: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid list options: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, total, err := h.menuService.ListMenuItems(r.Context(), filter, opts)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting menu items: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu items retrieved: %v", items))
-	writeJSON(w, http.StatusOK, items)
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu items retrieved: %d of %d", len(*items), total))
+	setTotalCount(w, total)
+	writeTable(w, r, h.log, items, func() export.Sheet { return menuSheet(*items) })
 }
 
 func (h MenuHandler) GetAvailableMenuItems(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetAvailableMenuItems called")
+	h.log.InfoContext(r.Context(), "GetAvailableMenuItems called")
 
-	items, err := h.menuService.GetAvailableMenuItems()
+	items, err := h.menuService.GetAvailableMenuItems(r.Context())
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting menu items: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting menu items: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu items retrieved: %v", items))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu availability retrieved for %d items", len(*items)))
 	writeJSON(w, http.StatusOK, items)
 }
 
 func (h MenuHandler) GetMenuItem(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetMenuItem called")
+	h.log.InfoContext(r.Context(), "GetMenuItem called")
 
 	id := r.PathValue("id")
-	item, err := h.menuService.GetMenuItem(id)
+	item, err := h.menuService.GetMenuItem(r.Context(), id)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting menu item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting menu item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
 	if item == nil {
-		h.log.Error(fmt.Sprintf("menu item not found: %s", id))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("menu item not found: %s", id))
 		writeError(w, http.StatusNotFound, "Menu item not found")
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu item retrieved: %v", item))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu item retrieved: %v", item))
 	writeJSON(w, http.StatusOK, item)
 }
 
 func (h MenuHandler) PutMenuItem(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("PutMenuItem called")
+	h.log.InfoContext(r.Context(), "PutMenuItem called")
 
 	id := r.PathValue("id")
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 
 	var item models.MenuItem
 	if err := json.Unmarshal(data, &item); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling request body: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
 		writeError(w, http.StatusBadRequest, "Invalid format: expected menu item")
 		return
 	}
 
 	if err := item.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("error validating menu item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error validating menu item: %v", err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	if item.ID != id {
-		h.log.Error(fmt.Sprintf("id mismatch: %s != %s", item.ID, id))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("id mismatch: %s != %s", item.ID, id))
 		writeError(w, http.StatusBadRequest, "ID mismatch")
 		return
 	}
 
-	if err := h.menuService.UpdateMenuItem(id, &item); err != nil {
+	if err := h.menuService.UpdateMenuItem(r.Context(), id, &item); err != nil {
 		if errors.Is(err, service.ErrMenuItemNotFound) {
-			h.log.Error(fmt.Sprintf("menu item not found: %s", id))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("menu item not found: %s", id))
 			writeError(w, http.StatusNotFound, "Menu item not found")
 			return
 		}
+		if errors.Is(err, service.ErrInventoryItemNotFound) || errors.Is(err, models.ErrIncompatibleUnits) || errors.Is(err, models.ErrUnknownUnit) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid recipe units: %v", err))
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
-		h.log.Error(fmt.Sprintf("error updating menu item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error updating menu item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 }
 
 func (h MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("DeleteMenuItem called")
+	h.log.InfoContext(r.Context(), "DeleteMenuItem called")
 
 	id := r.PathValue("id")
-	err := h.menuService.DeleteMenuItem(id)
+	err := h.menuService.DeleteMenuItem(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, service.ErrMenuItemNotFound) {
-			h.log.Error(fmt.Sprintf("menu item not found: %s", id))
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("menu item not found: %s", id))
 			writeError(w, http.StatusNotFound, "Menu item not found")
 			return
 		}
 
-		h.log.Error(fmt.Sprintf("error deleting menu item: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error deleting menu item: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("menu item deleted: %s", id))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("menu item deleted: %s", id))
 	writeJSON(w, http.StatusNoContent, nil)
 }
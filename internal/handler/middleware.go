@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/internal/metrics"
+)
+
+// requestIDHeader carries the ID of a request to and from the client
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs taken from clients to ones that are
+// safe to echo and log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// Middleware wraps next with the handlers every request goes through: from
+// the outside in, request IDs, access logging, request metrics, panic
+// recovery, the request body limit and the request deadline. Metrics are
+// labelled with the mux route a request matches.
+func Middleware(next http.Handler, mux *http.ServeMux, timeout time.Duration, maxBodyBytes int64, log *slog.Logger) http.Handler {
+	return RequestID(AccessLog(Metrics(Recover(MaxBodySize(Timeout(next, timeout, log), maxBodyBytes), log), mux), log))
+}
+
+// RequestID gives every request an ID, kept from the X-Request-ID header
+// when the client sends a valid one. The ID is sent back in the same header
+// and put in the request context, where the logger picks it up.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(core.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Not unique, but the request is still served
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs every request once it has been answered, with its status,
+// size and latency
+func AccessLog(next http.Handler, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		// Deferred so that aborted responses are logged too
+		defer func() {
+			log.LogAttrs(r.Context(), slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("query", r.URL.RawQuery),
+				slog.Int("status", rec.Status()),
+				slog.Int64("bytes", rec.bytes),
+				slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+			)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// Metrics counts requests and their latency by route pattern, method and
+// status. Requests matching no route share the "unmatched" route, so that
+// made-up paths cannot grow the number of series.
+func Metrics(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec, ok := w.(*statusRecorder)
+		if !ok {
+			rec = &statusRecorder{ResponseWriter: w}
+		}
+
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+		}
+
+		// Deferred so that aborted responses are counted too
+		defer func() {
+			metrics.HTTPRequests.Inc(route, r.Method, strconv.Itoa(rec.Status()))
+			metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// Recover turns a panic in next into a logged error and a JSON 500, instead
+// of a dropped connection
+func Recover(next http.Handler, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := w.(*statusRecorder)
+		if !ok {
+			rec = &statusRecorder{ResponseWriter: w}
+		}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			log.ErrorContext(r.Context(), fmt.Sprintf("panic serving %s %s: %v", r.Method, r.URL.Path, err),
+				"stack", string(debug.Stack()))
+
+			// Part of the response is already sent, the client can only be
+			// told by cutting it short
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(rec, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// MaxBodySize refuses request bodies larger than limit bytes. A body known
+// to be too large from its Content-Length is refused before it is read.
+func MaxBodySize(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			writeBodyError(w, &http.MaxBytesError{Limit: limit})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Timeout gives every request a deadline, after which the work done for it
+// is abandoned. An error answered once the deadline has passed is replaced
+// with a 503, as it is most likely the deadline that caused it. A zero
+// timeout sets no deadline.
+func Timeout(next http.Handler, timeout time.Duration, log *slog.Logger) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+
+		if tw.timedOut {
+			log.WarnContext(ctx, fmt.Sprintf("request timed out after %v: %s %s", timeout, r.Method, r.URL.Path))
+		}
+	})
+}
+
+// timeoutWriter replaces an error written after the deadline passed with a
+// 503 saying so
+type timeoutWriter struct {
+	http.ResponseWriter
+	ctx      context.Context
+	timedOut bool
+}
+
+func (t *timeoutWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest && errors.Is(t.ctx.Err(), context.DeadlineExceeded) {
+		t.timedOut = true
+		writeError(t.ResponseWriter, http.StatusServiceUnavailable, "request timed out")
+		return
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	if t.timedOut {
+		return len(b), nil
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *timeoutWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// statusRecorder remembers the status and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Status is the status sent, 200 if the handler wrote nothing
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantPanic  any // what still escapes Recover
+		wantLogged bool
+	}{
+		{
+			name:       "no panic",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) },
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "panic before the response",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantLogged: true,
+		},
+		{
+			name: "panic after the response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				panic("boom")
+			},
+			wantStatus: http.StatusOK,
+			wantPanic:  http.ErrAbortHandler,
+			wantLogged: true,
+		},
+		{
+			name:       "deliberate abort",
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) },
+			wantStatus: http.StatusOK,
+			wantPanic:  http.ErrAbortHandler,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			h := Recover(tt.handler, slog.New(slog.NewTextHandler(&logged, nil)))
+			w := httptest.NewRecorder()
+
+			func() {
+				defer func() {
+					if got := recover(); got != tt.wantPanic {
+						t.Errorf("panic = %v, want %v", got, tt.wantPanic)
+					}
+				}()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+			}()
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusInternalServerError && strings.Contains(w.Body.String(), "boom") {
+				t.Errorf("body leaks the panic: %s", w.Body)
+			}
+			if got := strings.Contains(logged.String(), "panic serving GET /orders: boom"); got != tt.wantLogged {
+				t.Errorf("panic logged = %v, want %v: %s", got, tt.wantLogged, &logged)
+			}
+		})
+	}
+}
+
+func TestRecoverKeepsServing(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(Recover(mux, discardLog))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		path string
+		want int
+	}{
+		{path: "/panic", want: http.StatusInternalServerError},
+		{path: "/ok", want: http.StatusOK},
+		{path: "/panic", want: http.StatusInternalServerError},
+	} {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", tt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name   string
+		header string
+		want   string // "" for a generated ID
+	}{
+		{name: "taken from the client", header: "checkout-42.a:b", want: "checkout-42.a:b"},
+		{name: "none sent", header: ""},
+		{name: "unsafe characters", header: "id\" injected=1"},
+		{name: "too long", header: strings.Repeat("a", 65)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = core.RequestID(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.header != "" {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			echoed := w.Header().Get(requestIDHeader)
+			if tt.want != "" && echoed != tt.want {
+				t.Errorf("echoed ID = %q, want %q", echoed, tt.want)
+			}
+			if tt.want == "" && !generated.MatchString(echoed) {
+				t.Errorf("echoed ID = %q, want a generated one", echoed)
+			}
+			if seen != echoed {
+				t.Errorf("ID in the context = %q, echoed %q", seen, echoed)
+			}
+		})
+	}
+
+	// Generated IDs differ between requests
+	first, second := httptest.NewRecorder(), httptest.NewRecorder()
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+	h.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/", nil))
+	if first.Header().Get(requestIDHeader) == second.Header().Get(requestIDHeader) {
+		t.Error("two requests got the same generated ID")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus float64
+		wantBytes  float64
+	}{
+		{
+			name: "status and size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(5 * time.Millisecond)
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("not here"))
+			},
+			wantStatus: http.StatusNotFound,
+			wantBytes:  8,
+		},
+		{
+			name:       "nothing written",
+			handler:    func(w http.ResponseWriter, r *http.Request) { time.Sleep(5 * time.Millisecond) },
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			h := AccessLog(tt.handler, slog.New(slog.NewJSONHandler(&logged, nil)))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders?status=pending", nil))
+
+			if n := strings.Count(logged.String(), "\n"); n != 1 {
+				t.Fatalf("%d log entries for a request, want 1", n)
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(logged.Bytes(), &entry); err != nil {
+				t.Fatalf("access log unreadable: %v", err)
+			}
+			if entry["status"] != tt.wantStatus || entry["bytes"] != tt.wantBytes {
+				t.Errorf("logged status %v, bytes %v, want %v, %v", entry["status"], entry["bytes"], tt.wantStatus, tt.wantBytes)
+			}
+			if entry["method"] != http.MethodGet || entry["path"] != "/orders" || entry["query"] != "status=pending" {
+				t.Errorf("logged request %v %v?%v", entry["method"], entry["path"], entry["query"])
+			}
+			if ms, _ := entry["duration_ms"].(float64); ms < 5 {
+				t.Errorf("logged duration_ms = %v, want at least 5", entry["duration_ms"])
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/ab-dauletkhan/hot-coffee/internal/export"
 	"github.com/ab-dauletkhan/hot-coffee/internal/service"
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
@@ -33,174 +35,295 @@ func NewOrderHandler(orderService service.OrderService,
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("CreateOrder called")
+	h.log.InfoContext(r.Context(), "CreateOrder called")
 
 	// Read request body
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 
 	// Unmarshal request body into Order struct
 	var order models.Order
 	if err = json.Unmarshal(data, &order); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling order: %v", err))
 		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
 		return
 	}
 
 	// Validate order
 	if err := order.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("invalid order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid order: %v", err))
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Send order to order service
-	order, err = h.orderService.CreateOrder(&order)
+	order, err = h.orderService.CreateOrder(r.Context(), &order)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error creating order: %v", err))
-		writeError(w, http.StatusInternalServerError, err.Error())
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error creating order: %v", err))
+		switch {
+		case errors.Is(err, service.ErrMenuItemNotFound), errors.Is(err, models.ErrDiscountTooLarge), errors.Is(err, models.ErrCurrencyMismatch),
+			errors.Is(err, models.ErrUnknownUnit), errors.Is(err, models.ErrIncompatibleUnits):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrInsufficientQuantity), errors.Is(err, service.ErrInventoryItemNotFound),
+			errors.Is(err, service.ErrOrderExists):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("order created: %v", order))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("order created: %v", order))
 	writeJSON(w, http.StatusCreated, order)
 }
 
 func (h *OrderHandler) CloseOrder(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("CloseOrder called")
+	h.log.InfoContext(r.Context(), "CloseOrder called")
+	h.changeOrderStatus(w, r, h.orderService.CloseOrder, "closed")
+}
+
+func (h *OrderHandler) StartOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "StartOrder called")
+	h.changeOrderStatus(w, r, h.orderService.StartOrder, "started")
+}
+
+func (h *OrderHandler) MarkOrderReady(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "MarkOrderReady called")
+	h.changeOrderStatus(w, r, h.orderService.MarkOrderReady, "ready")
+}
 
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "CancelOrder called")
+	h.changeOrderStatus(w, r, h.orderService.CancelOrder, "cancelled")
+}
+
+// changeOrderStatus applies a status change to the order in the path
+func (h *OrderHandler) changeOrderStatus(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id string) error, verb string) {
 	id := r.PathValue("id")
-	if err := h.orderService.CloseOrder(id); err != nil {
-		if errors.Is(err, service.ErrOrderNotFound) {
-			h.log.Error(fmt.Sprintf("order not found: %s", id))
+	if err := change(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrOrderNotFound):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("order not found: %s", id))
 			writeError(w, http.StatusNotFound, fmt.Sprintf("order not found: %s", id))
-			return
+		case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrOrderClosed):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("order %s cannot be %s: %v", id, verb, err))
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("error changing order status: %v", err))
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		}
-		h.log.Error(fmt.Sprintf("error closing order: %v", err))
-		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("order closed: %s", id))
-	writeJSON(w, http.StatusOK, response{Data: fmt.Sprintf("order closed: %s", id)})
+	h.log.InfoContext(r.Context(), fmt.Sprintf("order %s: %s", verb, id))
+	writeJSON(w, http.StatusOK, response{Data: fmt.Sprintf("order %s: %s", verb, id)})
 }
 
 func (h *OrderHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetAllOrders called")
+	h.log.InfoContext(r.Context(), "GetAllOrders called")
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid order filter: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	orders, err := h.orderService.GetAllOrders()
+	opts, err := parseListOptions(r, models.OrderSortFields)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting orders: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid list options: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, total, err := h.orderService.ListOrders(r.Context(), filter, opts)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting orders: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("orders retrieved: %v", orders))
-	writeJSON(w, http.StatusOK, orders)
+	h.log.InfoContext(r.Context(), fmt.Sprintf("orders retrieved: %d of %d", len(*orders), total))
+	setTotalCount(w, total)
+	writeTable(w, r, h.log, orders, func() export.Sheet { return ordersSheet(*orders) })
 }
 
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetOrder called")
+	h.log.InfoContext(r.Context(), "GetOrder called")
 
 	id := r.PathValue("id")
-	order, err := h.orderService.GetOrder(id)
+	order, err := h.orderService.GetOrder(r.Context(), id)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error getting order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting order: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
 	if order == nil {
-		h.log.Error(fmt.Sprintf("order not found: %s", id))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("order not found: %s", id))
 		writeError(w, http.StatusNotFound, "Order not found")
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("order retrieved: %v", order))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("order retrieved: %v", order))
 	writeJSON(w, http.StatusOK, order)
 }
 
 func (h *OrderHandler) PutOrder(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("PutOrder called")
+	h.log.InfoContext(r.Context(), "PutOrder called")
 
 	id := r.PathValue("id")
 
 	// Read request body
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error reading request body: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
 		return
 	}
 
 	// Unmarshal request body into Order struct
 	var order models.Order
 	if err = json.Unmarshal(data, &order); err != nil {
-		h.log.Error(fmt.Sprintf("error unmarshalling order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling order: %v", err))
 		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
 		return
 	}
 
+	// The ID may be repeated in the body, but it cannot be changed
+	if order.ID != "" && order.ID != id {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("id mismatch: %s != %s", order.ID, id))
+		writeError(w, http.StatusBadRequest, "ID mismatch")
+		return
+	}
+	order.ID = ""
+
 	// Validate order
 	if err := order.IsValid(); err != nil {
-		h.log.Error(fmt.Sprintf("invalid order: %v", err))
-		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid order: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	// Send order to order service
-	if err := h.orderService.UpdateOrder(id, &order); err != nil {
-		h.log.Error(fmt.Sprintf("error updating order: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	if err := h.orderService.UpdateOrder(r.Context(), id, &order); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error updating order: %v", err))
+		switch {
+		case errors.Is(err, service.ErrOrderNotFound):
+			writeError(w, http.StatusNotFound, fmt.Sprintf("order not found: %s", id))
+		case errors.Is(err, service.ErrOrderClosed), errors.Is(err, service.ErrOrderCancelled):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, service.ErrMenuItemNotFound), errors.Is(err, models.ErrDiscountTooLarge), errors.Is(err, models.ErrCurrencyMismatch),
+			errors.Is(err, models.ErrUnknownUnit), errors.Is(err, models.ErrIncompatibleUnits):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrInsufficientQuantity), errors.Is(err, service.ErrInventoryItemNotFound):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("order updated: %v", order))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("order updated: %v", order))
 	writeJSON(w, http.StatusOK, order)
 }
 
 func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("DeleteOrder called")
+	h.log.InfoContext(r.Context(), "DeleteOrder called")
 
 	id := r.PathValue("id")
-	if err := h.orderService.DeleteOrder(id); err != nil {
-		h.log.Error(fmt.Sprintf("error deleting order: %v", err))
-		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	if err := h.orderService.DeleteOrder(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrOrderNotFound):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("order not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("order not found: %s", id))
+		case errors.Is(err, service.ErrOrderClosed):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("closed order cannot be deleted: %s", id))
+			writeError(w, http.StatusConflict, "closed orders cannot be deleted")
+		default:
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("error deleting order: %v", err))
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
 		return
 	}
 
-	h.log.Info(fmt.Sprintf("order deleted: %s", id))
+	h.log.InfoContext(r.Context(), fmt.Sprintf("order deleted: %s", id))
 	writeJSON(w, http.StatusOK, response{Data: fmt.Sprintf("order deleted: %s", id)})
 }
 
 func (h *OrderHandler) GetTotalSales(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("GetTotalSales called")
+	h.log.InfoContext(r.Context(), "GetTotalSales called")
+
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid report parameters: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	report, err := h.orderService.GetTotalSales()
+	report, err := h.orderService.GetTotalSales(r.Context(), filter)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error deleting order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting total sales: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info("Total Sales: ", report)
-	writeJSON(w, http.StatusOK, report)
+	h.log.InfoContext(r.Context(), fmt.Sprintf("total sales: %v", report))
+	writeTable(w, r, h.log, report, func() export.Sheet { return totalSalesSheet(*report) })
+}
+
+func (h *OrderHandler) GetSales(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetSales called")
+
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid report parameters: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = models.GroupByDay
+	}
+
+	report, err := h.orderService.GetSales(r.Context(), filter, groupBy)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGrouping) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid grouping: %s", groupBy))
+			writeError(w, http.StatusBadRequest, "group_by must be one of: hour, day, week, product, customer")
+			return
+		}
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting sales: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("sales report with %d groups", len(report.Groups)))
+	writeTable(w, r, h.log, report, func() export.Sheet { return salesSheet(*report) })
 }
 
 func (h *OrderHandler) PopularItems(w http.ResponseWriter, r *http.Request) {
-	h.log.Info("PopularItems called")
+	h.log.InfoContext(r.Context(), "PopularItems called")
+
+	filter, err := parseReportFilter(r)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid report parameters: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	report, err := h.orderService.PopularItems()
+	report, err := h.orderService.PopularItems(r.Context(), filter)
 	if err != nil {
-		h.log.Error(fmt.Sprintf("error deleting order: %v", err))
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting popular items: %v", err))
 		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
 
-	h.log.Info("Popular Items: ", report)
-	writeJSON(w, http.StatusOK, report)
+	h.log.InfoContext(r.Context(), fmt.Sprintf("popular items: %v", report))
+	writeTable(w, r, h.log, report, func() export.Sheet { return popularItemsSheet(*report) })
 }
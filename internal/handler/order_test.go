@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// failingOrderService fails every call the handlers make with err
+type failingOrderService struct {
+	service.OrderService
+	err error
+}
+
+func (s failingOrderService) CreateOrder(ctx context.Context, order *models.Order) (models.Order, error) {
+	return models.Order{}, s.err
+}
+
+func (s failingOrderService) CancelOrder(ctx context.Context, id string) error {
+	return s.err
+}
+
+func TestCreateOrderErrors(t *testing.T) {
+	internal := fmt.Errorf("%w: journal.wal: disk full", repository.ErrStorageOperation)
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "short of stock", err: fmt.Errorf("%w: beans", service.ErrInsufficientQuantity), wantStatus: http.StatusConflict, wantBody: "beans"},
+		{name: "unknown product", err: service.ErrMenuItemNotFound, wantStatus: http.StatusBadRequest, wantBody: "menu item not found"},
+		{name: "ID taken", err: service.ErrOrderExists, wantStatus: http.StatusConflict, wantBody: "order already exists"},
+		{name: "storage failure", err: internal, wantStatus: http.StatusInternalServerError, wantBody: "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewOrderHandler(failingOrderService{err: tt.err}, nil, nil, discardLog)
+			body := `{"customer_name":"Ann","items":[{"product_id":"espresso","quantity":1}]}`
+			w := httptest.NewRecorder()
+			h.CreateOrder(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", w.Body, tt.wantBody)
+			}
+			if strings.Contains(w.Body.String(), "journal.wal") {
+				t.Errorf("body leaks the internal error: %s", w.Body)
+			}
+		})
+	}
+}
+
+func TestCancelOrderErrors(t *testing.T) {
+	internal := fmt.Errorf("%w: journal.wal: disk full", repository.ErrStorageOperation)
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "cancelled", wantStatus: http.StatusOK, wantBody: "order cancelled: o1"},
+		{name: "missing", err: service.ErrOrderNotFound, wantStatus: http.StatusNotFound, wantBody: "order not found: o1"},
+		{name: "closed", err: service.ErrOrderClosed, wantStatus: http.StatusConflict, wantBody: service.ErrOrderClosed.Error()},
+		{name: "storage failure", err: internal, wantStatus: http.StatusInternalServerError, wantBody: "Internal Server Error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewOrderHandler(failingOrderService{err: tt.err}, nil, nil, discardLog)
+			r := httptest.NewRequest(http.MethodPost, "/orders/o1/cancel", nil)
+			r.SetPathValue("id", "o1")
+			w := httptest.NewRecorder()
+			h.CancelOrder(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", w.Body, tt.wantBody)
+			}
+			if strings.Contains(w.Body.String(), "journal.wal") {
+				t.Errorf("body leaks the internal error: %s", w.Body)
+			}
+		})
+	}
+}
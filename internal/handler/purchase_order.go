@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// PurchaseOrderHandler handles HTTP requests for purchase orders
+type PurchaseOrderHandler struct {
+	purchaseOrderService service.PurchaseOrderService
+	log                  *slog.Logger
+}
+
+func NewPurchaseOrderHandler(purchaseOrderService service.PurchaseOrderService, log *slog.Logger) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{
+		purchaseOrderService: purchaseOrderService,
+		log:                  log,
+	}
+}
+
+func (h PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "CreatePurchaseOrder called")
+
+	order, ok := h.readPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchaseOrderService.CreatePurchaseOrder(r.Context(), order); err != nil {
+		h.writeServiceError(w, r, "", err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("purchase order created: %s", order.ID))
+	writeJSON(w, http.StatusCreated, order)
+}
+
+func (h PurchaseOrderHandler) GetAllPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetAllPurchaseOrders called")
+
+	orders, err := h.purchaseOrderService.GetAllPurchaseOrders(r.Context())
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting purchase orders: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, orders)
+}
+
+func (h PurchaseOrderHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetPurchaseOrder called")
+
+	id := r.PathValue("id")
+	order, err := h.purchaseOrderService.GetPurchaseOrder(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, id, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, order)
+}
+
+func (h PurchaseOrderHandler) PutPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "PutPurchaseOrder called")
+
+	id := r.PathValue("id")
+	order, ok := h.readPurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.purchaseOrderService.UpdatePurchaseOrder(r.Context(), id, order); err != nil {
+		h.writeServiceError(w, r, id, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("purchase order updated: %s", id))
+	writeJSON(w, http.StatusOK, order)
+}
+
+func (h PurchaseOrderHandler) DeletePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "DeletePurchaseOrder called")
+
+	id := r.PathValue("id")
+	if err := h.purchaseOrderService.DeletePurchaseOrder(r.Context(), id); err != nil {
+		h.writeServiceError(w, r, id, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("purchase order deleted: %s", id))
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+func (h PurchaseOrderHandler) SubmitPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "SubmitPurchaseOrder called")
+	h.changeStatus(w, r, h.purchaseOrderService.SubmitPurchaseOrder, "ordered")
+}
+
+func (h PurchaseOrderHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "ReceivePurchaseOrder called")
+	h.changeStatus(w, r, h.purchaseOrderService.ReceivePurchaseOrder, "received")
+}
+
+func (h PurchaseOrderHandler) CancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "CancelPurchaseOrder called")
+	h.changeStatus(w, r, h.purchaseOrderService.CancelPurchaseOrder, "cancelled")
+}
+
+func (h PurchaseOrderHandler) GenerateDraftPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GenerateDraftPurchaseOrders called")
+
+	orders, err := h.purchaseOrderService.GenerateDraftPurchaseOrders(r.Context())
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error generating purchase orders: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("generated %d draft purchase orders", len(orders)))
+	writeJSON(w, http.StatusCreated, orders)
+}
+
+// changeStatus applies a status change to the purchase order in the path
+func (h PurchaseOrderHandler) changeStatus(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id string) (*models.PurchaseOrder, error), verb string) {
+	id := r.PathValue("id")
+	order, err := change(r.Context(), id)
+	if err != nil {
+		h.writeServiceError(w, r, id, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("purchase order %s: %s", verb, id))
+	writeJSON(w, http.StatusOK, order)
+}
+
+// readPurchaseOrder decodes and validates the purchase order in the request body
+func (h PurchaseOrderHandler) readPurchaseOrder(w http.ResponseWriter, r *http.Request) (*models.PurchaseOrder, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	var order models.PurchaseOrder
+	if err := json.Unmarshal(data, &order); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
+		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return nil, false
+	}
+
+	if id := r.PathValue("id"); id != "" && order.ID == id {
+		order.ID = ""
+	}
+
+	if err := order.IsValid(); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid purchase order: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	return &order, true
+}
+
+// writeServiceError maps a purchase order service error to a response
+func (h PurchaseOrderHandler) writeServiceError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	switch {
+	case errors.Is(err, service.ErrPurchaseOrderNotFound):
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("purchase order not found: %s", id))
+		writeError(w, http.StatusNotFound, fmt.Sprintf("purchase order not found: %s", id))
+	case errors.Is(err, service.ErrSupplierNotFound), errors.Is(err, service.ErrInventoryItemNotFound),
+		errors.Is(err, models.ErrIncompatibleUnits), errors.Is(err, models.ErrUnknownUnit):
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("purchase order refers to unknown data: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidTransition),
+		errors.Is(err, service.ErrPurchaseOrderNotDraft),
+		errors.Is(err, service.ErrSupplierRequired):
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("purchase order %s: %v", id, err))
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("purchase order %s: %v", id, err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
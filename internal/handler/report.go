@@ -1,9 +1,79 @@
 package handler
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-func GetReportsTotalSales(w http.ResponseWriter, r *http.Request) {
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// dateLayout is the layout of a plain date in report parameters
+const dateLayout = "2006-01-02"
+
+// parseReportFilter reads the ?from=, ?to=, ?status= and ?limit= parameters
+// of a report. Dates are either plain dates or RFC 3339 times; a plain to
+// date includes the whole day. status takes a comma separated list.
+func parseReportFilter(r *http.Request) (models.ReportFilter, error) {
+	var filter models.ReportFilter
+	query := r.URL.Query()
+
+	if value := query.Get("from"); value != "" {
+		from, _, err := parseReportTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("from: %w", err)
+		}
+		filter.From = from
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, isDate, err := parseReportTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("to: %w", err)
+		}
+		if isDate {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = to
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	if value := query.Get("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if !models.IsValidOrderStatus(status) {
+				return filter, fmt.Errorf("unknown order status: %s", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
 }
 
-func GetReportsPopularItems(w http.ResponseWriter, r *http.Request) {
+// parseReportTime parses a plain date or an RFC 3339 time and reports which
+// of the two it was
+func parseReportTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(dateLayout, value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected a date (%s) or an RFC 3339 time, got %q", dateLayout, value)
+	}
+	return t, false, nil
 }
@@ -2,7 +2,10 @@ package handler
 
 import "net/http"
 
-func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandler *InventoryHandler) *http.ServeMux {
+func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandler *InventoryHandler,
+	supplierHandler *SupplierHandler, purchaseOrderHandler *PurchaseOrderHandler, userHandler *UserHandler,
+	healthHandler *HealthHandler,
+) *http.ServeMux {
 	// Setup router (using standard net/http for example)
 	mux := http.NewServeMux()
 
@@ -39,6 +42,30 @@ func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandl
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/orders/{id}/start", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			orderHandler.StartOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/orders/{id}/ready", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			orderHandler.MarkOrderReady(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/orders/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			orderHandler.CancelOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	// ================================================
 	// Menu routes
 	// ================================================
@@ -52,6 +79,22 @@ func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandl
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/menu/import", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			menuHandler.ImportMenu(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/menu/available", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			menuHandler.GetAvailableMenuItems(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	mux.HandleFunc("/menu/{id}", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -78,6 +121,22 @@ func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandl
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/inventory/import", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			inventoryHandler.ImportInventory(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/inventory/low-stock", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			inventoryHandler.GetLowStock(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	mux.HandleFunc("/inventory/{id}", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -90,17 +149,202 @@ func Routes(orderHandler *OrderHandler, menuHandler *MenuHandler, inventoryHandl
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/inventory/{id}/movements", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			inventoryHandler.GetInventoryMovements(w, r)
+		case http.MethodPost:
+			inventoryHandler.AddInventoryMovement(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/inventory/{id}/menu-items", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			inventoryHandler.GetInventoryMenuItems(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ================================================
+	// Supplier routes
+	// ================================================
+	mux.HandleFunc("/suppliers", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			supplierHandler.CreateSupplier(w, r)
+		case http.MethodGet:
+			supplierHandler.GetAllSuppliers(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/suppliers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			supplierHandler.GetSupplier(w, r)
+		case http.MethodPut:
+			supplierHandler.PutSupplier(w, r)
+		case http.MethodDelete:
+			supplierHandler.DeleteSupplier(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ================================================
+	// Purchase order routes
+	// ================================================
+	mux.HandleFunc("/purchase-orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			purchaseOrderHandler.CreatePurchaseOrder(w, r)
+		case http.MethodGet:
+			purchaseOrderHandler.GetAllPurchaseOrders(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/purchase-orders/generate", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			purchaseOrderHandler.GenerateDraftPurchaseOrders(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/purchase-orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			purchaseOrderHandler.GetPurchaseOrder(w, r)
+		case http.MethodPut:
+			purchaseOrderHandler.PutPurchaseOrder(w, r)
+		case http.MethodDelete:
+			purchaseOrderHandler.DeletePurchaseOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/purchase-orders/{id}/submit", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			purchaseOrderHandler.SubmitPurchaseOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/purchase-orders/{id}/receive", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			purchaseOrderHandler.ReceivePurchaseOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/purchase-orders/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			purchaseOrderHandler.CancelPurchaseOrder(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ================================================
+	// Report routes
+	// ================================================
 	mux.HandleFunc("/reports/total-sales", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 		orderHandler.GetTotalSales(w, r)
 	})
+	mux.HandleFunc("/reports/sales", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		orderHandler.GetSales(w, r)
+	})
 	mux.HandleFunc("/reports/popular-items", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 		orderHandler.PopularItems(w, r)
 	})
+
+	// ================================================
+	// User routes
+	// ================================================
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			userHandler.CreateUser(w, r)
+		case http.MethodGet:
+			userHandler.GetAllUsers(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/users/me", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userHandler.GetCurrentUser(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			userHandler.GetUser(w, r)
+		case http.MethodPut:
+			userHandler.PutUser(w, r)
+		case http.MethodDelete:
+			userHandler.DeleteUser(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/users/{username}/key", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			userHandler.RotateUserKey(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// ================================================
+	// Health and metrics routes
+	// ================================================
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			healthHandler.GetHealth(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			healthHandler.GetReadiness(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			healthHandler.GetMetrics(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	return mux
 }
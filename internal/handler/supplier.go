@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// SupplierHandler handles HTTP requests for suppliers
+type SupplierHandler struct {
+	supplierService service.SupplierService
+	log             *slog.Logger
+}
+
+func NewSupplierHandler(supplierService service.SupplierService, log *slog.Logger) *SupplierHandler {
+	return &SupplierHandler{
+		supplierService: supplierService,
+		log:             log,
+	}
+}
+
+func (h SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "CreateSupplier called")
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var supplier models.Supplier
+	if err := json.Unmarshal(data, &supplier); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
+		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err := supplier.IsValid(); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid supplier: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.supplierService.CreateSupplier(r.Context(), &supplier); err != nil {
+		if errors.Is(err, service.ErrSupplierExists) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("supplier already exists: %s", supplier.ID))
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error creating supplier: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("supplier created: %s", supplier.ID))
+	writeJSON(w, http.StatusCreated, supplier)
+}
+
+func (h SupplierHandler) GetAllSuppliers(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetAllSuppliers called")
+
+	suppliers, err := h.supplierService.GetAllSuppliers(r.Context())
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting suppliers: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, suppliers)
+}
+
+func (h SupplierHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetSupplier called")
+
+	id := r.PathValue("id")
+	supplier, err := h.supplierService.GetSupplier(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrSupplierNotFound) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("supplier not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("supplier not found: %s", id))
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting supplier: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, supplier)
+}
+
+func (h SupplierHandler) PutSupplier(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "PutSupplier called")
+
+	id := r.PathValue("id")
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
+		return
+	}
+	defer r.Body.Close()
+
+	var supplier models.Supplier
+	if err := json.Unmarshal(data, &supplier); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
+		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err := supplier.IsValid(); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid supplier: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id != supplier.ID {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("ID mismatch: have (%s), want (%s)", supplier.ID, id))
+		writeError(w, http.StatusBadRequest, "ID mismatch in request body and URL")
+		return
+	}
+
+	if err := h.supplierService.UpdateSupplier(r.Context(), id, &supplier); err != nil {
+		if errors.Is(err, service.ErrSupplierNotFound) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("supplier not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("supplier not found: %s", id))
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error updating supplier: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("supplier updated: %s", id))
+	writeJSON(w, http.StatusOK, supplier)
+}
+
+func (h SupplierHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "DeleteSupplier called")
+
+	id := r.PathValue("id")
+	if err := h.supplierService.DeleteSupplier(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, service.ErrSupplierNotFound):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("supplier not found: %s", id))
+			writeError(w, http.StatusNotFound, fmt.Sprintf("supplier not found: %s", id))
+		case errors.Is(err, service.ErrSupplierInUse):
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("supplier in use: %v", err))
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("error deleting supplier: %v", err))
+			writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("supplier deleted: %s", id))
+	writeJSON(w, http.StatusNoContent, nil)
+}
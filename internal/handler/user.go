@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/service"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// UserHandler handles HTTP requests for API users
+type UserHandler struct {
+	userService service.UserService
+	log         *slog.Logger
+}
+
+func NewUserHandler(userService service.UserService, log *slog.Logger) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		log:         log,
+	}
+}
+
+func (h UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "CreateUser called")
+
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.userService.CreateUser(r.Context(), &user)
+	if err != nil {
+		if errors.Is(err, service.ErrUserExists) {
+			h.log.ErrorContext(r.Context(), fmt.Sprintf("user already exists: %s", user.Username))
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error creating user: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("user created: %s (%s)", user.Username, user.Role))
+	writeJSON(w, http.StatusCreated, models.UserKey{User: user, APIKey: key})
+}
+
+func (h UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetAllUsers called")
+
+	users, err := h.userService.GetAllUsers(r.Context())
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error getting users: %v", err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("got %d users", len(*users)))
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (h UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetUser called")
+
+	username := r.PathValue("username")
+
+	user, err := h.userService.GetUser(r.Context(), username)
+	if err != nil {
+		h.writeServiceError(w, r, username, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// GetCurrentUser returns the user the request was authenticated as
+func (h UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "GetCurrentUser called")
+
+	user, ok := currentUser(r.Context())
+	if !ok {
+		writeError(w, http.StatusNotFound, "authentication is disabled")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h UserHandler) PutUser(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "PutUser called")
+
+	username := r.PathValue("username")
+
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.Username != username {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("username mismatch: have (%s), want (%s)", user.Username, username))
+		writeError(w, http.StatusBadRequest, "username mismatch in request body and URL")
+		return
+	}
+
+	if err := h.userService.UpdateUser(r.Context(), username, &user); err != nil {
+		h.writeServiceError(w, r, username, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("user updated: %s (%s)", user.Username, user.Role))
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "DeleteUser called")
+
+	username := r.PathValue("username")
+
+	if err := h.userService.DeleteUser(r.Context(), username); err != nil {
+		h.writeServiceError(w, r, username, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("user deleted: %s", username))
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// RotateUserKey issues a new API key for the user
+func (h UserHandler) RotateUserKey(w http.ResponseWriter, r *http.Request) {
+	h.log.InfoContext(r.Context(), "RotateUserKey called")
+
+	username := r.PathValue("username")
+
+	key, err := h.userService.RotateKey(r.Context(), username)
+	if err != nil {
+		h.writeServiceError(w, r, username, err)
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), username)
+	if err != nil {
+		h.writeServiceError(w, r, username, err)
+		return
+	}
+
+	h.log.InfoContext(r.Context(), fmt.Sprintf("API key rotated: %s", username))
+	writeJSON(w, http.StatusOK, models.UserKey{User: *user, APIKey: key})
+}
+
+// readUser decodes and validates the user in the request body
+func (h UserHandler) readUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error reading request body: %v", err))
+		writeBodyError(w, err)
+		return user, false
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(data, &user); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error unmarshalling request body: %v", err))
+		writeError(w, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+		return user, false
+	}
+
+	if err := user.IsValid(); err != nil {
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("invalid user: %v", err))
+		writeError(w, http.StatusBadRequest, err.Error())
+		return user, false
+	}
+
+	return user, true
+}
+
+func (h UserHandler) writeServiceError(w http.ResponseWriter, r *http.Request, username string, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("user not found: %s", username))
+		writeError(w, http.StatusNotFound, fmt.Sprintf("user not found: %s", username))
+	case errors.Is(err, service.ErrLastAdmin):
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("refused to remove the last admin: %s", username))
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.log.ErrorContext(r.Context(), fmt.Sprintf("error handling user %s: %v", username, err))
+		writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
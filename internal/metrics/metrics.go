@@ -0,0 +1,246 @@
+// Package metrics keeps counters and histograms of the running server and
+// writes them in the Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metric families and writes them out
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+// family is a metric with all its label combinations
+type family interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter adds a counter family with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name: name, help: help, labels: labels}, values: make(map[string]*counter)}
+	r.add(c)
+	return c
+}
+
+// Histogram adds a histogram family with the given bucket upper bounds and
+// label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name: name, help: help, labels: labels}, buckets: buckets, values: make(map[string]*histogram)}
+	r.add(h)
+	return h
+}
+
+func (r *Registry) add(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteText writes every family in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]family, len(r.families))
+	copy(families, r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// desc describes a family
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.ReplaceAll(d.help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, kind)
+}
+
+// key joins label values into a map key
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// pairs formats the label set of key, with extra pairs appended
+func (d desc) pairs(key string, extra ...string) string {
+	var values []string
+	if len(d.labels) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+
+	parts := make([]string, 0, len(d.labels)+len(extra)/2)
+	for i, label := range d.labels {
+		parts = append(parts, fmt.Sprintf("%s=%q", label, escape(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escape prepares a label value for %q, which then escapes backslashes and
+// quotes the way the text format expects. Only newlines need mapping first,
+// as %q would turn other control characters into escapes Prometheus does not
+// read.
+func escape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\n' {
+			return ' '
+		}
+		return r
+	}, value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order, so output is stable
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter per combination of label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counter
+}
+
+type counter struct {
+	value float64
+}
+
+// Inc adds one to the counter with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given
+// label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ct, ok := c.values[key]
+	if !ok {
+		ct = &counter{}
+		c.values[key] = ct
+	}
+	ct.value += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A counter without labels is shown from the start
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.pairs(key), formatFloat(c.values[key].value))
+	}
+}
+
+// HistogramVec is a histogram per combination of label values
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records v in the histogram with the given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hg, ok := h.values[key]
+	if !ok {
+		hg = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hg
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hg.counts[i]++
+			break
+		}
+	}
+	hg.count++
+	hg.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.values) {
+		hg := h.values[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hg.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.pairs(key, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.pairs(key, "le", "+Inf"), hg.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.pairs(key), formatFloat(hg.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.pairs(key), hg.count)
+	}
+}
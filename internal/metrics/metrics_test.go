@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	plain := r.Counter("test_plain_total", "A counter\nwithout labels.")
+	requests := r.Counter("test_requests_total", "Requests.", "route", "status")
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc("/a", "500")
+	requests.Inc(`say "hi"\`+"\n\tnow", "200")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+
+	want := `# HELP test_plain_total A counter without labels.
+# TYPE test_plain_total counter
+test_plain_total 0
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="500"} 3
+test_requests_total{route="/b",status="200"} 1
+test_requests_total{route="say \"hi\"\\\n now",status="200"} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 2
+test_latency_seconds_bucket{route="/a",le="1"} 3
+test_latency_seconds_bucket{route="/a",le="+Inf"} 4
+test_latency_seconds_sum{route="/a"} 3.65
+test_latency_seconds_count{route="/a"} 4
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+
+	plain.Inc()
+	b.Reset()
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), "\ntest_plain_total 1\n") {
+		t.Errorf("counter not increased:\n%s", b.String())
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	c := NewRegistry().Counter("test_total", "Test.", "route")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with a missing label value did not panic")
+		}
+	}()
+	c.Inc()
+}
@@ -0,0 +1,23 @@
+package metrics
+
+// Default holds the metrics of the server, served on /metrics
+var Default = NewRegistry()
+
+var (
+	HTTPRequests = Default.Counter("hotcoffee_http_requests_total",
+		"HTTP requests answered, by route pattern, method and status code.",
+		"route", "method", "status")
+	HTTPRequestDuration = Default.Histogram("hotcoffee_http_request_duration_seconds",
+		"Time taken to answer HTTP requests, by route pattern and method.",
+		DefaultBuckets, "route", "method")
+
+	OrdersCreated = Default.Counter("hotcoffee_orders_created_total",
+		"Orders created.")
+
+	StorageWrites = Default.Counter("hotcoffee_storage_writes_total",
+		"Collections written to storage, by storage file; the inventory file counts inventory writes.",
+		"storage")
+	StorageErrors = Default.Counter("hotcoffee_storage_errors_total",
+		"Failed storage operations, by storage and operation.",
+		"storage", "operation")
+)
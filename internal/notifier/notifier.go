@@ -0,0 +1,109 @@
+// Package notifier delivers low-stock alerts to the log, a webhook or a file
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// LogNotifier writes alerts to the application log
+type LogNotifier struct {
+	log *slog.Logger
+}
+
+func NewLogNotifier(log *slog.Logger) *LogNotifier {
+	return &LogNotifier{log: log}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, alert models.StockAlert) error {
+	n.log.WarnContext(ctx, "low stock",
+		"ingredient_id", alert.IngredientID,
+		"name", alert.Name,
+		"quantity", alert.Quantity,
+		"unit", alert.Unit,
+		"reorder_threshold", alert.ReorderThreshold,
+		"reorder_quantity", alert.ReorderQuantity)
+	return nil
+}
+
+// WebhookNotifier posts every alert as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert models.StockAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("JSON marshal failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// FileNotifier appends every alert as a JSON line to a file
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	if err := os.MkdirAll(filepath.Dir(path), core.DirPerm); err != nil {
+		return nil, fmt.Errorf("directory creation failed: %w", err)
+	}
+	return &FileNotifier{path: path}, nil
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, alert models.StockAlert) error {
+	line, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("JSON marshal failed: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, core.FilePerm)
+	if err != nil {
+		return fmt.Errorf("alert file open failed: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("alert file write failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+var alert = models.StockAlert{
+	IngredientID:     "beans",
+	Name:             "Beans",
+	Quantity:         80,
+	Unit:             "g",
+	ReorderThreshold: 100,
+	ReorderQuantity:  1000,
+	RaisedAt:         "2024-01-01T00:00:00Z",
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := NewLogNotifier(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	if err := n.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	for _, want := range []string{"level=WARN", "low stock", "ingredient_id=beans", "quantity=80", "reorder_threshold=100"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log = %q, want it to contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "delivered", status: http.StatusOK},
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got models.StockAlert
+			var contentType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("webhook body: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := NewWebhookNotifier(server.URL).Notify(context.Background(), alert)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != alert || contentType != "application/json" {
+				t.Errorf("webhook received %+v as %q, want %+v as JSON", got, contentType, alert)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	if err := NewWebhookNotifier(url).Notify(context.Background(), alert); err == nil {
+		t.Error("Notify() error = nil for an unreachable webhook")
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts", "low_stock_alerts.log")
+	n, err := NewFileNotifier(path)
+	if err != nil {
+		t.Fatalf("NewFileNotifier() error = %v", err)
+	}
+
+	second := alert
+	second.IngredientID = "milk"
+	for _, a := range []models.StockAlert{alert, second} {
+		if err := n.Notify(context.Background(), a); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("alert file: %v", err)
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line models.StockAlert
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("alert line %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, line.IngredientID)
+	}
+	if strings.Join(ids, ",") != "beans,milk" {
+		t.Errorf("alerts in file = %v, want [beans milk]", ids)
+	}
+}
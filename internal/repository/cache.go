@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrRecordExists is returned when a record is created under an ID that is
+// already taken
+var ErrRecordExists = errors.New("record already exists")
+
+// ErrRecordNotFound is returned when a record that does not exist is updated
+var ErrRecordNotFound = errors.New("record not found")
+
+// records is a collection indexed by record ID
+type records[T any] struct {
+	key   func(T) string
+	items []T
+	index map[string]int
+}
+
+func newRecords[T any](key func(T) string, items []T) *records[T] {
+	rs := &records[T]{
+		key:   key,
+		items: items,
+		index: make(map[string]int, len(items)),
+	}
+	for i, item := range items {
+		rs.index[key(item)] = i
+	}
+	return rs
+}
+
+// get returns a copy of the record with the given ID
+func (rs *records[T]) get(id string) (*T, bool) {
+	i, ok := rs.index[id]
+	if !ok {
+		return nil, false
+	}
+	item := rs.items[i]
+	return &item, true
+}
+
+// all returns a copy of every record
+func (rs *records[T]) all() []T {
+	items := make([]T, len(rs.items))
+	copy(items, rs.items)
+	return items
+}
+
+// query selects, orders and pages records
+type query[T any] struct {
+	match  func(item *T) bool // nil matches every record
+	less   func(a, b *T) bool // nil keeps the storage order
+	offset int
+	limit  int // 0 means no limit
+}
+
+// list returns copies of the records on the page q selects, along with the
+// number of records that match before paging. Only matching records are
+// copied.
+func (rs *records[T]) list(q query[T]) ([]T, int) {
+	items := []T{}
+	for i := range rs.items {
+		if q.match == nil || q.match(&rs.items[i]) {
+			items = append(items, rs.items[i])
+		}
+	}
+	total := len(items)
+
+	if q.less != nil {
+		sort.SliceStable(items, func(i, j int) bool { return q.less(&items[i], &items[j]) })
+	}
+
+	if q.offset >= len(items) {
+		return []T{}, total
+	}
+	items = items[q.offset:]
+	if q.limit > 0 && len(items) > q.limit {
+		items = items[:q.limit]
+	}
+	return items, total
+}
+
+// clone returns a copy that can be changed without affecting rs
+func (rs *records[T]) clone() *records[T] {
+	index := make(map[string]int, len(rs.index))
+	for id, i := range rs.index {
+		index[id] = i
+	}
+	return &records[T]{key: rs.key, items: rs.all(), index: index}
+}
+
+// put replaces the record with the same ID or appends a new one
+func (rs *records[T]) put(item T) {
+	id := rs.key(item)
+	if i, ok := rs.index[id]; ok {
+		rs.items[i] = item
+		return
+	}
+	rs.index[id] = len(rs.items)
+	rs.items = append(rs.items, item)
+}
+
+// add appends a new record. Unlike put, it never replaces a record with the
+// same ID.
+func (rs *records[T]) add(item T) error {
+	id := rs.key(item)
+	if _, ok := rs.index[id]; ok {
+		return fmt.Errorf("%w: %s", ErrRecordExists, id)
+	}
+	rs.put(item)
+	return nil
+}
+
+// update replaces the record with the same ID. Unlike put, it never adds a
+// record that is not there.
+func (rs *records[T]) update(item T) error {
+	id := rs.key(item)
+	i, ok := rs.index[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRecordNotFound, id)
+	}
+	rs.items[i] = item
+	return nil
+}
+
+// remove deletes the record by swapping it with the last one, in O(1)
+func (rs *records[T]) remove(id string) bool {
+	i, ok := rs.index[id]
+	if !ok {
+		return false
+	}
+
+	last := len(rs.items) - 1
+	if i != last {
+		rs.items[i] = rs.items[last]
+		rs.index[rs.key(rs.items[i])] = i
+	}
+	rs.items = rs.items[:last]
+	delete(rs.index, id)
+	return true
+}
+
+func (rs *records[T]) MarshalJSON() ([]byte, error) {
+	if rs.items == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(rs.items)
+}
+
+// elements lets a storage encode the records one at a time
+func (rs *records[T]) elements() any {
+	return rs.items
+}
+
+// collection is how repositories read and change the records of a storage.
+// Records handed out are copies, but nested slices are shared with the
+// cache: replace them, never modify them in place. Nothing is read or
+// written once the context is done.
+type collection[T any] interface {
+	get(ctx context.Context, id string) (*T, error)
+	all(ctx context.Context) ([]T, error)
+	list(ctx context.Context, q query[T]) ([]T, int, error)
+	mutate(ctx context.Context, fn func(rs *records[T]) error) error
+	withTx(tx *Tx) collection[T]
+}
+
+// table caches the records of a storage in memory, indexed by ID. Reads are
+// served from memory; writes go through to the storage. The storage stamp
+// is checked on every access, so changes made to the underlying files by
+// hand are picked up.
+type table[T any] struct {
+	storage Storage
+	key     func(T) string
+	mu      sync.RWMutex
+	data    *records[T]
+	stamp   string
+}
+
+func newTable[T any](storage Storage, key func(T) string) *table[T] {
+	return &table[T]{storage: storage, key: key}
+}
+
+// load makes sure the cache matches the storage
+func (t *table[T]) load(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stamp, err := t.storage.Stamp()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	t.mu.RLock()
+	fresh := t.data != nil && t.stamp == stamp
+	t.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reload(stamp)
+}
+
+// reload reads the storage into the cache. The caller must hold t.mu.
+func (t *table[T]) reload(stamp string) error {
+	if t.data != nil && t.stamp == stamp {
+		return nil
+	}
+
+	var items []T
+	if err := t.storage.Retrieve(&items); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	t.data = newRecords(t.key, items)
+	t.stamp = stamp
+	return nil
+}
+
+func (t *table[T]) get(ctx context.Context, id string) (*T, error) {
+	if err := t.load(ctx); err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	item, _ := t.data.get(id)
+	return item, nil
+}
+
+func (t *table[T]) all(ctx context.Context) ([]T, error) {
+	if err := t.load(ctx); err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.data.all(), nil
+}
+
+func (t *table[T]) list(ctx context.Context, q query[T]) ([]T, int, error) {
+	if err := t.load(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	items, total := t.data.list(q)
+	return items, total, nil
+}
+
+// mutate applies fn to a copy of the records and writes the result through
+// to the storage. The cache only changes once the write succeeded.
+func (t *table[T]) mutate(ctx context.Context, fn func(rs *records[T]) error) error {
+	stamp, err := t.storage.Stamp()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.reload(stamp); err != nil {
+		return err
+	}
+
+	next := t.data.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	// A request given up on leaves the storage as it was
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := t.storage.Save(next); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	t.replace(next)
+	return nil
+}
+
+// replace installs records that have just been written to the storage.
+// The caller must hold t.mu.
+func (t *table[T]) replace(rs *records[T]) {
+	t.data = rs
+	if stamp, err := t.storage.Stamp(); err == nil {
+		t.stamp = stamp
+	} else {
+		t.stamp = "" // force a reload on next access
+	}
+}
+
+func (t *table[T]) withTx(tx *Tx) collection[T] {
+	return &txTable[T]{base: t, tx: tx}
+}
+
+// txTable is a table as seen from inside a transaction. It reads the
+// shared cache until the transaction changes the collection, and from then
+// on works on the transaction's own copy.
+type txTable[T any] struct {
+	base *table[T]
+	tx   *Tx
+}
+
+// working returns the transaction's copy of the records, if it made one
+func (v *txTable[T]) working() (*records[T], bool) {
+	if rs, ok := v.tx.state[v.base.storage]; ok {
+		return rs.(*records[T]), true
+	}
+	return nil, false
+}
+
+func (v *txTable[T]) get(ctx context.Context, id string) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if rs, ok := v.working(); ok {
+		item, _ := rs.get(id)
+		return item, nil
+	}
+	return v.base.get(ctx, id)
+}
+
+func (v *txTable[T]) all(ctx context.Context) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if rs, ok := v.working(); ok {
+		return rs.all(), nil
+	}
+	return v.base.all(ctx)
+}
+
+func (v *txTable[T]) list(ctx context.Context, q query[T]) ([]T, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	if rs, ok := v.working(); ok {
+		items, total := rs.list(q)
+		return items, total, nil
+	}
+	return v.base.list(ctx, q)
+}
+
+func (v *txTable[T]) mutate(ctx context.Context, fn func(rs *records[T]) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	current, ok := v.working()
+	if !ok {
+		if err := v.base.load(ctx); err != nil {
+			return err
+		}
+		v.base.mu.RLock()
+		current = v.base.data
+		v.base.mu.RUnlock()
+	}
+
+	next := current.clone()
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	v.tx.state[v.base.storage] = next
+	v.tx.stage(v.base.storage, next, func() {
+		v.base.mu.Lock()
+		defer v.base.mu.Unlock()
+		v.base.replace(next)
+	})
+	return nil
+}
+
+func (v *txTable[T]) withTx(tx *Tx) collection[T] {
+	return v.base.withTx(tx)
+}
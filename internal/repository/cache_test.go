@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestRecords(t *testing.T) {
+	suppliers := func(ids ...string) []models.Supplier {
+		items := make([]models.Supplier, len(ids))
+		for i, id := range ids {
+			items[i] = models.Supplier{ID: id}
+		}
+		return items
+	}
+
+	tests := []struct {
+		name   string
+		items  []string
+		change func(rs *records[models.Supplier])
+		want   []string
+	}{
+		{name: "put appends", items: []string{"a"}, change: func(rs *records[models.Supplier]) { rs.put(models.Supplier{ID: "b"}) }, want: []string{"a", "b"}},
+		{name: "put replaces in place", items: []string{"a", "b"}, change: func(rs *records[models.Supplier]) { rs.put(models.Supplier{ID: "a", Name: "A"}) }, want: []string{"a", "b"}},
+		{name: "remove last", items: []string{"a", "b"}, change: func(rs *records[models.Supplier]) { rs.remove("b") }, want: []string{"a"}},
+		{name: "remove swaps in the last record", items: []string{"a", "b", "c"}, change: func(rs *records[models.Supplier]) { rs.remove("a") }, want: []string{"c", "b"}},
+		{name: "remove missing", items: []string{"a"}, change: func(rs *records[models.Supplier]) { rs.remove("x") }, want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newRecords(supplierKey, suppliers(tt.items...))
+			tt.change(rs)
+
+			got := make([]string, len(rs.items))
+			for i, item := range rs.items {
+				got[i] = item.ID
+				// The index has to follow every move
+				if j := rs.index[item.ID]; j != i {
+					t.Errorf("index[%s] = %d, want %d", item.ID, j, i)
+				}
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if len(rs.index) != len(rs.items) {
+				t.Errorf("index has %d entries for %d records", len(rs.index), len(rs.items))
+			}
+		})
+	}
+}
+
+func TestRecordsAddUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(rs *records[models.Supplier]) error
+		wantErr  error
+		wantName string // of supplier a afterwards
+		wantLen  int
+	}{
+		{name: "add new", change: func(rs *records[models.Supplier]) error { return rs.add(models.Supplier{ID: "b"}) }, wantName: "old", wantLen: 2},
+		{name: "add existing", change: func(rs *records[models.Supplier]) error { return rs.add(models.Supplier{ID: "a", Name: "new"}) }, wantErr: ErrRecordExists, wantName: "old", wantLen: 1},
+		{name: "update existing", change: func(rs *records[models.Supplier]) error { return rs.update(models.Supplier{ID: "a", Name: "new"}) }, wantName: "new", wantLen: 1},
+		{name: "update missing", change: func(rs *records[models.Supplier]) error { return rs.update(models.Supplier{ID: "b"}) }, wantErr: ErrRecordNotFound, wantName: "old", wantLen: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newRecords(supplierKey, []models.Supplier{{ID: "a", Name: "old"}})
+			if err := tt.change(rs); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got, _ := rs.get("a"); got.Name != tt.wantName {
+				t.Errorf("supplier a = %+v, want name %q", got, tt.wantName)
+			}
+			if len(rs.items) != tt.wantLen || len(rs.index) != tt.wantLen {
+				t.Errorf("%d records, %d indexed, want %d", len(rs.items), len(rs.index), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestRecordsList(t *testing.T) {
+	rs := newRecords(supplierKey, []models.Supplier{{ID: "c"}, {ID: "a"}, {ID: "d"}, {ID: "b"}})
+	byID := func(a, b *models.Supplier) bool { return a.ID < b.ID }
+	notD := func(s *models.Supplier) bool { return s.ID != "d" }
+
+	tests := []struct {
+		name      string
+		q         query[models.Supplier]
+		want      []string
+		wantTotal int
+	}{
+		{name: "everything", want: []string{"c", "a", "d", "b"}, wantTotal: 4},
+		{name: "sorted", q: query[models.Supplier]{less: byID}, want: []string{"a", "b", "c", "d"}, wantTotal: 4},
+		{name: "matched", q: query[models.Supplier]{match: notD}, want: []string{"c", "a", "b"}, wantTotal: 3},
+		{name: "page", q: query[models.Supplier]{less: byID, offset: 1, limit: 2}, want: []string{"b", "c"}, wantTotal: 4},
+		{name: "past the end", q: query[models.Supplier]{offset: 10}, want: []string{}, wantTotal: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total := rs.list(tt.q)
+			got := make([]string, len(items))
+			for i, item := range items {
+				got[i] = item.ID
+			}
+			if !equalIDs(got, tt.want) || total != tt.wantTotal {
+				t.Errorf("list() = %v, %d, want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestTableMutate(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		fnErr    error
+		saveFail bool
+		wantErr  error
+		want     []string // in the cache and the storage afterwards
+	}{
+		{name: "written", ctx: context.Background(), want: []string{"a", "b"}},
+		{name: "fn fails", ctx: context.Background(), fnErr: errSaveFailed, wantErr: errSaveFailed, want: []string{"a"}},
+		{name: "save fails", ctx: context.Background(), saveFail: true, wantErr: ErrStorageOperation, want: []string{"a"}},
+		{name: "context done", ctx: cancelled, wantErr: context.Canceled, want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &flakyStorage{MemoryStorage: NewMemoryStorage(core.SupplierFile)}
+			table := newTable(Storage(storage), supplierKey)
+			if err := addSupplier(context.Background(), table, "a"); err != nil {
+				t.Fatalf("addSupplier() error = %v", err)
+			}
+
+			storage.fail = tt.saveFail
+			err := table.mutate(tt.ctx, func(rs *records[models.Supplier]) error {
+				rs.put(models.Supplier{ID: "b"})
+				return tt.fnErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("mutate() error = %v, want %v", err, tt.wantErr)
+			}
+
+			all, _ := table.all(context.Background())
+			got := make([]string, len(all))
+			for i, item := range all {
+				got[i] = item.ID
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("cache = %v, want %v", got, tt.want)
+			}
+			if got := storedIDs(t, storage); !equalIDs(got, tt.want) {
+				t.Errorf("storage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableReloadsChangedStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage(core.SupplierFile)
+	table := newTable(Storage(storage), supplierKey)
+	if err := addSupplier(ctx, table, "a"); err != nil {
+		t.Fatalf("addSupplier() error = %v", err)
+	}
+
+	// A write that bypasses the table changes the stamp
+	if err := storage.Save([]models.Supplier{{ID: "x"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if got, _ := table.get(ctx, "a"); got != nil {
+		t.Errorf("get(a) = %+v after the storage changed", got)
+	}
+	if got, _ := table.get(ctx, "x"); got == nil {
+		t.Error("get(x) = nil, want the record written to the storage")
+	}
+}
+
+func TestTableCopies(t *testing.T) {
+	ctx := context.Background()
+	table := newTable(Storage(NewMemoryStorage(core.SupplierFile)), supplierKey)
+	if err := addSupplier(ctx, table, "a"); err != nil {
+		t.Fatalf("addSupplier() error = %v", err)
+	}
+
+	got, _ := table.get(ctx, "a")
+	got.Name = "changed"
+	all, _ := table.all(ctx)
+	all[0].Name = "changed"
+
+	if again, _ := table.get(ctx, "a"); again.Name != "a" {
+		t.Errorf("cached record changed through a copy: %+v", again)
+	}
+}
+
+func TestTxTableIsolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		fnErr   error
+		wantErr bool
+		want    []string // seen outside the transaction afterwards
+	}{
+		{name: "committed", want: []string{"a", "b"}},
+		{name: "discarded", fnErr: errSaveFailed, wantErr: true, want: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := NewMemoryStorage(core.SupplierFile)
+			journal, err := NewJournal("", discardLog, storage)
+			if err != nil {
+				t.Fatalf("NewJournal() error = %v", err)
+			}
+			table := newTable(Storage(storage), supplierKey)
+			if err := addSupplier(ctx, table, "a"); err != nil {
+				t.Fatalf("addSupplier() error = %v", err)
+			}
+
+			err = journal.Atomically(ctx, func(tx *Tx) error {
+				inside := table.withTx(tx)
+				if err := addSupplier(ctx, inside, "b"); err != nil {
+					return err
+				}
+
+				// The transaction sees its own change, nobody else does yet
+				if got, _ := inside.get(ctx, "b"); got == nil {
+					t.Error("transaction does not see its own change")
+				}
+				if got, _ := table.get(ctx, "b"); got != nil {
+					t.Error("change visible outside the transaction before commit")
+				}
+				if got := storedIDs(t, storage); !equalIDs(got, []string{"a"}) {
+					t.Errorf("storage = %v before commit, want [a]", got)
+				}
+				return tt.fnErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Atomically() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			all, _ := table.all(ctx)
+			got := make([]string, len(all))
+			for i, item := range all {
+				got[i] = item.ID
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("cache = %v, want %v", got, tt.want)
+			}
+			if got := storedIDs(t, storage); !equalIDs(got, tt.want) {
+				t.Errorf("storage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
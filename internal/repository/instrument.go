@@ -0,0 +1,58 @@
+package repository
+
+import "github.com/ab-dauletkhan/hot-coffee/internal/metrics"
+
+// instrumentedStorage counts the writes and failures of a storage
+type instrumentedStorage struct {
+	Storage
+}
+
+func instrument(storage Storage) Storage {
+	return instrumentedStorage{storage}
+}
+
+func (s instrumentedStorage) Retrieve(v interface{}) error {
+	return s.observe("retrieve", s.Storage.Retrieve(v))
+}
+
+func (s instrumentedStorage) Save(v interface{}) error {
+	if err := s.Storage.Save(v); err != nil {
+		return s.observe("save", err)
+	}
+	metrics.StorageWrites.Inc(s.Name())
+	return nil
+}
+
+func (s instrumentedStorage) Stamp() (string, error) {
+	stamp, err := s.Storage.Stamp()
+	return stamp, s.observe("stamp", err)
+}
+
+func (s instrumentedStorage) Validate() error {
+	return s.observe("validate", s.Storage.Validate())
+}
+
+func (s instrumentedStorage) observe(operation string, err error) error {
+	if err != nil {
+		metrics.StorageErrors.Inc(s.Name(), operation)
+	}
+	return err
+}
+
+// instrumentedAppender counts the appends of an append-only storage as well
+type instrumentedAppender struct {
+	instrumentedStorage
+	appender Appender
+}
+
+func instrumentAppender(storage Appender) Appender {
+	return instrumentedAppender{instrumentedStorage{storage}, storage}
+}
+
+func (s instrumentedAppender) Append(v interface{}) error {
+	if err := s.appender.Append(v); err != nil {
+		return s.observe("append", err)
+	}
+	metrics.StorageWrites.Inc(s.Name())
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/internal/metrics"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// brokenStorage is a memory storage on which every operation fails while
+// fail is set
+type brokenStorage struct {
+	*MemoryStorage
+	fail bool
+}
+
+func (s *brokenStorage) Retrieve(v interface{}) error {
+	if s.fail {
+		return errSaveFailed
+	}
+	return s.MemoryStorage.Retrieve(v)
+}
+
+func (s *brokenStorage) Save(v interface{}) error {
+	if s.fail {
+		return errSaveFailed
+	}
+	return s.MemoryStorage.Save(v)
+}
+
+func (s *brokenStorage) Append(v interface{}) error {
+	if s.fail {
+		return errSaveFailed
+	}
+	return s.MemoryStorage.Append(v)
+}
+
+func (s *brokenStorage) Stamp() (string, error) {
+	if s.fail {
+		return "", errSaveFailed
+	}
+	return s.MemoryStorage.Stamp()
+}
+
+func (s *brokenStorage) Validate() error {
+	if s.fail {
+		return errSaveFailed
+	}
+	return s.MemoryStorage.Validate()
+}
+
+// sample returns the value of the metric line starting with prefix, 0 if
+// there is none
+func sample(t *testing.T, prefix string) float64 {
+	t.Helper()
+
+	var b strings.Builder
+	if err := metrics.Default.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(b.String()))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), prefix+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("sample %s = %q", prefix, value)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestInstrumentedStorage(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      bool
+		op        func(s Appender) error
+		wantWrite float64
+		wantError string // operation counted as failed
+	}{
+		{name: "save", op: func(s Appender) error { return s.Save([]models.Supplier{{ID: "a"}}) }, wantWrite: 1},
+		{name: "append", op: func(s Appender) error { return s.Append([]models.Supplier{{ID: "a"}}) }, wantWrite: 1},
+		{name: "retrieve", op: func(s Appender) error { var v []models.Supplier; return s.Retrieve(&v) }},
+		{name: "failed save", fail: true, op: func(s Appender) error { return s.Save([]models.Supplier{}) }, wantError: "save"},
+		{name: "failed append", fail: true, op: func(s Appender) error { return s.Append([]models.Supplier{}) }, wantError: "append"},
+		{name: "failed retrieve", fail: true, op: func(s Appender) error { var v []models.Supplier; return s.Retrieve(&v) }, wantError: "retrieve"},
+		{name: "failed stamp", fail: true, op: func(s Appender) error { _, err := s.Stamp(); return err }, wantError: "stamp"},
+		{name: "failed validate", fail: true, op: func(s Appender) error { return s.Validate() }, wantError: "validate"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The registry is shared, so every case counts under its own name
+			// and only what it adds
+			name := "instrument-" + strconv.Itoa(i) + ".json"
+			storage := instrumentAppender(&brokenStorage{MemoryStorage: NewMemoryStorage(name), fail: tt.fail})
+
+			operations := []string{"retrieve", "save", "append", "stamp", "validate"}
+			writes := `hotcoffee_storage_writes_total{storage="` + name + `"}`
+			errorsBefore := make(map[string]float64)
+			for _, op := range operations {
+				errorsBefore[op] = sample(t, `hotcoffee_storage_errors_total{storage="`+name+`",operation="`+op+`"}`)
+			}
+			writesBefore := sample(t, writes)
+
+			err := tt.op(storage)
+			if (err != nil) != tt.fail {
+				t.Fatalf("error = %v, want failure %v", err, tt.fail)
+			}
+
+			if got := sample(t, writes) - writesBefore; got != tt.wantWrite {
+				t.Errorf("writes = %v, want %v", got, tt.wantWrite)
+			}
+			for _, op := range operations {
+				want := 0.0
+				if op == tt.wantError {
+					want = 1
+				}
+				got := sample(t, `hotcoffee_storage_errors_total{storage="`+name+`",operation="`+op+`"}`) - errorsBefore[op]
+				if got != want {
+					t.Errorf("%s errors = %v, want %v", op, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewStorageInstrumented(t *testing.T) {
+	storage, err := NewStorage(core.StorageMemory, "", "instrumented.json")
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	before := sample(t, `hotcoffee_storage_writes_total{storage="instrumented.json"}`)
+	for range 2 {
+		if err := storage.Save([]models.Supplier{}); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if got := sample(t, `hotcoffee_storage_writes_total{storage="instrumented.json"}`) - before; got != 2 {
+		t.Errorf("writes = %v, want 2", got)
+	}
+}
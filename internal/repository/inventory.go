@@ -1,141 +1,135 @@
 package repository
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 type InventoryRepository interface {
-	Create(item *models.InventoryItem) error
-	GetByID(id string) (*models.InventoryItem, error)
-	GetAll() (*[]models.InventoryItem, error)
-	Update(item *models.InventoryItem) error
-	Delete(id string) error
+	Create(ctx context.Context, item *models.InventoryItem) error
+	GetByID(ctx context.Context, id string) (*models.InventoryItem, error)
+	GetAll(ctx context.Context) (*[]models.InventoryItem, error)
+	List(ctx context.Context, filter models.InventoryFilter, opts models.ListOptions) (*[]models.InventoryItem, int, error)
+	Update(ctx context.Context, item *models.InventoryItem) error
+	UpdateMany(ctx context.Context, items []models.InventoryItem) error
+	Delete(ctx context.Context, id string) error
+
+	WithTx(tx *Tx) InventoryRepository
 }
 
 // InventoryRepository manages inventory data
 type inventoryRepository struct {
-	storage *JSONStorage
-	log     *slog.Logger
+	items collection[models.InventoryItem]
+	log   *slog.Logger
 }
 
 // NewInventoryRepository initializes an InventoryRepository with storage and logging
-func NewInventoryRepository(storage *JSONStorage, log *slog.Logger) *inventoryRepository {
+func NewInventoryRepository(storage Storage, log *slog.Logger) *inventoryRepository {
 	return &inventoryRepository{
-		storage: storage,
-		log:     log,
+		items: newTable(storage, func(item models.InventoryItem) string { return item.IngredientID }),
+		log:   log,
 	}
 }
 
-// loadItems is a helper function to retrieve items from storage
-func (r *inventoryRepository) loadItems() (*[]models.InventoryItem, error) {
-	var items []models.InventoryItem
-	if err := r.storage.Retrieve(&items); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrStorageOperation, err)
-	}
-	return &items, nil
-}
-
-// saveItems is a helper function to save items to storage
-func (r *inventoryRepository) saveItems(items *[]models.InventoryItem) error {
-	if err := r.storage.Save(items); err != nil {
-		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *inventoryRepository) WithTx(tx *Tx) InventoryRepository {
+	return &inventoryRepository{
+		items: r.items.withTx(tx),
+		log:   r.log,
 	}
-	return nil
 }
 
-func (r *inventoryRepository) Create(item *models.InventoryItem) error {
-	r.log.Info("creating inventory item", "id", item.IngredientID)
+func (r *inventoryRepository) Create(ctx context.Context, item *models.InventoryItem) error {
+	r.log.InfoContext(ctx, "creating inventory item", "id", item.IngredientID)
 
-	items, err := r.loadItems()
+	err := r.items.mutate(ctx, func(items *records[models.InventoryItem]) error {
+		return items.add(*item)
+	})
 	if err != nil {
-		return err
-	}
-
-	*items = append(*items, *item)
-
-	if err := r.saveItems(items); err != nil {
-		r.log.Error("failed to save new inventory item", "error", err, "id", item.IngredientID)
+		r.log.ErrorContext(ctx, "failed to save new inventory item", "error", err, "id", item.IngredientID)
 		return err
 	}
 
 	return nil
 }
 
-func (r *inventoryRepository) GetByID(id string) (*models.InventoryItem, error) {
-	r.log.Info("retrieving inventory item", "id", id)
+func (r *inventoryRepository) GetByID(ctx context.Context, id string) (*models.InventoryItem, error) {
+	r.log.InfoContext(ctx, "retrieving inventory item", "id", id)
 
-	items, err := r.loadItems()
+	item, err := r.items.get(ctx, id)
 	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load inventory items", "error", err)
 		return nil, err
 	}
 
-	for _, item := range *items {
-		if item.IngredientID == id {
-			return &item, nil
-		}
-	}
-
-	return nil, nil
+	return item, nil
 }
 
-func (r *inventoryRepository) GetAll() (*[]models.InventoryItem, error) {
-	r.log.Info("retrieving all inventory items")
+func (r *inventoryRepository) GetAll(ctx context.Context) (*[]models.InventoryItem, error) {
+	r.log.InfoContext(ctx, "retrieving all inventory items")
 
-	items, err := r.loadItems()
+	items, err := r.items.all(ctx)
 	if err != nil {
-		r.log.Error("failed to load inventory items", "error", err)
+		r.log.ErrorContext(ctx, "failed to load inventory items", "error", err)
 		return nil, err
 	}
 
-	return items, nil
+	return &items, nil
 }
 
-func (r *inventoryRepository) Update(item *models.InventoryItem) error {
-	r.log.Info("updating inventory item", "id", item.IngredientID)
+// List returns the page of inventory items that pass the filter, along with
+// the number of items that pass it
+func (r *inventoryRepository) List(ctx context.Context, filter models.InventoryFilter, opts models.ListOptions) (*[]models.InventoryItem, int, error) {
+	r.log.InfoContext(ctx, "listing inventory items", "offset", opts.Offset, "limit", opts.Limit, "sort", opts.Sort)
 
-	items, err := r.loadItems()
+	items, total, err := r.items.list(ctx, newQuery(filter.Includes, inventoryLess(opts.Sort), inventoryLess("ingredient_id"), opts))
 	if err != nil {
-		return err
+		r.log.ErrorContext(ctx, "failed to load inventory items", "error", err)
+		return nil, 0, err
 	}
 
-	for i, existing := range *items {
-		if existing.IngredientID == item.IngredientID {
-			(*items)[i] = *item
-			break
-		}
-	}
+	return &items, total, nil
+}
 
-	if err := r.saveItems(items); err != nil {
-		r.log.Error("failed to save updated inventory item", "error", err, "id", item.IngredientID)
-		return err
-	}
+func (r *inventoryRepository) Update(ctx context.Context, item *models.InventoryItem) error {
+	r.log.InfoContext(ctx, "updating inventory item", "id", item.IngredientID)
 
-	return nil
+	return r.UpdateMany(ctx, []models.InventoryItem{*item})
 }
 
-func (r *inventoryRepository) Delete(id string) error {
-	r.log.Info("deleting inventory item", "id", id)
+// UpdateMany replaces the items and persists them in a single write. Nothing
+// is written if any of them does not exist.
+func (r *inventoryRepository) UpdateMany(ctx context.Context, updated []models.InventoryItem) error {
+	r.log.InfoContext(ctx, "updating inventory items", "count", len(updated))
 
-	items, err := r.loadItems()
+	err := r.items.mutate(ctx, func(items *records[models.InventoryItem]) error {
+		for _, item := range updated {
+			if err := items.update(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated inventory items", "error", err)
 		return err
 	}
 
-	for i, item := range *items {
-		if item.IngredientID == id {
-			(*items)[i], (*items)[len(*items)-1] = (*items)[len(*items)-1], (*items)[i]
-			*items = (*items)[:len(*items)-1]
+	return nil
+}
 
-			if err := r.saveItems(items); err != nil {
-				r.log.Error("failed to save updated inventory items", "error", err)
-				return err
-			}
+func (r *inventoryRepository) Delete(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "deleting inventory item", "id", id)
 
-			break
-		}
+	err := r.items.mutate(ctx, func(items *records[models.InventoryItem]) error {
+		items.remove(id)
+		return nil
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated inventory items", "error", err)
+		return err
 	}
 
 	return nil
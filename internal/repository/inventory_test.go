@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestInventoryRepositoryWrites(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(ctx context.Context, r InventoryRepository) error
+		wantErr error
+		want    map[string]float64 // quantities afterwards
+	}{
+		{
+			name: "create new",
+			write: func(ctx context.Context, r InventoryRepository) error {
+				return r.Create(ctx, &models.InventoryItem{IngredientID: "milk", Quantity: 500})
+			},
+			want: map[string]float64{"beans": 1000, "sugar": 200, "milk": 500},
+		},
+		{
+			name: "create existing",
+			write: func(ctx context.Context, r InventoryRepository) error {
+				return r.Create(ctx, &models.InventoryItem{IngredientID: "beans", Quantity: 1})
+			},
+			wantErr: ErrRecordExists,
+			want:    map[string]float64{"beans": 1000, "sugar": 200},
+		},
+		{
+			name: "update missing",
+			write: func(ctx context.Context, r InventoryRepository) error {
+				return r.Update(ctx, &models.InventoryItem{IngredientID: "milk", Quantity: 1})
+			},
+			wantErr: ErrRecordNotFound,
+			want:    map[string]float64{"beans": 1000, "sugar": 200},
+		},
+		{
+			name: "update many",
+			write: func(ctx context.Context, r InventoryRepository) error {
+				return r.UpdateMany(ctx, []models.InventoryItem{{IngredientID: "beans", Quantity: 900}, {IngredientID: "sugar", Quantity: 100}})
+			},
+			want: map[string]float64{"beans": 900, "sugar": 100},
+		},
+		{
+			name: "update many with a missing item",
+			write: func(ctx context.Context, r InventoryRepository) error {
+				return r.UpdateMany(ctx, []models.InventoryItem{{IngredientID: "beans", Quantity: 900}, {IngredientID: "milk", Quantity: 1}})
+			},
+			wantErr: ErrRecordNotFound,
+			want:    map[string]float64{"beans": 1000, "sugar": 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := NewMemoryStorage(core.InventoryFile)
+			r := NewInventoryRepository(storage, discardLog)
+			for _, item := range []models.InventoryItem{{IngredientID: "beans", Quantity: 1000}, {IngredientID: "sugar", Quantity: 200}} {
+				if err := r.Create(ctx, &item); err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+			}
+
+			if err := tt.write(ctx, r); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			// What was written is what a fresh read of the storage sees
+			var stored []models.InventoryItem
+			if err := storage.Retrieve(&stored); err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			got := make(map[string]float64, len(stored))
+			for _, item := range stored {
+				got[item.IngredientID] = item.Quantity
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("items = %v, want %v", got, tt.want)
+			}
+			for id, quantity := range tt.want {
+				if got[id] != quantity {
+					t.Errorf("%s = %v, want %v", id, got[id], quantity)
+				}
+			}
+		})
+	}
+}
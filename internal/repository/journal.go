@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Transactor runs fn inside a storage transaction. Writes made through
+// repositories bound to tx reach storage together when fn returns nil and
+// are discarded when it returns an error or ctx is done before the commit.
+type Transactor interface {
+	Atomically(ctx context.Context, fn func(tx *Tx) error) error
+}
+
+// Journal is a write-ahead journal for operations that span several
+// storages. Before any storage is touched, the full new content of every
+// storage in the transaction, or for an append-only storage the records
+// appended to it, is written to the journal file and synced.
+// If the process dies while the storages are being written, the journal is
+// replayed on the next start; if it dies before the journal is complete,
+// no storage was touched and the transaction is simply gone.
+//
+// A transaction has happened once its record is on disk. If writing a
+// storage fails after that, the transaction still succeeds and the record
+// is replayed before the next transaction runs, so a client is never told
+// that an operation failed that is later applied anyway.
+//
+// Transactions are serialized: only one runs at a time.
+type Journal struct {
+	path     string // empty for a journal that is never written to disk
+	storages map[string]Storage
+	turn     chan struct{} // held by the running transaction
+	pending  bool          // a committed record has not been fully applied yet
+	closed   bool
+	log      *slog.Logger
+}
+
+// journalRecord is the on-disk form of a committed transaction
+type journalRecord struct {
+	Writes []journalWrite `json:"writes"`
+}
+
+type journalWrite struct {
+	Storage string          `json:"storage"`
+	Data    json.RawMessage `json:"data"`
+	Append  bool            `json:"append,omitempty"` // Data is added to the storage, not saved over it
+}
+
+// NewJournal opens the journal at path for the given storages and recovers
+// any transaction left behind by a crash. An empty path writes no journal
+// file, for storages that keep nothing on disk: transactions are still
+// isolated from each other, but if one storage fails to save, the storages
+// saved before it keep the new content.
+func NewJournal(path string, log *slog.Logger, storages ...Storage) (*Journal, error) {
+	j := &Journal{
+		path:     path,
+		storages: make(map[string]Storage, len(storages)),
+		turn:     make(chan struct{}, 1),
+		log:      log,
+	}
+	for _, storage := range storages {
+		j.storages[storage.Name()] = storage
+	}
+
+	if path == "" {
+		return j, nil
+	}
+
+	// A leftover temporary file is a journal that was never completed
+	if err := os.Remove(path + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("journal cleanup failed: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		j.pending = true
+		if err := j.recover(); err != nil {
+			return nil, fmt.Errorf("journal recovery failed: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("journal check failed: %w", err)
+	}
+
+	return j, nil
+}
+
+// Atomically runs fn in a new transaction and commits it if fn succeeds.
+// Waiting for the transaction running before it stops when ctx is done.
+func (j *Journal) Atomically(ctx context.Context, fn func(tx *Tx) error) error {
+	// Checked first, as with a free turn select would pick either case and
+	// might start fn for a request already given up on
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case j.turn <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-j.turn }()
+
+	if j.closed {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, ErrStorageClosed)
+	}
+
+	if j.pending {
+		if err := j.recover(); err != nil {
+			return fmt.Errorf("%w: journal recovery failed: %v", ErrStorageOperation, err)
+		}
+	}
+
+	tx := &Tx{state: make(map[Storage]any)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	// Nothing has been written yet, so a request given up on is dropped
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := j.commit(tx); err != nil {
+		return err
+	}
+
+	for _, hook := range tx.onCommit {
+		hook()
+	}
+	return nil
+}
+
+// Close waits for the running transaction to finish, applies a committed
+// record that is still pending and closes every storage. No transaction
+// runs after it. It gives up waiting when ctx is done.
+func (j *Journal) Close(ctx context.Context) error {
+	select {
+	case j.turn <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the running transaction: %w", ctx.Err())
+	}
+	defer func() { <-j.turn }()
+
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+
+	var errs []error
+	if j.pending {
+		if err := j.recover(); err != nil {
+			errs = append(errs, fmt.Errorf("journal recovery failed: %w", err))
+		}
+	}
+	for name, storage := range j.storages {
+		if err := storage.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks every storage of the journal, so that one gone bad is
+// found before a transaction needs it
+func (j *Journal) Validate() error {
+	names := make([]string, 0, len(j.storages))
+	for name := range j.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := j.storages[name].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// commit writes the journal record, applies it and removes the record. Once
+// the record is written the transaction is committed: a storage that fails
+// to save is left to recovery and no error is returned.
+func (j *Journal) commit(tx *Tx) error {
+	if len(tx.writes) == 0 {
+		return nil
+	}
+
+	// A single storage write is already atomic on its own
+	if len(tx.writes) > 1 && j.path != "" {
+		record := journalRecord{Writes: make([]journalWrite, 0, len(tx.writes))}
+		for _, w := range tx.writes {
+			data, err := json.Marshal(w.value)
+			if err != nil {
+				return fmt.Errorf("JSON marshal failed: %w", err)
+			}
+			record.Writes = append(record.Writes, journalWrite{Storage: w.storage.Name(), Data: data, Append: w.appended})
+		}
+
+		if err := j.writeRecord(record); err != nil {
+			return fmt.Errorf("%w: journal write failed: %v", ErrStorageOperation, err)
+		}
+		j.pending = true
+	}
+
+	applied := true
+	for _, w := range tx.writes {
+		if err := write(w.storage, w.value, w.appended); err != nil {
+			if !j.pending {
+				return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+			}
+			j.log.Error("failed to apply committed transaction, will retry", "error", err, "storage", w.storage.Name())
+			applied = false
+			break
+		}
+	}
+
+	if applied && j.pending {
+		// Replaying an applied record writes the same content again, so a
+		// record that cannot be removed does no harm
+		if err := j.clear(); err != nil {
+			j.pending = true
+			j.log.Error("failed to clear applied journal record, will retry", "error", err)
+		}
+	}
+
+	// The caches show the committed content even where a storage is behind,
+	// as the storage catches up before anything else is written
+	for _, w := range tx.writes {
+		w.afterCommit()
+	}
+	return nil
+}
+
+// recover replays the journal record left on disk
+func (j *Journal) recover() error {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+
+	var record journalRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		// The record is written with an atomic rename, so a record that
+		// cannot be parsed was never committed: roll it back.
+		j.log.Warn("discarding unreadable journal record", "error", err)
+		return j.clear()
+	}
+
+	j.log.Warn("replaying journal record", "writes", len(record.Writes))
+	if err := j.apply(record); err != nil {
+		return err
+	}
+
+	return j.clear()
+}
+
+// apply writes every storage in the record
+func (j *Journal) apply(record journalRecord) error {
+	for _, w := range record.Writes {
+		storage, ok := j.storages[w.Storage]
+		if !ok {
+			return fmt.Errorf("journal references unknown storage: %s", w.Storage)
+		}
+		if err := write(storage, w.Data, w.Append); err != nil {
+			return fmt.Errorf("replay of %s failed: %w", w.Storage, err)
+		}
+	}
+	return nil
+}
+
+// write saves value as the content of storage or, for an append, adds it to
+// the stored content
+func write(storage Storage, value any, appended bool) error {
+	if !appended {
+		return storage.Save(value)
+	}
+	appender, ok := storage.(Appender)
+	if !ok {
+		return fmt.Errorf("%s cannot be appended to", storage.Name())
+	}
+	return appender.Append(value)
+}
+
+// writeRecord durably writes the record to the journal file
+func (j *Journal) writeRecord(record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(j.path, data)
+}
+
+// clear removes the applied journal record
+func (j *Journal) clear() error {
+	j.pending = false
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDir(filepath.Dir(j.path))
+}
+
+// Tx is a transaction in progress. Repositories bound to it work on their
+// own copy of every collection they change and the copies are only written
+// to storage when the transaction commits.
+type Tx struct {
+	writes   []txWrite
+	state    map[Storage]any // working copies of the changed collections
+	onCommit []func()
+}
+
+type txWrite struct {
+	storage     Storage
+	value       any
+	appended    bool // value is added to the storage rather than saved over it
+	afterCommit func()
+}
+
+// Atomically runs fn as part of tx, so nested transactions join the outer one
+func (tx *Tx) Atomically(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// OnCommit registers fn to run once the transaction has been committed.
+// It does not run if the transaction fails.
+func (tx *Tx) OnCommit(fn func()) {
+	tx.onCommit = append(tx.onCommit, fn)
+}
+
+// stage records value as the new content of storage. afterCommit runs once
+// the value has been written.
+func (tx *Tx) stage(storage Storage, value any, afterCommit func()) {
+	tx.stageWrite(txWrite{storage: storage, value: value, afterCommit: afterCommit})
+}
+
+// stageAppend records value as the records the transaction appends to
+// storage. afterCommit runs once they have been written.
+func (tx *Tx) stageAppend(storage Appender, value any, afterCommit func()) {
+	tx.stageWrite(txWrite{storage: storage, value: value, appended: true, afterCommit: afterCommit})
+}
+
+// stageWrite replaces the write staged for the same storage, if there is one
+func (tx *Tx) stageWrite(write txWrite) {
+	for i, w := range tx.writes {
+		if w.storage == write.storage {
+			tx.writes[i] = write
+			return
+		}
+	}
+	tx.writes = append(tx.writes, write)
+}
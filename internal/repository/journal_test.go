@@ -0,0 +1,486 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var errSaveFailed = errors.New("save failed")
+
+// flakyStorage is a memory storage whose saves fail while fail is set
+type flakyStorage struct {
+	*MemoryStorage
+	fail bool
+}
+
+func (s *flakyStorage) Save(v interface{}) error {
+	if s.fail {
+		return errSaveFailed
+	}
+	return s.MemoryStorage.Save(v)
+}
+
+func supplierKey(supplier models.Supplier) string { return supplier.ID }
+
+// storedIDs returns the IDs of the suppliers in storage, in order
+func storedIDs(t *testing.T, storage Storage) []string {
+	t.Helper()
+
+	var suppliers []models.Supplier
+	if err := storage.Retrieve(&suppliers); err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	ids := make([]string, len(suppliers))
+	for i, supplier := range suppliers {
+		ids[i] = supplier.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// addSupplier puts a supplier with the given ID in the collection
+func addSupplier(ctx context.Context, c collection[models.Supplier], id string) error {
+	return c.mutate(ctx, func(rs *records[models.Supplier]) error {
+		rs.put(models.Supplier{ID: id, Name: id})
+		return nil
+	})
+}
+
+func TestJournalCommit(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      bool // write a journal file
+		failFirst bool
+		failLast  bool
+		wantErr   bool
+		wantFirst []string // after the transaction
+		wantLast  []string
+		pending   bool // a record is left for recovery
+	}{
+		{name: "applied", path: true, wantFirst: []string{"a"}, wantLast: []string{"b"}},
+		{name: "applied without journal file", wantFirst: []string{"a"}, wantLast: []string{"b"}},
+		{name: "second save fails after the record", path: true, failLast: true, wantFirst: []string{"a"}, wantLast: []string{}, pending: true},
+		{name: "first save fails after the record", path: true, failFirst: true, wantFirst: []string{}, wantLast: []string{}, pending: true},
+		{name: "save fails without journal file", failFirst: true, wantErr: true, wantFirst: []string{}, wantLast: []string{}},
+		{name: "later save fails without journal file", failLast: true, wantErr: true, wantFirst: []string{"a"}, wantLast: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			first := &flakyStorage{MemoryStorage: NewMemoryStorage("first.json")}
+			last := &flakyStorage{MemoryStorage: NewMemoryStorage("last.json")}
+
+			path := ""
+			if tt.path {
+				path = filepath.Join(t.TempDir(), "journal.wal")
+			}
+			journal, err := NewJournal(path, discardLog, first, last)
+			if err != nil {
+				t.Fatalf("NewJournal() error = %v", err)
+			}
+
+			firstTable := newTable(Storage(first), supplierKey)
+			lastTable := newTable(Storage(last), supplierKey)
+
+			first.fail, last.fail = tt.failFirst, tt.failLast
+			err = journal.Atomically(ctx, func(tx *Tx) error {
+				if err := addSupplier(ctx, firstTable.withTx(tx), "a"); err != nil {
+					return err
+				}
+				return addSupplier(ctx, lastTable.withTx(tx), "b")
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Atomically() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := storedIDs(t, first); !equalIDs(got, tt.wantFirst) {
+				t.Errorf("first storage = %v, want %v", got, tt.wantFirst)
+			}
+			if got := storedIDs(t, last); !equalIDs(got, tt.wantLast) {
+				t.Errorf("last storage = %v, want %v", got, tt.wantLast)
+			}
+			if journal.pending != tt.pending {
+				t.Errorf("pending = %v, want %v", journal.pending, tt.pending)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// A committed transaction is visible even before recovery
+			if got, _ := lastTable.get(ctx, "b"); got == nil {
+				t.Errorf("cache does not show the committed record")
+			}
+
+			// The next transaction finishes the committed one first
+			first.fail, last.fail = false, false
+			if err := journal.Atomically(ctx, func(tx *Tx) error { return nil }); err != nil {
+				t.Fatalf("Atomically() after recovery error = %v", err)
+			}
+			if got := storedIDs(t, first); !equalIDs(got, []string{"a"}) {
+				t.Errorf("first storage after recovery = %v, want [a]", got)
+			}
+			if got := storedIDs(t, last); !equalIDs(got, []string{"b"}) {
+				t.Errorf("last storage after recovery = %v, want [b]", got)
+			}
+			if path != "" {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("journal file left after recovery: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalDiscard(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		fnErr   error
+		wantErr error
+	}{
+		{name: "fn fails", ctx: context.Background(), fnErr: errSaveFailed, wantErr: errSaveFailed},
+		{name: "context done", ctx: cancelled, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := NewMemoryStorage("first.json")
+			last := NewMemoryStorage("last.json")
+			journal, err := NewJournal(filepath.Join(t.TempDir(), "journal.wal"), discardLog, first, last)
+			if err != nil {
+				t.Fatalf("NewJournal() error = %v", err)
+			}
+			firstTable := newTable(Storage(first), supplierKey)
+			lastTable := newTable(Storage(last), supplierKey)
+
+			err = journal.Atomically(tt.ctx, func(tx *Tx) error {
+				ctx := context.Background()
+				if err := addSupplier(ctx, firstTable.withTx(tx), "a"); err != nil {
+					return err
+				}
+				if err := addSupplier(ctx, lastTable.withTx(tx), "b"); err != nil {
+					return err
+				}
+				return tt.fnErr
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Atomically() error = %v, want %v", err, tt.wantErr)
+			}
+
+			for _, storage := range []Storage{first, last} {
+				if got := storedIDs(t, storage); len(got) != 0 {
+					t.Errorf("%s = %v, want nothing written", storage.Name(), got)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		journal   string // content of the journal file, if any
+		tmp       bool   // an unfinished journal is left behind
+		wantFirst []string
+		wantErr   bool
+	}{
+		{name: "nothing to recover", wantFirst: []string{}},
+		{
+			name:      "committed record is replayed",
+			journal:   `{"writes":[{"storage":"first.json","data":[{"supplier_id":"x","name":"x"}]}]}`,
+			wantFirst: []string{"x"},
+		},
+		{name: "unreadable record is discarded", journal: `{"writes":[{"stor`, wantFirst: []string{}},
+		{name: "unfinished journal is removed", tmp: true, wantFirst: []string{}},
+		{
+			name:    "unknown storage",
+			journal: `{"writes":[{"storage":"gone.json","data":[]}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.wal")
+			if tt.journal != "" {
+				if err := os.WriteFile(path, []byte(tt.journal), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.tmp {
+				if err := os.WriteFile(path+".tmp", []byte(`{"writes":[{"storage":"first.json","data":[{"supplier_id":"x"}]}]}`), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			first := NewMemoryStorage("first.json")
+			_, err := NewJournal(path, discardLog, first)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewJournal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := storedIDs(t, first); !equalIDs(got, tt.wantFirst) {
+				t.Errorf("storage = %v, want %v", got, tt.wantFirst)
+			}
+			for _, leftover := range []string{path, path + ".tmp"} {
+				if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+					t.Errorf("%s left after recovery: %v", filepath.Base(leftover), err)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalClosed(t *testing.T) {
+	storage := NewMemoryStorage("first.json")
+	journal, err := NewJournal("", discardLog, storage)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	if err := journal.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	err = journal.Atomically(context.Background(), func(tx *Tx) error { return nil })
+	if !errors.Is(err, ErrStorageOperation) {
+		t.Errorf("Atomically() after Close error = %v, want ErrStorageOperation", err)
+	}
+}
+
+func TestJournalCancelled(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel string // when the context is cancelled: "before", "in fn" or "waiting"
+		wantFn bool   // fn runs before the cancellation is noticed
+	}{
+		{name: "cancelled before", cancel: "before"},
+		{name: "cancelled while fn runs", cancel: "in fn", wantFn: true},
+		{name: "cancelled waiting for another transaction", cancel: "waiting"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.wal")
+			first := NewMemoryStorage("first.json")
+			last := NewMemoryStorage("last.json")
+			journal, err := NewJournal(path, discardLog, first, last)
+			if err != nil {
+				t.Fatalf("NewJournal() error = %v", err)
+			}
+			firstTable := newTable(Storage(first), supplierKey)
+			lastTable := newTable(Storage(last), supplierKey)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel == "before" {
+				cancel()
+			}
+
+			// Another transaction holds the journal until release is closed
+			release := make(chan struct{})
+			held := make(chan struct{})
+			done := make(chan error, 1)
+			if tt.cancel == "waiting" {
+				go func() {
+					done <- journal.Atomically(context.Background(), func(tx *Tx) error {
+						close(held)
+						<-release
+						return nil
+					})
+				}()
+				<-held
+				time.AfterFunc(10*time.Millisecond, cancel)
+			} else {
+				done <- nil
+			}
+
+			ran, hooked := false, false
+			err = journal.Atomically(ctx, func(tx *Tx) error {
+				ran = true
+				tx.OnCommit(func() { hooked = true })
+				if err := addSupplier(context.Background(), firstTable.withTx(tx), "a"); err != nil {
+					return err
+				}
+				if err := addSupplier(context.Background(), lastTable.withTx(tx), "b"); err != nil {
+					return err
+				}
+				if tt.cancel == "in fn" {
+					cancel()
+				}
+				return nil
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Atomically() error = %v, want context.Canceled", err)
+			}
+			close(release)
+			if err := <-done; err != nil {
+				t.Fatalf("holding transaction error = %v", err)
+			}
+
+			if ran != tt.wantFn {
+				t.Errorf("fn ran = %v, want %v", ran, tt.wantFn)
+			}
+			if hooked {
+				t.Error("commit hook ran for an aborted transaction")
+			}
+			for _, storage := range []Storage{first, last} {
+				if got := storedIDs(t, storage); len(got) != 0 {
+					t.Errorf("%s = %v, want nothing written", storage.Name(), got)
+				}
+			}
+			if all, _ := firstTable.all(context.Background()); len(all) != 0 {
+				t.Errorf("cache = %v, want nothing added", all)
+			}
+			for _, leftover := range []string{path, path + ".tmp"} {
+				if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+					t.Errorf("%s written: %v", filepath.Base(leftover), err)
+				}
+			}
+
+			// The journal is not left locked
+			if err := journal.Atomically(context.Background(), func(tx *Tx) error { return nil }); err != nil {
+				t.Errorf("next Atomically() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestJournalCloseFlushes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.wal")
+	firstPath := filepath.Join(dir, core.SupplierFile)
+
+	first, err := NewJSONStorage(firstPath)
+	if err != nil {
+		t.Fatalf("NewJSONStorage() error = %v", err)
+	}
+	last := &flakyStorage{MemoryStorage: NewMemoryStorage("last.json")}
+	journal, err := NewJournal(path, discardLog, first, last)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	firstTable := newTable(Storage(first), supplierKey)
+	lastTable := newTable(Storage(last), supplierKey)
+
+	// The last storage fails, so the committed record stays pending
+	last.fail = true
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		if err := addSupplier(ctx, firstTable.withTx(tx), "a"); err != nil {
+			return err
+		}
+		return addSupplier(ctx, lastTable.withTx(tx), "b")
+	})
+	if err != nil {
+		t.Fatalf("Atomically() error = %v", err)
+	}
+	if got := storedIDs(t, last); len(got) != 0 {
+		t.Fatalf("last = %v before Close, want the write still pending", got)
+	}
+
+	last.fail = false
+	if err := journal.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := storedIDs(t, last); !equalIDs(got, []string{"b"}) {
+		t.Errorf("last = %v after Close, want the pending write applied", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal record left after Close: %v", err)
+	}
+
+	// Nothing is written once the journal and its storages are closed
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		t.Error("transaction ran after Close")
+		return nil
+	})
+	if !errors.Is(err, ErrStorageOperation) {
+		t.Errorf("Atomically() after Close error = %v, want ErrStorageOperation", err)
+	}
+	if err := first.Save([]models.Supplier{{ID: "x"}}); !errors.Is(err, ErrStorageClosed) {
+		t.Errorf("Save() after Close error = %v, want ErrStorageClosed", err)
+	}
+	if err := journal.Close(ctx); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	reopened, err := NewJSONStorage(firstPath)
+	if err != nil {
+		t.Fatalf("NewJSONStorage() on reopen error = %v", err)
+	}
+	if got := storedIDs(t, reopened); !equalIDs(got, []string{"a"}) {
+		t.Errorf("suppliers on disk = %v, want [a]", got)
+	}
+}
+
+func TestJournalCloseWaits(t *testing.T) {
+	storage := NewMemoryStorage("first.json")
+	journal, err := NewJournal("", discardLog, storage)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	table := newTable(Storage(storage), supplierKey)
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- journal.Atomically(context.Background(), func(tx *Tx) error {
+			close(held)
+			<-release
+			return addSupplier(context.Background(), table.withTx(tx), "a")
+		})
+	}()
+	<-held
+
+	// Close gives up when the running transaction outlasts its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := journal.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// Otherwise it lets the transaction commit first
+	closed := make(chan error, 1)
+	go func() { closed <- journal.Close(context.Background()) }()
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Atomically() error = %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := storedIDs(t, storage); !equalIDs(got, []string{"a"}) {
+		t.Errorf("storage = %v, want the transaction running at Close committed", got)
+	}
+}
@@ -12,13 +12,12 @@ import (
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
-var ErrStorageOperation = errors.New("storage operation failed")
-
 // JSONStorage represents a thread-safe JSON file storage
 type JSONStorage struct {
 	filePath string
 	mu       sync.RWMutex
 	schema   interface{} // cached schema for validation
+	closed   bool
 }
 
 // NewJSONStorage creates and initializes a new JSONStorage instance
@@ -54,6 +53,12 @@ func (s *JSONStorage) initializeFile() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// A temporary file is a write cut short before its rename, which leaves
+	// the file itself as it was
+	if err := os.Remove(s.filePath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("temporary file cleanup failed: %w", err)
+	}
+
 	if exists, err := s.fileExists(); err != nil {
 		return fmt.Errorf("file check failed: %w", err)
 	} else if !exists {
@@ -67,7 +72,28 @@ func (s *JSONStorage) initializeFile() error {
 	return nil
 }
 
-// validateContent checks if the file content is valid JSON
+// Validate checks that the file still holds a valid collection. It only
+// reads the file, so it is safe to call from a readiness probe.
+func (s *JSONStorage) Validate() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrStorageClosed
+	}
+
+	content, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("file read failed: %w", err)
+	}
+	if len(content) == 0 {
+		return errors.New("file is empty")
+	}
+	return s.checkContent(content)
+}
+
+// validateContent checks if the file content is valid JSON. An empty file
+// is initialized with an empty collection.
 func (s *JSONStorage) validateContent() error {
 	content, err := os.ReadFile(s.filePath)
 	if err != nil {
@@ -78,6 +104,11 @@ func (s *JSONStorage) validateContent() error {
 		return s.writeEmptyJSONArray()
 	}
 
+	return s.checkContent(content)
+}
+
+// checkContent checks that content decodes into the schema of the file
+func (s *JSONStorage) checkContent(content []byte) error {
 	// Create a new instance of the schema for validation
 	validation := determineSchema(filepath.Base(s.filePath))
 	if err := json.Unmarshal(content, validation); err != nil {
@@ -96,11 +127,38 @@ func determineSchema(filename string) interface{} {
 		return &[]models.InventoryItem{}
 	case core.OrderFile:
 		return &[]models.Order{}
+	case core.MovementFile:
+		return &[]models.InventoryMovement{}
+	case core.SupplierFile:
+		return &[]models.Supplier{}
+	case core.PurchaseFile:
+		return &[]models.PurchaseOrder{}
+	case core.UserFile:
+		return &[]models.User{}
+	case core.SequenceFile:
+		return &[]models.Sequence{}
 	default:
 		return nil
 	}
 }
 
+// Name returns the file name the storage is known by in the journal
+func (s *JSONStorage) Name() string {
+	return filepath.Base(s.filePath)
+}
+
+// Stamp identifies the current version of the file by its modification time and size
+func (s *JSONStorage) Stamp() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		return "", fmt.Errorf("file stat failed: %w", err)
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
 // Retrieve reads and unmarshals data from the JSON file
 func (s *JSONStorage) Retrieve(v interface{}) error {
 	s.mu.RLock()
@@ -123,28 +181,69 @@ func (s *JSONStorage) Save(v interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.closed {
+		return ErrStorageClosed
+	}
+
 	return s.atomicWrite(v)
 }
 
 // atomicWrite performs atomic write operation using a temporary file
 func (s *JSONStorage) atomicWrite(v interface{}) error {
-	tempFile := s.filePath + ".tmp"
-
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return fmt.Errorf("JSON marshal failed: %w", err)
 	}
 
-	if err := os.WriteFile(tempFile, data, core.FilePerm); err != nil {
+	return writeFileSync(s.filePath, data)
+}
+
+// writeFileSync replaces path with data through a synced temporary file, so
+// that after it returns the new content survives a power cut
+func writeFileSync(path string, data []byte) error {
+	tempFile := path + ".tmp"
+
+	file, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, core.FilePerm)
+	if err != nil {
+		return fmt.Errorf("temporary file create failed: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
 		os.Remove(tempFile)
 		return fmt.Errorf("temporary file write failed: %w", err)
 	}
 
-	if err := os.Rename(tempFile, s.filePath); err != nil {
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return fmt.Errorf("temporary file sync failed: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("temporary file close failed: %w", err)
+	}
+
+	if err := os.Rename(tempFile, path); err != nil {
 		os.Remove(tempFile)
 		return fmt.Errorf("atomic rename failed: %w", err)
 	}
 
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes directory entries, making renames and removals durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("directory open failed: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("directory sync failed: %w", err)
+	}
 	return nil
 }
 
@@ -171,6 +270,16 @@ func (s *JSONStorage) Clear() error {
 	return nil
 }
 
+// Close waits for a write in progress. Every write is synced before Save
+// returns, so there is nothing left to flush.
+func (s *JSONStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
 func (s *JSONStorage) writeEmptyJSONArray() error {
 	return os.WriteFile(s.filePath, []byte("[]"), core.FilePerm)
 }
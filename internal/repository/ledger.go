@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// appendCollection is how repositories read and extend a collection that
+// only ever grows. Nothing is read or written once the context is done.
+type appendCollection[T any] interface {
+	all(ctx context.Context) ([]T, error)
+	append(ctx context.Context, fn func(count int) []T) error
+	withTx(tx *Tx) appendCollection[T]
+}
+
+// ledger caches an append-only collection in memory. Unlike a table, a
+// write hands the storage only the new records, so it costs the same
+// however long the history is. The storage stamp is checked on every
+// access, as for a table.
+type ledger[T any] struct {
+	storage Appender
+	mu      sync.RWMutex
+	items   []T
+	loaded  bool
+	stamp   string
+}
+
+func newLedger[T any](storage Appender) *ledger[T] {
+	return &ledger[T]{storage: storage}
+}
+
+// load makes sure the cache matches the storage
+func (l *ledger[T]) load(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stamp, err := l.storage.Stamp()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	l.mu.RLock()
+	fresh := l.loaded && l.stamp == stamp
+	l.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reload(stamp)
+}
+
+// reload reads the storage into the cache. The caller must hold l.mu.
+func (l *ledger[T]) reload(stamp string) error {
+	if l.loaded && l.stamp == stamp {
+		return nil
+	}
+
+	var items []T
+	if err := l.storage.Retrieve(&items); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	l.items = items
+	l.loaded = true
+	l.stamp = stamp
+	return nil
+}
+
+// count returns the number of records after making sure the cache is fresh
+func (l *ledger[T]) count(ctx context.Context) (int, error) {
+	if err := l.load(ctx); err != nil {
+		return 0, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.items), nil
+}
+
+func (l *ledger[T]) all(ctx context.Context) ([]T, error) {
+	if err := l.load(ctx); err != nil {
+		return nil, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	items := make([]T, len(l.items))
+	copy(items, l.items)
+	return items, nil
+}
+
+// append hands fn the number of records stored and writes the records it
+// returns after them. The cache only changes once the write succeeded.
+func (l *ledger[T]) append(ctx context.Context, fn func(count int) []T) error {
+	stamp, err := l.storage.Stamp()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.reload(stamp); err != nil {
+		return err
+	}
+
+	added := fn(len(l.items))
+
+	// A request given up on leaves the storage as it was
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := l.storage.Append(added); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+	}
+
+	l.extend(added)
+	return nil
+}
+
+// extend adds records that have just been written to the storage. The
+// caller must hold l.mu.
+func (l *ledger[T]) extend(added []T) {
+	// Slices handed out by all are copies, so the cache can grow in place
+	l.items = append(l.items, added...)
+	if stamp, err := l.storage.Stamp(); err == nil {
+		l.stamp = stamp
+	} else {
+		l.loaded = false // force a reload on next access
+	}
+}
+
+func (l *ledger[T]) withTx(tx *Tx) appendCollection[T] {
+	return &txLedger[T]{base: l, tx: tx}
+}
+
+// txLedger is a ledger as seen from inside a transaction: the stored
+// records followed by the ones the transaction has appended so far
+type txLedger[T any] struct {
+	base *ledger[T]
+	tx   *Tx
+}
+
+// pending returns the records the transaction has appended
+func (v *txLedger[T]) pending() []T {
+	if added, ok := v.tx.state[v.base.storage]; ok {
+		return added.([]T)
+	}
+	return nil
+}
+
+func (v *txLedger[T]) all(ctx context.Context) ([]T, error) {
+	items, err := v.base.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(items, v.pending()...), nil
+}
+
+func (v *txLedger[T]) append(ctx context.Context, fn func(count int) []T) error {
+	count, err := v.base.count(ctx)
+	if err != nil {
+		return err
+	}
+
+	pending := v.pending()
+	added := append(pending[:len(pending):len(pending)], fn(count+len(pending))...)
+
+	v.tx.state[v.base.storage] = added
+	v.tx.stageAppend(v.base.storage, added, func() {
+		v.base.mu.Lock()
+		defer v.base.mu.Unlock()
+		v.base.extend(added)
+	})
+	return nil
+}
+
+func (v *txLedger[T]) withTx(tx *Tx) appendCollection[T] {
+	return v.base.withTx(tx)
+}
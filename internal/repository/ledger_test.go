@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func movementIDs(movements []models.InventoryMovement) []string {
+	ids := make([]string, len(movements))
+	for i, movement := range movements {
+		ids[i] = movement.ID
+	}
+	return ids
+}
+
+func TestMovementRepositoryAppend(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryStorage(core.MovementFile)
+	journal, err := NewJournal("", discardLog, storage)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	movements := NewMovementRepository(storage, discardLog)
+
+	first := []models.InventoryMovement{{IngredientID: "beans", Delta: 1000}, {IngredientID: "milk", Delta: 500}}
+	if err := movements.Append(ctx, first); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if got := movementIDs(first); !equalIDs(got, []string{"1", "2"}) {
+		t.Errorf("IDs = %v, want [1 2] written back", got)
+	}
+
+	// Inside a transaction the appended movements follow the stored ones
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		inside := movements.WithTx(tx)
+		for _, delta := range []float64{-18, -36} {
+			if err := inside.Append(ctx, []models.InventoryMovement{{IngredientID: "beans", Delta: delta}}); err != nil {
+				return err
+			}
+		}
+
+		all, _ := inside.GetAll(ctx)
+		if got := movementIDs(all); !equalIDs(got, []string{"1", "2", "3", "4"}) {
+			t.Errorf("inside the transaction = %v, want [1 2 3 4]", got)
+		}
+		if all, _ := movements.GetAll(ctx); len(all) != 2 {
+			t.Errorf("%d movements outside the transaction before commit, want 2", len(all))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Atomically() error = %v", err)
+	}
+
+	// A discarded transaction leaves nothing behind
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		if err := movements.WithTx(tx).Append(ctx, []models.InventoryMovement{{IngredientID: "beans", Delta: -1}}); err != nil {
+			return err
+		}
+		return errSaveFailed
+	})
+	if err == nil {
+		t.Fatal("Atomically() error = nil, want the error of fn")
+	}
+
+	beans, err := movements.GetByIngredient(ctx, "beans")
+	if err != nil {
+		t.Fatalf("GetByIngredient() error = %v", err)
+	}
+	if got := movementIDs(beans); !equalIDs(got, []string{"1", "3", "4"}) {
+		t.Errorf("beans = %v, want [1 3 4]", got)
+	}
+
+	var stored []models.InventoryMovement
+	if err := storage.Retrieve(&stored); err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if got := movementIDs(stored); !equalIDs(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("storage = %v, want [1 2 3 4]", got)
+	}
+}
+
+func TestJournalRecordsOnlyAppendedMovements(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, core.JournalFile)
+	ledgerPath := filepath.Join(dir, "inventory_movements.log")
+
+	ledgerStorage, err := NewLogStorage(ledgerPath, "movement_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() error = %v", err)
+	}
+	suppliers := &flakyStorage{MemoryStorage: NewMemoryStorage(core.SupplierFile)}
+	journal, err := NewJournal(path, discardLog, ledgerStorage, suppliers)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	movements := NewMovementRepository(ledgerStorage, discardLog)
+
+	history := make([]models.InventoryMovement, 50)
+	for i := range history {
+		history[i] = models.InventoryMovement{IngredientID: "beans", Delta: 1}
+	}
+	if err := movements.Append(ctx, history); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	// The second storage fails, leaving the committed record on disk
+	suppliers.fail = true
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		if err := movements.WithTx(tx).Append(ctx, []models.InventoryMovement{{IngredientID: "beans", Delta: -18}}); err != nil {
+			return err
+		}
+		return addSupplier(ctx, newTable(Storage(suppliers), supplierKey).withTx(tx), "a")
+	})
+	if err != nil {
+		t.Fatalf("Atomically() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("journal record missing: %v", err)
+	}
+	var record journalRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("journal record unreadable: %v", err)
+	}
+	found := false
+	for _, w := range record.Writes {
+		if w.Storage != ledgerStorage.Name() {
+			continue
+		}
+		found = true
+		var written []models.InventoryMovement
+		if err := json.Unmarshal(w.Data, &written); err != nil {
+			t.Fatalf("ledger write unreadable: %v", err)
+		}
+		if !w.Append || !equalIDs(movementIDs(written), []string{"51"}) {
+			t.Errorf("ledger write = %v, append %v, want only [51] appended", movementIDs(written), w.Append)
+		}
+	}
+	if !found {
+		t.Errorf("journal record has no ledger write: %s", data)
+	}
+
+	// Replaying the record does not append the movement a second time
+	if err := ledgerStorage.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	reopened, err := NewLogStorage(ledgerPath, "movement_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() on reopen error = %v", err)
+	}
+	defer reopened.Close()
+	if _, err := NewJournal(path, discardLog, reopened, NewMemoryStorage(core.SupplierFile)); err != nil {
+		t.Fatalf("NewJournal() recovery error = %v", err)
+	}
+
+	var stored []models.InventoryMovement
+	if err := reopened.Retrieve(&stored); err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if len(stored) != 51 || stored[50].Delta != -18 {
+		t.Errorf("%d movements after replay, want 51 ending with -18", len(stored))
+	}
+}
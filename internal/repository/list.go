@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// newQuery builds the query for a list. less orders the records by the sort
+// field of opts and is nil when no sort field is given; byID orders them by
+// ID. Ties, and a list without a sort field, are ordered by ID rather than
+// left in storage order, which a removal changes by moving the last record
+// into the gap: pages of an unsorted list would skip or repeat records.
+func newQuery[T any](match func(*T) bool, less, byID func(a, b *T) bool, opts models.ListOptions) query[T] {
+	order := byID
+	if less != nil {
+		order = func(a, b *T) bool {
+			switch {
+			case less(a, b):
+				return true
+			case less(b, a):
+				return false
+			}
+			return byID(a, b)
+		}
+	}
+	if opts.Desc {
+		asc := order
+		order = func(a, b *T) bool { return asc(b, a) }
+	}
+	return query[T]{match: match, less: order, offset: opts.Offset, limit: opts.Limit}
+}
+
+func orderLess(field string) func(a, b *models.Order) bool {
+	switch field {
+	case "order_id":
+		return func(a, b *models.Order) bool { return a.ID < b.ID }
+	case "customer_name":
+		return func(a, b *models.Order) bool {
+			return strings.ToLower(a.CustomerName) < strings.ToLower(b.CustomerName)
+		}
+	case "status":
+		return func(a, b *models.Order) bool { return a.Status < b.Status }
+	case "created_at":
+		// RFC 3339 times of the same zone sort as strings
+		return func(a, b *models.Order) bool { return a.CreatedAt < b.CreatedAt }
+	case "total":
+		return func(a, b *models.Order) bool { return a.Total.Amount < b.Total.Amount }
+	}
+	return nil
+}
+
+func inventoryLess(field string) func(a, b *models.InventoryItem) bool {
+	switch field {
+	case "ingredient_id":
+		return func(a, b *models.InventoryItem) bool { return a.IngredientID < b.IngredientID }
+	case "name":
+		return func(a, b *models.InventoryItem) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "quantity":
+		return func(a, b *models.InventoryItem) bool { return a.Quantity < b.Quantity }
+	}
+	return nil
+}
+
+func menuLess(field string) func(a, b *models.MenuItem) bool {
+	switch field {
+	case "product_id":
+		return func(a, b *models.MenuItem) bool { return a.ID < b.ID }
+	case "name":
+		return func(a, b *models.MenuItem) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }
+	case "price":
+		return func(a, b *models.MenuItem) bool { return a.Price.Amount < b.Price.Amount }
+	}
+	return nil
+}
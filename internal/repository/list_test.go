@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestOrderRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	orders := NewOrderRepository(NewMemoryStorage(core.OrderFile), discardLog)
+	for _, order := range []models.Order{
+		{ID: "o3", CustomerName: "bob", Status: models.StatusPending, CreatedAt: "2024-01-03T10:00:00Z", Total: models.NewMoney(300, "USD")},
+		{ID: "o1", CustomerName: "Ann", Status: models.StatusCompleted, CreatedAt: "2024-01-01T10:00:00Z", Total: models.NewMoney(500, "USD")},
+		{ID: "o4", CustomerName: "Cid", Status: models.StatusPending, CreatedAt: "2024-01-04T10:00:00Z", Total: models.NewMoney(300, "USD")},
+		{ID: "o2", CustomerName: "Annie", Status: models.StatusPending, CreatedAt: "2024-01-02T10:00:00Z", Total: models.NewMoney(100, "USD")},
+	} {
+		if err := orders.Create(ctx, &order); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		filter    models.OrderFilter
+		opts      models.ListOptions
+		want      []string
+		wantTotal int
+	}{
+		{name: "no sort is by ID", want: []string{"o1", "o2", "o3", "o4"}, wantTotal: 4},
+		{name: "descending without sort", opts: models.ListOptions{Desc: true}, want: []string{"o4", "o3", "o2", "o1"}, wantTotal: 4},
+		{name: "customer ignores case", opts: models.ListOptions{Sort: "customer_name"}, want: []string{"o1", "o2", "o3", "o4"}, wantTotal: 4},
+		{name: "created at", opts: models.ListOptions{Sort: "created_at", Desc: true}, want: []string{"o4", "o3", "o2", "o1"}, wantTotal: 4},
+		{name: "ties broken by ID", opts: models.ListOptions{Sort: "total"}, want: []string{"o2", "o3", "o4", "o1"}, wantTotal: 4},
+		{name: "ties broken by ID descending", opts: models.ListOptions{Sort: "total", Desc: true}, want: []string{"o1", "o4", "o3", "o2"}, wantTotal: 4},
+		{name: "page", opts: models.ListOptions{Sort: "status", Offset: 1, Limit: 2}, want: []string{"o2", "o3"}, wantTotal: 4},
+		{name: "past the end", opts: models.ListOptions{Offset: 4}, want: []string{}, wantTotal: 4},
+		{name: "status filter", filter: models.OrderFilter{Statuses: []string{models.StatusPending}}, want: []string{"o2", "o3", "o4"}, wantTotal: 3},
+		{name: "customer filter", filter: models.OrderFilter{Customer: "ANN"}, opts: models.ListOptions{Limit: 1}, want: []string{"o1"}, wantTotal: 2},
+		{
+			name:   "time window",
+			filter: models.OrderFilter{From: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+			want:   []string{"o2", "o3"}, wantTotal: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, total, err := orders.List(ctx, tt.filter, tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			got := make([]string, len(*list))
+			for i, order := range *list {
+				got[i] = order.ID
+			}
+			if !equalIDs(got, tt.want) || total != tt.wantTotal {
+				t.Errorf("List() = %v, %d, want %v, %d", got, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestInventoryRepositoryListAfterDelete(t *testing.T) {
+	ctx := context.Background()
+	items := NewInventoryRepository(NewMemoryStorage(core.InventoryFile), discardLog)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := items.Create(ctx, &models.InventoryItem{IngredientID: id, Name: id, Quantity: 1}); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	// Removing a moves e into its place in the storage; pages keep ID order
+	if err := items.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	var got []string
+	for offset := 0; ; offset += 2 {
+		page, total, err := items.List(ctx, models.InventoryFilter{}, models.ListOptions{Offset: offset, Limit: 2})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if total != 4 {
+			t.Errorf("total = %d, want 4", total)
+		}
+		if len(*page) == 0 {
+			break
+		}
+		for _, item := range *page {
+			got = append(got, item.IngredientID)
+		}
+	}
+	if !equalIDs(got, []string{"b", "c", "d", "e"}) {
+		t.Errorf("pages = %v, want [b c d e]", got)
+	}
+}
+
+func TestMenuRepositoryList(t *testing.T) {
+	ctx := context.Background()
+	menu := NewMenuRepository(NewMemoryStorage(core.MenuFile), discardLog)
+	for _, item := range []models.MenuItem{
+		{ID: "latte", Name: "Latte", Price: models.NewMoney(350, "USD"), Ingredients: []models.MenuItemIngredient{{IngredientID: "beans"}, {IngredientID: "milk"}}},
+		{ID: "espresso", Name: "espresso", Price: models.NewMoney(200, "USD"), Ingredients: []models.MenuItemIngredient{{IngredientID: "beans"}}},
+		{ID: "tea", Name: "Tea", Price: models.NewMoney(200, "USD")},
+	} {
+		if err := menu.Create(ctx, &item); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter models.MenuFilter
+		opts   models.ListOptions
+		want   []string
+	}{
+		{name: "no sort is by ID", want: []string{"espresso", "latte", "tea"}},
+		{name: "name ignores case", opts: models.ListOptions{Sort: "name", Desc: true}, want: []string{"tea", "latte", "espresso"}},
+		{name: "price ties broken by ID", opts: models.ListOptions{Sort: "price"}, want: []string{"espresso", "tea", "latte"}},
+		{name: "ingredient", filter: models.MenuFilter{IngredientID: "beans"}, want: []string{"espresso", "latte"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, _, err := menu.List(ctx, tt.filter, tt.opts)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			got := make([]string, len(*list))
+			for i, item := range *list {
+				got[i] = item.ID
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
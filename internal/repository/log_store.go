@@ -0,0 +1,606 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+)
+
+const (
+	opPut    = "put"
+	opDelete = "del"
+
+	// compactMinEntries is the log size below which compaction is never attempted
+	compactMinEntries = 256
+)
+
+// logEntry is a single line of the append-only log
+type logEntry struct {
+	Op    string          `json:"op"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// LogStorage is an append-only, log-structured storage. Every Save appends
+// only the records that changed since the previous Save, so a write costs
+// the size of the change rather than the size of the collection. The log is
+// compacted once it grows well past the number of live records.
+//
+// The log is read again when the file on disk changes under it, such as
+// when another process appends to it or compacts it.
+type LogStorage struct {
+	logState
+	filePath  string
+	key       string // JSON field identifying a record
+	mu        sync.RWMutex
+	compactAt int    // log size at which compaction is next attempted
+	version   uint64 // incremented on every change
+	broken    error  // a failed append could not be taken back
+	log       *slog.Logger
+}
+
+// recordHash is the SHA-256 of an encoded record
+type recordHash [sha256.Size]byte
+
+// logState is the content of the log file as this process last read or
+// wrote it
+type logState struct {
+	file    *os.File
+	info    os.FileInfo // of the log file, nil if unknown
+	records map[string]json.RawMessage
+	hashes  map[string]recordHash // of every live record, by key
+	keys    map[recordHash]string // of every live record, by hash
+	order   []string
+	entries int // number of entries currently in the log file
+}
+
+// NewLogStorage opens or creates the log at filePath and replays it.
+// key is the JSON field that identifies a record in the collection.
+func NewLogStorage(filePath, key string) (*LogStorage, error) {
+	storage := &LogStorage{
+		filePath:  filePath,
+		key:       key,
+		compactAt: compactMinEntries,
+		log:       slog.Default(),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), core.DirPerm); err != nil {
+		return nil, fmt.Errorf("storage initialization failed: directory creation failed: %w", err)
+	}
+
+	// A temporary file is a compaction cut short before its rename, which
+	// leaves the log itself as it was
+	if err := os.Remove(filePath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("storage initialization failed: temporary file cleanup failed: %w", err)
+	}
+
+	state, err := replayLog(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("storage initialization failed: %w", err)
+	}
+	storage.logState = state
+
+	return storage, nil
+}
+
+// replayLog rebuilds the in-memory state from the log at path and opens it
+// for appending. A torn entry at the end of the log, left by a crash
+// mid-append, is dropped.
+func replayLog(path string) (logState, error) {
+	s := logState{
+		records: make(map[string]json.RawMessage),
+		hashes:  make(map[string]recordHash),
+		keys:    make(map[recordHash]string),
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, core.FilePerm)
+	if err != nil {
+		return s, fmt.Errorf("log open failed: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				// unterminated last line: the append never completed
+				if err := file.Truncate(offset); err != nil {
+					file.Close()
+					return s, fmt.Errorf("log truncate failed: %w", err)
+				}
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return s, fmt.Errorf("log read failed: %w", err)
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			file.Close()
+			return s, fmt.Errorf("invalid log entry at offset %d: %w", offset, err)
+		}
+		s.apply(entry)
+		s.entries++
+		offset += int64(len(line))
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return s, fmt.Errorf("log seek failed: %w", err)
+	}
+
+	s.file = file
+	s.touch()
+	return s, nil
+}
+
+// apply updates the in-memory state with a single log entry
+func (s *logState) apply(entry logEntry) {
+	switch entry.Op {
+	case opPut:
+		if old, ok := s.hashes[entry.Key]; ok {
+			delete(s.keys, old)
+		} else {
+			s.order = append(s.order, entry.Key)
+		}
+		hash := sha256.Sum256(entry.Value)
+		s.records[entry.Key] = entry.Value
+		s.hashes[entry.Key] = hash
+		s.keys[hash] = entry.Key
+	case opDelete:
+		if _, ok := s.records[entry.Key]; !ok {
+			return
+		}
+		delete(s.keys, s.hashes[entry.Key])
+		delete(s.hashes, entry.Key)
+		delete(s.records, entry.Key)
+		for i, key := range s.order {
+			if key == entry.Key {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Name returns the file name the storage is known by in the journal
+func (s *LogStorage) Name() string {
+	return filepath.Base(s.filePath)
+}
+
+// touch notes the log file as it is after this process read or wrote it.
+// If that fails, the log is read again on the next check for changes.
+func (s *logState) touch() {
+	info, err := s.file.Stat()
+	if err != nil {
+		info = nil
+	}
+	s.info = info
+}
+
+// refresh reads the log again if the file on disk is not the one this
+// process last read or wrote, as told by its identity, size and
+// modification time. The caller must hold s.mu for writing.
+func (s *LogStorage) refresh() error {
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		return fmt.Errorf("log stat failed: %w", err)
+	}
+	if s.info != nil && os.SameFile(s.info, info) && s.info.Size() == info.Size() && s.info.ModTime().Equal(info.ModTime()) {
+		return nil
+	}
+
+	s.log.Warn("log changed on disk, reading it again", "log", s.Name())
+	state, err := replayLog(s.filePath)
+	if err != nil {
+		return err
+	}
+
+	s.file.Close()
+	s.logState = state
+	s.compactAt = compactMinEntries
+	s.broken = nil
+	s.version++
+	return nil
+}
+
+// Stamp identifies the current version of the records, after reading the
+// log again if it changed on disk
+func (s *LogStorage) Stamp() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		if err := s.refresh(); err != nil {
+			return "", err
+		}
+	}
+
+	stamp := strconv.FormatUint(s.version, 10)
+	if s.info != nil {
+		stamp = fmt.Sprintf("%s-%d-%d", stamp, s.info.ModTime().UnixNano(), s.info.Size())
+	}
+	return stamp, nil
+}
+
+// Retrieve unmarshals the live records into v
+func (s *LogStorage) Retrieve(v interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, key := range s.order {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(s.records[key])
+	}
+	buf.WriteByte(']')
+
+	if err := json.Unmarshal(buf.Bytes(), v); err != nil {
+		return fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+
+	return nil
+}
+
+// Save appends the difference between v and the stored collection to the
+// log. A record whose encoding hashes the same as a stored record is
+// unchanged and costs no more than the hash.
+func (s *LogStorage) Save(v interface{}) error {
+	values, err := encodeRecords(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStorageClosed
+	}
+	if s.broken != nil {
+		return s.broken
+	}
+	if err := s.refresh(); err != nil {
+		return err
+	}
+
+	var entries []logEntry
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if key, ok := s.keys[sha256.Sum256(value)]; ok {
+			seen[key] = true
+			continue
+		}
+
+		key, err := s.recordKey(value)
+		if err != nil {
+			return err
+		}
+		seen[key] = true
+		entries = append(entries, logEntry{Op: opPut, Key: key, Value: value})
+	}
+	for _, key := range s.order {
+		if !seen[key] {
+			entries = append(entries, logEntry{Op: opDelete, Key: key})
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := s.append(entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s.apply(entry)
+	}
+	s.version++
+
+	// The change is durable already, so a failed compaction only leaves the
+	// log longer than it needs to be until the next attempt
+	if s.entries > s.compactAt && s.entries > 2*len(s.records) {
+		if err := s.compact(); err != nil {
+			s.compactAt = s.entries + compactMinEntries
+			s.log.Error("log compaction failed, will retry", "error", err, "log", s.Name())
+		}
+	}
+
+	return nil
+}
+
+// Append adds the records of the collection v to the log without comparing
+// it with the stored collection. Records whose key is stored already are
+// skipped.
+func (s *LogStorage) Append(v interface{}) error {
+	values, err := encodeRecords(v)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStorageClosed
+	}
+	if s.broken != nil {
+		return s.broken
+	}
+	if err := s.refresh(); err != nil {
+		return err
+	}
+
+	var entries []logEntry
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if _, ok := s.keys[sha256.Sum256(value)]; ok {
+			continue
+		}
+
+		key, err := s.recordKey(value)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.records[key]; ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, logEntry{Op: opPut, Key: key, Value: value})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := s.append(entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s.apply(entry)
+	}
+	s.version++
+	return nil
+}
+
+// elementer is a collection that marshals itself but hands out its records,
+// so that they can be encoded one at a time
+type elementer interface {
+	elements() any
+}
+
+// encodeRecords encodes every record of the collection v on its own. A
+// collection that marshals itself, such as the one a journal record holds,
+// is marshalled whole and split into its records.
+func encodeRecords(v interface{}) ([]json.RawMessage, error) {
+	if c, ok := v.(elementer); ok {
+		v = c.elements()
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	_, marshaler := v.(json.Marshaler)
+	if marshaler || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("JSON marshal failed: %w", err)
+		}
+
+		var values []json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("value is not a collection: %w", err)
+		}
+		return values, nil
+	}
+
+	values := make([]json.RawMessage, rv.Len())
+	for i := range values {
+		// Through a pointer, as json.Marshal of the whole slice would
+		elem := rv.Index(i)
+		if elem.CanAddr() {
+			elem = elem.Addr()
+		}
+		value, err := json.Marshal(elem.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("JSON marshal failed: %w", err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// recordKey extracts the identifying field from an encoded record
+func (s *LogStorage) recordKey(value json.RawMessage) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return "", fmt.Errorf("record is not an object: %w", err)
+	}
+
+	var key string
+	if err := json.Unmarshal(fields[s.key], &key); err != nil || key == "" {
+		return "", fmt.Errorf("record has no %s", s.key)
+	}
+
+	return key, nil
+}
+
+// append writes entries to the end of the log and syncs it to disk. A
+// failed append is cut off again, so the log never holds a torn entry
+// followed by later ones.
+func (s *LogStorage) append(entries []logEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("JSON marshal failed: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	offset, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("log seek failed: %w", err)
+	}
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return s.rollback(offset, fmt.Errorf("log append failed: %w", err))
+	}
+	if err := s.file.Sync(); err != nil {
+		return s.rollback(offset, fmt.Errorf("log sync failed: %w", err))
+	}
+
+	s.entries += len(entries)
+	s.touch()
+	return nil
+}
+
+// rollback cuts the log back to offset after a failed append. If that fails
+// too, the storage takes no more writes, as they would land after a torn
+// entry and be lost on replay.
+func (s *LogStorage) rollback(offset int64, cause error) error {
+	err := s.file.Truncate(offset)
+	if err == nil {
+		_, err = s.file.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		s.touch()
+		return cause
+	}
+
+	s.broken = fmt.Errorf("log is damaged, restart to repair it: %w", errors.Join(cause, err))
+	return s.broken
+}
+
+// compact rewrites the log so that it holds one entry per live record
+func (s *LogStorage) compact() error {
+	tempFile := s.filePath + ".tmp"
+
+	file, err := os.OpenFile(tempFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, core.FilePerm)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, key := range s.order {
+		line, err := json.Marshal(logEntry{Op: opPut, Key: key, Value: s.records[key]})
+		if err == nil {
+			_, err = writer.Write(append(line, '\n'))
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(tempFile)
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := os.Rename(tempFile, s.filePath); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return err
+	}
+
+	// The compacted file is the log now; its handle is kept for appending
+	s.file.Close()
+	s.file = file
+	s.entries = len(s.order)
+	s.compactAt = compactMinEntries
+	s.touch()
+
+	return syncDir(filepath.Dir(s.filePath))
+}
+
+// Close waits for a write in progress and closes the log. Every append is
+// synced before Save returns, so there is nothing left to flush.
+func (s *LogStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return fmt.Errorf("log close failed: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that the log is open and still on disk. Its content was
+// checked entry by entry when it was replayed.
+func (s *LogStorage) Validate() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.file == nil {
+		return ErrStorageClosed
+	}
+	if s.broken != nil {
+		return s.broken
+	}
+	if _, err := os.Stat(s.filePath); err != nil {
+		return fmt.Errorf("log stat failed: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the log and all records
+func (s *LogStorage) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrStorageClosed
+	}
+
+	if err := s.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.records = make(map[string]json.RawMessage)
+	s.hashes = make(map[string]recordHash)
+	s.keys = make(map[recordHash]string)
+	s.order = nil
+	s.entries = 0
+	s.compactAt = compactMinEntries
+	s.broken = nil
+	s.version++
+	s.touch()
+	return nil
+}
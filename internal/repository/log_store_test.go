@@ -0,0 +1,467 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestLogStorageReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		log      string
+		want     []string
+		wantLog  string // content of the log after replay, if it changes
+		wantErr  bool
+		wantSize int // entries counted
+	}{
+		{name: "empty", log: "", want: []string{}},
+		{
+			name:     "puts",
+			log:      `{"op":"put","key":"a","value":{"supplier_id":"a"}}` + "\n" + `{"op":"put","key":"b","value":{"supplier_id":"b"}}` + "\n",
+			want:     []string{"a", "b"},
+			wantSize: 2,
+		},
+		{
+			name:     "update keeps the position",
+			log:      `{"op":"put","key":"a","value":{"supplier_id":"a"}}` + "\n" + `{"op":"put","key":"b","value":{"supplier_id":"b"}}` + "\n" + `{"op":"put","key":"a","value":{"supplier_id":"a","name":"A"}}` + "\n",
+			want:     []string{"a", "b"},
+			wantSize: 3,
+		},
+		{
+			name:     "delete",
+			log:      `{"op":"put","key":"a","value":{"supplier_id":"a"}}` + "\n" + `{"op":"put","key":"b","value":{"supplier_id":"b"}}` + "\n" + `{"op":"del","key":"a"}` + "\n",
+			want:     []string{"b"},
+			wantSize: 3,
+		},
+		{
+			name:     "delete of a missing key",
+			log:      `{"op":"del","key":"x"}` + "\n",
+			want:     []string{},
+			wantSize: 1,
+		},
+		{
+			name:     "torn last entry is dropped",
+			log:      `{"op":"put","key":"a","value":{"supplier_id":"a"}}` + "\n" + `{"op":"put","key":"b","val`,
+			want:     []string{"a"},
+			wantLog:  `{"op":"put","key":"a","value":{"supplier_id":"a"}}` + "\n",
+			wantSize: 1,
+		},
+		{
+			name:    "torn entry in the middle",
+			log:     `{"op":"put","key":"a","val` + "\n" + `{"op":"put","key":"b","value":{"supplier_id":"b"}}` + "\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suppliers.log")
+			if err := os.WriteFile(path, []byte(tt.log), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			storage, err := NewLogStorage(path, "supplier_id")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLogStorage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer storage.Close()
+
+			if got := storedIDs(t, storage); !equalIDs(got, tt.want) {
+				t.Errorf("records = %v, want %v", got, tt.want)
+			}
+			if storage.entries != tt.wantSize {
+				t.Errorf("entries = %d, want %d", storage.entries, tt.wantSize)
+			}
+			if tt.wantLog != "" {
+				data, _ := os.ReadFile(path)
+				if string(data) != tt.wantLog {
+					t.Errorf("log after replay = %q, want %q", data, tt.wantLog)
+				}
+			}
+		})
+	}
+}
+
+func TestLogStorageSave(t *testing.T) {
+	tests := []struct {
+		name        string
+		saves       [][]string // IDs of each saved collection
+		wantEntries int
+	}{
+		{name: "nothing changed", saves: [][]string{{"a", "b"}, {"a", "b"}}, wantEntries: 2},
+		{name: "added", saves: [][]string{{"a"}, {"a", "b"}}, wantEntries: 2},
+		{name: "removed", saves: [][]string{{"a", "b"}, {"b"}}, wantEntries: 3},
+		{name: "cleared", saves: [][]string{{"a", "b"}, {}}, wantEntries: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suppliers.log")
+			storage, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() error = %v", err)
+			}
+
+			for _, ids := range tt.saves {
+				suppliers := make([]models.Supplier, len(ids))
+				for i, id := range ids {
+					suppliers[i] = models.Supplier{ID: id}
+				}
+				if err := storage.Save(suppliers); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			if storage.entries != tt.wantEntries {
+				t.Errorf("entries = %d, want %d", storage.entries, tt.wantEntries)
+			}
+			if err := storage.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			// What was saved is what a new process reads back
+			reopened, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() on reopen error = %v", err)
+			}
+			defer reopened.Close()
+
+			want := tt.saves[len(tt.saves)-1]
+			if got := storedIDs(t, reopened); !equalIDs(got, want) {
+				t.Errorf("records after reopen = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLogStorageSaveByHash(t *testing.T) {
+	named := func(names ...string) []models.Supplier {
+		suppliers := make([]models.Supplier, len(names))
+		for i, name := range names {
+			suppliers[i] = models.Supplier{ID: string(rune('a' + i)), Name: name}
+		}
+		return suppliers
+	}
+
+	tests := []struct {
+		name        string
+		saves       []interface{}
+		wantNames   []string
+		wantEntries int
+	}{
+		{name: "unchanged", saves: []interface{}{named("x", "y"), named("x", "y")}, wantNames: []string{"x", "y"}, wantEntries: 2},
+		{name: "one changed", saves: []interface{}{named("x", "y"), named("x", "z")}, wantNames: []string{"x", "z"}, wantEntries: 3},
+		{name: "changed back", saves: []interface{}{named("x"), named("y"), named("x")}, wantNames: []string{"x"}, wantEntries: 3},
+		{name: "swapped", saves: []interface{}{named("x", "y"), named("y", "x")}, wantNames: []string{"y", "x"}, wantEntries: 4},
+		{name: "through a pointer", saves: []interface{}{named("x"), &[]models.Supplier{{ID: "a", Name: "x"}}}, wantNames: []string{"x"}, wantEntries: 1},
+		{
+			name:        "encoded as JSON",
+			saves:       []interface{}{named("x", "y"), json.RawMessage(`[{"supplier_id":"a","name":"x"},{"supplier_id":"b","name":"w"}]`)},
+			wantNames:   []string{"x", "w"},
+			wantEntries: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewLogStorage(filepath.Join(t.TempDir(), "suppliers.log"), "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() error = %v", err)
+			}
+			defer storage.Close()
+
+			for _, v := range tt.saves {
+				if err := storage.Save(v); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			var suppliers []models.Supplier
+			if err := storage.Retrieve(&suppliers); err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			got := make([]string, len(suppliers))
+			for i, supplier := range suppliers {
+				got[i] = supplier.Name
+			}
+			if !equalIDs(got, tt.wantNames) {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+			if storage.entries != tt.wantEntries {
+				t.Errorf("entries = %d, want %d", storage.entries, tt.wantEntries)
+			}
+			// Every live record is hashed, and nothing else
+			if len(storage.hashes) != len(storage.records) || len(storage.keys) != len(storage.records) {
+				t.Errorf("%d hashes and %d keys for %d records", len(storage.hashes), len(storage.keys), len(storage.records))
+			}
+		})
+	}
+}
+
+func TestLogStorageFollowsFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, other *LogStorage)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, other *LogStorage) {},
+			want:   []string{"a"},
+		},
+		{
+			name: "appended to",
+			change: func(t *testing.T, other *LogStorage) {
+				if err := other.Save([]models.Supplier{{ID: "a", Name: "a"}, {ID: "b"}}); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "compacted",
+			change: func(t *testing.T, other *LogStorage) {
+				if err := other.Save([]models.Supplier{{ID: "c"}}); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+				other.mu.Lock()
+				defer other.mu.Unlock()
+				if err := other.compact(); err != nil {
+					t.Fatalf("compact() error = %v", err)
+				}
+			},
+			want: []string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "suppliers.log")
+			storage, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() error = %v", err)
+			}
+			defer storage.Close()
+			table := newTable(Storage(storage), supplierKey)
+			if err := addSupplier(ctx, table, "a"); err != nil {
+				t.Fatalf("addSupplier() error = %v", err)
+			}
+			before, err := storage.Stamp()
+			if err != nil {
+				t.Fatalf("Stamp() error = %v", err)
+			}
+
+			// Another process opens the same log and changes it
+			other, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() error = %v", err)
+			}
+			tt.change(t, other)
+			other.Close()
+
+			after, err := storage.Stamp()
+			if err != nil {
+				t.Fatalf("Stamp() error = %v", err)
+			}
+			if changed := after != before; changed != (tt.name != "unchanged") {
+				t.Errorf("stamp %q became %q", before, after)
+			}
+
+			all, err := table.all(ctx)
+			if err != nil {
+				t.Fatalf("all() error = %v", err)
+			}
+			got := make([]string, len(all))
+			for i, supplier := range all {
+				got[i] = supplier.ID
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("table = %v, want %v", got, tt.want)
+			}
+
+			// A write lands in the file on disk, not a replaced one
+			if err := addSupplier(ctx, table, "z"); err != nil {
+				t.Fatalf("addSupplier() error = %v", err)
+			}
+			reopened, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() on reopen error = %v", err)
+			}
+			defer reopened.Close()
+			if got := storedIDs(t, reopened); !equalIDs(got, append(tt.want, "z")) {
+				t.Errorf("log on disk = %v, want %v", got, append(tt.want, "z"))
+			}
+		})
+	}
+}
+
+func TestLogStorageAppend(t *testing.T) {
+	tests := []struct {
+		name        string
+		appends     [][]string // IDs of each appended collection
+		want        []string
+		wantEntries int
+	}{
+		{name: "new records", appends: [][]string{{"a", "b"}, {"c"}}, want: []string{"a", "b", "c"}, wantEntries: 3},
+		{name: "stored records are skipped", appends: [][]string{{"a", "b"}, {"b", "c"}}, want: []string{"a", "b", "c"}, wantEntries: 3},
+		{name: "repeated within one append", appends: [][]string{{"a", "a"}}, want: []string{"a"}, wantEntries: 1},
+		{name: "nothing new", appends: [][]string{{"a"}, {"a"}, {}}, want: []string{"a"}, wantEntries: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "suppliers.log")
+			storage, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() error = %v", err)
+			}
+
+			for _, ids := range tt.appends {
+				suppliers := make([]models.Supplier, len(ids))
+				for i, id := range ids {
+					suppliers[i] = models.Supplier{ID: id}
+				}
+				if err := storage.Append(suppliers); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			if storage.entries != tt.wantEntries {
+				t.Errorf("entries = %d, want %d", storage.entries, tt.wantEntries)
+			}
+			if err := storage.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			reopened, err := NewLogStorage(path, "supplier_id")
+			if err != nil {
+				t.Fatalf("NewLogStorage() on reopen error = %v", err)
+			}
+			defer reopened.Close()
+
+			if got := storedIDs(t, reopened); !equalIDs(got, tt.want) {
+				t.Errorf("records after reopen = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogStorageSaveRejectsRecordsWithoutKey(t *testing.T) {
+	storage, err := NewLogStorage(filepath.Join(t.TempDir(), "suppliers.log"), "supplier_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() error = %v", err)
+	}
+	defer storage.Close()
+
+	for _, v := range []interface{}{
+		[]models.Supplier{{Name: "no id"}},
+		[]string{"not an object"},
+		map[string]string{"not": "a collection"},
+	} {
+		if err := storage.Save(v); err == nil {
+			t.Errorf("Save(%v) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestLogStorageCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppliers.log")
+	storage, err := NewLogStorage(path, "supplier_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() error = %v", err)
+	}
+
+	// Rewriting the same two records grows the log until it is compacted
+	for i := 0; i <= compactMinEntries; i++ {
+		suppliers := []models.Supplier{{ID: "a", Name: fmt.Sprint(i)}, {ID: "b"}}
+		if err := storage.Save(suppliers); err != nil {
+			t.Fatalf("Save() %d error = %v", i, err)
+		}
+	}
+	if storage.entries >= compactMinEntries {
+		t.Fatalf("entries = %d, want the log compacted", storage.entries)
+	}
+
+	// The log takes appends after compaction
+	if err := storage.Save([]models.Supplier{{ID: "a", Name: "last"}, {ID: "b"}, {ID: "c"}}); err != nil {
+		t.Fatalf("Save() after compaction error = %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= compactMinEntries {
+		t.Errorf("log has %d lines after compaction", lines)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left after compaction: %v", err)
+	}
+
+	reopened, err := NewLogStorage(path, "supplier_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() on reopen error = %v", err)
+	}
+	defer reopened.Close()
+
+	var suppliers []models.Supplier
+	if err := reopened.Retrieve(&suppliers); err != nil {
+		t.Fatalf("Retrieve() error = %v", err)
+	}
+	if len(suppliers) != 3 || suppliers[0].Name != "last" || suppliers[2].ID != "c" {
+		t.Errorf("records after compaction = %+v", suppliers)
+	}
+}
+
+func TestLogStorageFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppliers.log")
+	storage, err := NewLogStorage(path, "supplier_id")
+	if err != nil {
+		t.Fatalf("NewLogStorage() error = %v", err)
+	}
+	if err := storage.Save([]models.Supplier{{ID: "a"}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	before, _ := os.ReadFile(path)
+
+	// A read-only handle fails both the write and the truncate after it
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.file.Close()
+	storage.file = readOnly
+	defer storage.Close()
+
+	if err := storage.Save([]models.Supplier{{ID: "a"}, {ID: "b"}}); err == nil {
+		t.Fatal("Save() succeeded on a read-only log")
+	}
+	if got := storedIDs(t, storage); !equalIDs(got, []string{"a"}) {
+		t.Errorf("records after failed save = %v, want [a]", got)
+	}
+
+	// Nothing may be appended after an append that could not be taken back
+	if err := storage.Save([]models.Supplier{{ID: "c"}}); err == nil {
+		t.Error("Save() succeeded on a damaged log")
+	}
+	if err := storage.Validate(); err == nil {
+		t.Error("Validate() succeeded on a damaged log")
+	}
+
+	after, _ := os.ReadFile(path)
+	if string(after) != string(before) {
+		t.Errorf("log changed by failed saves: %q, want %q", after, before)
+	}
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// MemoryStorage keeps the collection in memory only. Nothing survives a
+// restart, which makes it suitable for tests and throwaway instances.
+type MemoryStorage struct {
+	name    string
+	mu      sync.RWMutex
+	data    []byte
+	version uint64
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage(name string) *MemoryStorage {
+	return &MemoryStorage{name: name, data: []byte("[]")}
+}
+
+// Name returns the name the storage is known by in the journal
+func (s *MemoryStorage) Name() string {
+	return s.name
+}
+
+// Stamp identifies the current version of the collection
+func (s *MemoryStorage) Stamp() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return strconv.FormatUint(s.version, 10), nil
+}
+
+// Retrieve unmarshals the stored collection into v
+func (s *MemoryStorage) Retrieve(v interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := json.Unmarshal(s.data, v); err != nil {
+		return fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+	return nil
+}
+
+// Save replaces the stored collection with v
+func (s *MemoryStorage) Save(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("JSON marshal failed: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = data
+	s.version++
+	return nil
+}
+
+// Append adds the records of the collection v after the stored ones. No
+// journal is ever replayed into memory, so they are not checked against the
+// stored records.
+func (s *MemoryStorage) Append(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("JSON marshal failed: %w", err)
+	}
+
+	var added []json.RawMessage
+	if err := json.Unmarshal(data, &added); err != nil {
+		return fmt.Errorf("value is not a collection: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []json.RawMessage
+	if err := json.Unmarshal(s.data, &stored); err != nil {
+		return fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+	if s.data, err = json.Marshal(append(stored, added...)); err != nil {
+		return fmt.Errorf("JSON marshal failed: %w", err)
+	}
+	s.version++
+	return nil
+}
+
+// Close does nothing, as nothing is kept beyond the process
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// Validate always succeeds, the collection is only ever written by Save
+func (s *MemoryStorage) Validate() error {
+	return nil
+}
+
+// Clear empties the collection
+func (s *MemoryStorage) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = []byte("[]")
+	s.version++
+	return nil
+}
@@ -1,165 +1,157 @@
 package repository
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 type MenuRepository interface {
-	Create(item *models.MenuItem) error
-	GetByID(id string) (*models.MenuItem, error)
-	GetAll() (*[]models.MenuItem, error)
-	Update(item *models.MenuItem) error
-	Delete(id string) error
+	Create(ctx context.Context, item *models.MenuItem) error
+	GetByID(ctx context.Context, id string) (*models.MenuItem, error)
+	GetAll(ctx context.Context) (*[]models.MenuItem, error)
+	List(ctx context.Context, filter models.MenuFilter, opts models.ListOptions) (*[]models.MenuItem, int, error)
+	Update(ctx context.Context, item *models.MenuItem) error
+	Delete(ctx context.Context, id string) error
 
-	GetRequiredIngredients(id string) (*[]models.MenuItemIngredient, error)
+	GetRequiredIngredients(ctx context.Context, id string) (*[]models.MenuItemIngredient, error)
+	GetByIngredient(ctx context.Context, ingredientID string) (*[]models.MenuItem, error)
+
+	WithTx(tx *Tx) MenuRepository
 }
 
 // MenuRepository manages menu data
 type menuRepository struct {
-	storage *JSONStorage
-	log     *slog.Logger
+	items collection[models.MenuItem]
+	log   *slog.Logger
 }
 
 // NewMenuRepository initializes a MenuRepository with storage and logging
-func NewMenuRepository(storage *JSONStorage, log *slog.Logger) *menuRepository {
+func NewMenuRepository(storage Storage, log *slog.Logger) *menuRepository {
 	return &menuRepository{
-		storage: storage,
-		log:     log,
+		items: newTable(storage, func(item models.MenuItem) string { return item.ID }),
+		log:   log,
 	}
 }
 
-// loadItems is a helper function to retrieve items from storage
-func (r *menuRepository) loadItems() (*[]models.MenuItem, error) {
-	var items []models.MenuItem
-	if err := r.storage.Retrieve(&items); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrStorageOperation, err)
-	}
-	return &items, nil
-}
-
-// saveItems is a helper function to save items to storage
-func (r *menuRepository) saveItems(items *[]models.MenuItem) error {
-	if err := r.storage.Save(items); err != nil {
-		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *menuRepository) WithTx(tx *Tx) MenuRepository {
+	return &menuRepository{
+		items: r.items.withTx(tx),
+		log:   r.log,
 	}
-	return nil
 }
 
-func (r *menuRepository) Create(item *models.MenuItem) error {
-	r.log.Info("creating menu item", "id", item.ID)
+func (r *menuRepository) Create(ctx context.Context, item *models.MenuItem) error {
+	r.log.InfoContext(ctx, "creating menu item", "id", item.ID)
 
-	items, err := r.loadItems()
+	err := r.items.mutate(ctx, func(items *records[models.MenuItem]) error {
+		return items.add(*item)
+	})
 	if err != nil {
-		return err
-	}
-
-	*items = append(*items, *item)
-
-	if err := r.saveItems(items); err != nil {
-		r.log.Error("failed to save new menu item", "error", err, "id", item.ID)
+		r.log.ErrorContext(ctx, "failed to save new menu item", "error", err, "id", item.ID)
 		return err
 	}
 
 	return nil
 }
 
-func (r *menuRepository) GetByID(id string) (*models.MenuItem, error) {
-	r.log.Info("retrieving menu item", "id", id)
+func (r *menuRepository) GetByID(ctx context.Context, id string) (*models.MenuItem, error) {
+	r.log.InfoContext(ctx, "retrieving menu item", "id", id)
 
-	items, err := r.loadItems()
+	item, err := r.items.get(ctx, id)
 	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load menu items", "error", err)
 		return nil, err
 	}
 
-	for _, item := range *items {
-		if item.ID == id {
-			itemCopy := item // Create a copy to avoid data races
-			return &itemCopy, nil
-		}
-	}
-
-	return nil, nil
+	return item, nil
 }
 
-func (r *menuRepository) GetAll() (*[]models.MenuItem, error) {
-	r.log.Info("retrieving all menu items")
+func (r *menuRepository) GetAll(ctx context.Context) (*[]models.MenuItem, error) {
+	r.log.InfoContext(ctx, "retrieving all menu items")
 
-	items, err := r.loadItems()
+	items, err := r.items.all(ctx)
 	if err != nil {
-		r.log.Error("failed to load menu items", "error", err)
+		r.log.ErrorContext(ctx, "failed to load menu items", "error", err)
 		return nil, err
 	}
 
-	return items, nil
+	return &items, nil
 }
 
-func (r *menuRepository) Update(item *models.MenuItem) error {
-	r.log.Info("updating menu item", "id", item.ID)
+// List returns the page of menu items that pass the filter, along with the
+// number of items that pass it
+func (r *menuRepository) List(ctx context.Context, filter models.MenuFilter, opts models.ListOptions) (*[]models.MenuItem, int, error) {
+	r.log.InfoContext(ctx, "listing menu items", "offset", opts.Offset, "limit", opts.Limit, "sort", opts.Sort)
 
-	items, err := r.loadItems()
+	items, total, err := r.items.list(ctx, newQuery(filter.Includes, menuLess(opts.Sort), menuLess("product_id"), opts))
 	if err != nil {
-		return err
+		r.log.ErrorContext(ctx, "failed to load menu items", "error", err)
+		return nil, 0, err
 	}
 
-	for i, existing := range *items {
-		if existing.ID == item.ID {
-			(*items)[i] = *item
+	return &items, total, nil
+}
 
-			if err := r.saveItems(items); err != nil {
-				r.log.Error("failed to save updated menu item", "error", err, "id", item.ID)
-				return err
-			}
+func (r *menuRepository) Update(ctx context.Context, item *models.MenuItem) error {
+	r.log.InfoContext(ctx, "updating menu item", "id", item.ID)
 
-			break
-		}
+	err := r.items.mutate(ctx, func(items *records[models.MenuItem]) error {
+		return items.update(*item)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated menu item", "error", err, "id", item.ID)
+		return err
 	}
 
 	return nil
 }
 
-func (r *menuRepository) Delete(id string) error {
-	r.log.Info("deleting menu item", "id", id)
+func (r *menuRepository) Delete(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "deleting menu item", "id", id)
 
-	items, err := r.loadItems()
+	err := r.items.mutate(ctx, func(items *records[models.MenuItem]) error {
+		items.remove(id)
+		return nil
+	})
 	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated menu items", "error", err)
 		return err
 	}
 
-	for i, item := range *items {
-		if item.ID == id {
-			(*items)[i], (*items)[len(*items)-1] = (*items)[len(*items)-1], (*items)[i]
-			*items = (*items)[:len(*items)-1]
+	return nil
+}
+
+func (r *menuRepository) GetRequiredIngredients(ctx context.Context, id string) (*[]models.MenuItemIngredient, error) {
+	r.log.InfoContext(ctx, "retrieving required ingredients", "menu_item_id", id)
 
-			if err := r.saveItems(items); err != nil {
-				r.log.Error("failed to save updated menu items", "error", err)
-				return err
-			}
+	item, err := r.items.get(ctx, id)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load menu items", "error", err)
+		return nil, err
+	}
 
-			break
-		}
+	if item == nil {
+		return nil, nil
 	}
 
-	return nil
+	ingredients := make([]models.MenuItemIngredient, len(item.Ingredients))
+	copy(ingredients, item.Ingredients)
+	return &ingredients, nil
 }
 
-func (r *menuRepository) GetRequiredIngredients(id string) (*[]models.MenuItemIngredient, error) {
-	r.log.Info("retrieving required ingredients", "menu_item_id", id)
+// GetByIngredient returns the menu items whose recipe uses the ingredient
+func (r *menuRepository) GetByIngredient(ctx context.Context, ingredientID string) (*[]models.MenuItem, error) {
+	r.log.InfoContext(ctx, "retrieving menu items by ingredient", "ingredient_id", ingredientID)
 
-	items, err := r.loadItems()
+	filter := models.MenuFilter{IngredientID: ingredientID}
+	items, _, err := r.items.list(ctx, newQuery(filter.Includes, nil, menuLess("product_id"), models.ListOptions{}))
 	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load menu items", "error", err)
 		return nil, err
 	}
 
-	for _, item := range *items {
-		if item.ID == id {
-			ingredients := make([]models.MenuItemIngredient, len(item.Ingredients))
-			copy(ingredients, item.Ingredients)
-			return &ingredients, nil
-		}
-	}
-
-	return nil, nil
+	return &items, nil
 }
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type MovementRepository interface {
+	Append(ctx context.Context, movements []models.InventoryMovement) error
+	GetAll(ctx context.Context) ([]models.InventoryMovement, error)
+	GetByIngredient(ctx context.Context, ingredientID string) ([]models.InventoryMovement, error)
+
+	WithTx(tx *Tx) MovementRepository
+}
+
+// movementRepository keeps the inventory ledger. It is append-only: there is
+// no way to change or remove a movement once it is recorded.
+type movementRepository struct {
+	movements appendCollection[models.InventoryMovement]
+	log       *slog.Logger
+}
+
+// NewMovementRepository initializes a MovementRepository with an append-only
+// storage and logging
+func NewMovementRepository(storage Appender, log *slog.Logger) *movementRepository {
+	return &movementRepository{
+		movements: newLedger[models.InventoryMovement](storage),
+		log:       log,
+	}
+}
+
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *movementRepository) WithTx(tx *Tx) MovementRepository {
+	return &movementRepository{
+		movements: r.movements.withTx(tx),
+		log:       r.log,
+	}
+}
+
+// Append records the movements, numbering them in the order they were made.
+// The assigned IDs are written back into movements.
+func (r *movementRepository) Append(ctx context.Context, movements []models.InventoryMovement) error {
+	r.log.InfoContext(ctx, "recording inventory movements", "count", len(movements))
+
+	err := r.movements.append(ctx, func(count int) []models.InventoryMovement {
+		for i := range movements {
+			movements[i].ID = strconv.Itoa(count + i + 1)
+		}
+		return movements
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save inventory movements", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *movementRepository) GetAll(ctx context.Context) ([]models.InventoryMovement, error) {
+	r.log.InfoContext(ctx, "retrieving inventory movements")
+
+	movements, err := r.movements.all(ctx)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load inventory movements", "error", err)
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+// GetByIngredient returns the movements of one ingredient, oldest first
+func (r *movementRepository) GetByIngredient(ctx context.Context, ingredientID string) ([]models.InventoryMovement, error) {
+	r.log.InfoContext(ctx, "retrieving inventory movements", "ingredient_id", ingredientID)
+
+	movements, err := r.movements.all(ctx)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load inventory movements", "error", err)
+		return nil, err
+	}
+
+	var result []models.InventoryMovement
+	for _, movement := range movements {
+		if movement.IngredientID == ingredientID {
+			result = append(result, movement)
+		}
+	}
+
+	return result, nil
+}
@@ -1,172 +1,122 @@
 package repository
 
 import (
-	"fmt"
+	"context"
 	"log/slog"
 
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 type OrderRepository interface {
-	Create(order *models.Order) error
-	GetByID(id string) (*models.Order, error)
-	GetAll() (*[]models.Order, error)
-	Update(order *models.Order) error
-	Delete(id string) error
-	Close(id string) error
+	Create(ctx context.Context, order *models.Order) error
+	GetByID(ctx context.Context, id string) (*models.Order, error)
+	GetAll(ctx context.Context) (*[]models.Order, error)
+	List(ctx context.Context, filter models.OrderFilter, opts models.ListOptions) (*[]models.Order, int, error)
+	Update(ctx context.Context, order *models.Order) error
+	Delete(ctx context.Context, id string) error
+
+	WithTx(tx *Tx) OrderRepository
 }
 
 // OrderRepository manages order data
 type orderRepository struct {
-	storage *JSONStorage
-	log     *slog.Logger
+	orders collection[models.Order]
+	log    *slog.Logger
 }
 
 // NewOrderRepository initializes an OrderRepository with storage and logging
-func NewOrderRepository(storage *JSONStorage, log *slog.Logger) *orderRepository {
+func NewOrderRepository(storage Storage, log *slog.Logger) *orderRepository {
 	return &orderRepository{
-		storage: storage,
-		log:     log,
+		orders: newTable(storage, func(order models.Order) string { return order.ID }),
+		log:    log,
 	}
 }
 
-// loadOrders retrieves all orders from storage
-func (r *orderRepository) loadOrders() (*[]models.Order, error) {
-	var orders []models.Order
-	if err := r.storage.Retrieve(&orders); err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrStorageOperation, err)
-	}
-	return &orders, nil
-}
-
-// saveOrders saves orders to storage
-func (r *orderRepository) saveOrders(orders *[]models.Order) error {
-	if err := r.storage.Save(orders); err != nil {
-		return fmt.Errorf("%w: %v", ErrStorageOperation, err)
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *orderRepository) WithTx(tx *Tx) OrderRepository {
+	return &orderRepository{
+		orders: r.orders.withTx(tx),
+		log:    r.log,
 	}
-	return nil
 }
 
-func (r *orderRepository) Create(order *models.Order) error {
-	r.log.Info("creating new order", "order_id", order.ID)
+func (r *orderRepository) Create(ctx context.Context, order *models.Order) error {
+	r.log.InfoContext(ctx, "creating new order", "order_id", order.ID)
 
-	orders, err := r.loadOrders()
+	err := r.orders.mutate(ctx, func(orders *records[models.Order]) error {
+		return orders.add(*order)
+	})
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
-		return err
-	}
-
-	*orders = append(*orders, *order)
-
-	if err := r.saveOrders(orders); err != nil {
-		r.log.Error("failed to save new order", "error", err, "order_id", order.ID)
+		r.log.ErrorContext(ctx, "failed to save new order", "error", err, "order_id", order.ID)
 		return err
 	}
 
 	return nil
 }
 
-func (r *orderRepository) GetByID(id string) (*models.Order, error) {
-	r.log.Info("retrieving order", "order_id", id)
+func (r *orderRepository) GetByID(ctx context.Context, id string) (*models.Order, error) {
+	r.log.InfoContext(ctx, "retrieving order", "order_id", id)
 
-	orders, err := r.loadOrders()
+	order, err := r.orders.get(ctx, id)
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
+		r.log.ErrorContext(ctx, "failed to load orders", "error", err)
 		return nil, err
 	}
 
-	for _, order := range *orders {
-		if order.ID == id {
-			orderCopy := order
-			return &orderCopy, nil
-		}
-	}
-
-	return nil, nil
+	return order, nil
 }
 
-func (r *orderRepository) GetAll() (*[]models.Order, error) {
-	r.log.Info("retrieving all orders")
+func (r *orderRepository) GetAll(ctx context.Context) (*[]models.Order, error) {
+	r.log.InfoContext(ctx, "retrieving all orders")
 
-	orders, err := r.loadOrders()
+	orders, err := r.orders.all(ctx)
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
+		r.log.ErrorContext(ctx, "failed to load orders", "error", err)
 		return nil, err
 	}
 
-	return orders, nil
+	return &orders, nil
 }
 
-func (r *orderRepository) Update(order *models.Order) error {
-	r.log.Info("updating order", "order_id", order.ID)
+// List returns the page of orders that pass the filter, along with the
+// number of orders that pass it
+func (r *orderRepository) List(ctx context.Context, filter models.OrderFilter, opts models.ListOptions) (*[]models.Order, int, error) {
+	r.log.InfoContext(ctx, "listing orders", "offset", opts.Offset, "limit", opts.Limit, "sort", opts.Sort)
 
-	orders, err := r.loadOrders()
+	orders, total, err := r.orders.list(ctx, newQuery(filter.Includes, orderLess(opts.Sort), orderLess("order_id"), opts))
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
-		return err
+		r.log.ErrorContext(ctx, "failed to load orders", "error", err)
+		return nil, 0, err
 	}
 
-	for i := range *orders {
-		if (*orders)[i].ID == order.ID {
-			(*orders)[i] = *order
-			break
-		}
-	}
-
-	if err := r.saveOrders(orders); err != nil {
-		r.log.Error("failed to save updated order", "error", err, "order_id", order.ID)
-		return err
-	}
-
-	return nil
+	return &orders, total, nil
 }
 
-func (r *orderRepository) Delete(id string) error {
-	r.log.Info("deleting order", "order_id", id)
+func (r *orderRepository) Update(ctx context.Context, order *models.Order) error {
+	r.log.InfoContext(ctx, "updating order", "order_id", order.ID)
 
-	orders, err := r.loadOrders()
+	err := r.orders.mutate(ctx, func(orders *records[models.Order]) error {
+		return orders.update(*order)
+	})
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
-		return err
-	}
-
-	for i := range *orders {
-		if (*orders)[i].ID == id {
-			// Remove the order by swapping with the last element and truncating
-			lastIdx := len(*orders) - 1
-			(*orders)[i] = (*orders)[lastIdx]
-			*orders = (*orders)[:lastIdx]
-			break
-		}
-	}
-
-	if err := r.saveOrders(orders); err != nil {
-		r.log.Error("failed to save orders after deletion", "error", err, "order_id", id)
+		r.log.ErrorContext(ctx, "failed to save updated order", "error", err, "order_id", order.ID)
 		return err
 	}
 
 	return nil
 }
 
-func (r *orderRepository) Close(id string) error {
-	r.log.Info("closing order", "order_id", id)
+func (r *orderRepository) Delete(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "deleting order", "order_id", id)
 
-	orders, err := r.loadOrders()
+	err := r.orders.mutate(ctx, func(orders *records[models.Order]) error {
+		orders.remove(id)
+		return nil
+	})
 	if err != nil {
-		r.log.Error("failed to load orders", "error", err)
+		r.log.ErrorContext(ctx, "failed to save orders after deletion", "error", err, "order_id", id)
 		return err
 	}
 
-	for i := range *orders {
-		if (*orders)[i].ID == id {
-			(*orders)[i].Status = "closed"
-			break
-		}
-	}
-
-	if err := r.saveOrders(orders); err != nil {
-		r.log.Error("failed to save orders after closing", "error", err, "order_id", id)
-		return err
-	}
 	return nil
 }
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestOrderRepositoryCreateExisting(t *testing.T) {
+	ctx := context.Background()
+	orderStorage := NewMemoryStorage(core.OrderFile)
+	supplierStorage := NewMemoryStorage(core.SupplierFile)
+	journal, err := NewJournal("", discardLog, orderStorage, supplierStorage)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+	orders := NewOrderRepository(orderStorage, discardLog)
+	suppliers := newTable(Storage(supplierStorage), supplierKey)
+
+	if err := orders.Create(ctx, &models.Order{ID: "o1", CustomerName: "Ann"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// A clash fails the transaction, taking back what it did before
+	err = journal.Atomically(ctx, func(tx *Tx) error {
+		if err := addSupplier(ctx, suppliers.withTx(tx), "a"); err != nil {
+			return err
+		}
+		return orders.WithTx(tx).Create(ctx, &models.Order{ID: "o1", CustomerName: "Bob"})
+	})
+	if !errors.Is(err, ErrRecordExists) {
+		t.Fatalf("Atomically() error = %v, want ErrRecordExists", err)
+	}
+
+	stored, _ := orders.GetByID(ctx, "o1")
+	if stored.CustomerName != "Ann" {
+		t.Errorf("order o1 = %+v, want the first one kept", stored)
+	}
+	if got := storedIDs(t, supplierStorage); len(got) != 0 {
+		t.Errorf("suppliers = %v, want the transaction rolled back", got)
+	}
+}
+
+func TestOrderRepositoryUpdateMissing(t *testing.T) {
+	ctx := context.Background()
+	orders := NewOrderRepository(NewMemoryStorage(core.OrderFile), discardLog)
+	if err := orders.Create(ctx, &models.Order{ID: "o1", CustomerName: "Ann"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	err := orders.Update(ctx, &models.Order{ID: "o2", CustomerName: "Bob"})
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("Update() error = %v, want ErrRecordNotFound", err)
+	}
+	all, _ := orders.GetAll(ctx)
+	if len(*all) != 1 || (*all)[0].CustomerName != "Ann" {
+		t.Errorf("orders = %+v, want only o1", *all)
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type PurchaseOrderRepository interface {
+	Create(ctx context.Context, order *models.PurchaseOrder) error
+	GetByID(ctx context.Context, id string) (*models.PurchaseOrder, error)
+	GetAll(ctx context.Context) (*[]models.PurchaseOrder, error)
+	Update(ctx context.Context, order *models.PurchaseOrder) error
+	Delete(ctx context.Context, id string) error
+
+	WithTx(tx *Tx) PurchaseOrderRepository
+}
+
+// PurchaseOrderRepository manages purchase order data
+type purchaseOrderRepository struct {
+	orders collection[models.PurchaseOrder]
+	log    *slog.Logger
+}
+
+// NewPurchaseOrderRepository initializes a PurchaseOrderRepository with storage and logging
+func NewPurchaseOrderRepository(storage Storage, log *slog.Logger) *purchaseOrderRepository {
+	return &purchaseOrderRepository{
+		orders: newTable(storage, func(order models.PurchaseOrder) string { return order.ID }),
+		log:    log,
+	}
+}
+
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *purchaseOrderRepository) WithTx(tx *Tx) PurchaseOrderRepository {
+	return &purchaseOrderRepository{
+		orders: r.orders.withTx(tx),
+		log:    r.log,
+	}
+}
+
+func (r *purchaseOrderRepository) Create(ctx context.Context, order *models.PurchaseOrder) error {
+	r.log.InfoContext(ctx, "creating purchase order", "purchase_order_id", order.ID)
+
+	err := r.orders.mutate(ctx, func(orders *records[models.PurchaseOrder]) error {
+		return orders.add(*order)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save new purchase order", "error", err, "purchase_order_id", order.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (r *purchaseOrderRepository) GetByID(ctx context.Context, id string) (*models.PurchaseOrder, error) {
+	r.log.InfoContext(ctx, "retrieving purchase order", "purchase_order_id", id)
+
+	order, err := r.orders.get(ctx, id)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load purchase orders", "error", err)
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (r *purchaseOrderRepository) GetAll(ctx context.Context) (*[]models.PurchaseOrder, error) {
+	r.log.InfoContext(ctx, "retrieving all purchase orders")
+
+	orders, err := r.orders.all(ctx)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load purchase orders", "error", err)
+		return nil, err
+	}
+
+	return &orders, nil
+}
+
+func (r *purchaseOrderRepository) Update(ctx context.Context, order *models.PurchaseOrder) error {
+	r.log.InfoContext(ctx, "updating purchase order", "purchase_order_id", order.ID)
+
+	err := r.orders.mutate(ctx, func(orders *records[models.PurchaseOrder]) error {
+		return orders.update(*order)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated purchase order", "error", err, "purchase_order_id", order.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (r *purchaseOrderRepository) Delete(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "deleting purchase order", "purchase_order_id", id)
+
+	err := r.orders.mutate(ctx, func(orders *records[models.PurchaseOrder]) error {
+		orders.remove(id)
+		return nil
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save purchase orders after deletion", "error", err, "purchase_order_id", id)
+		return err
+	}
+
+	return nil
+}
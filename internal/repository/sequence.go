@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type SequenceRepository interface {
+	Next(ctx context.Context, name string, floor int) (int, error)
+
+	WithTx(tx *Tx) SequenceRepository
+}
+
+// sequenceRepository hands out numbers from named counters
+type sequenceRepository struct {
+	sequences collection[models.Sequence]
+	log       *slog.Logger
+}
+
+// NewSequenceRepository initializes a SequenceRepository with storage and logging
+func NewSequenceRepository(storage Storage, log *slog.Logger) *sequenceRepository {
+	return &sequenceRepository{
+		sequences: newTable(storage, func(sequence models.Sequence) string { return sequence.Name }),
+		log:       log,
+	}
+}
+
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *sequenceRepository) WithTx(tx *Tx) SequenceRepository {
+	return &sequenceRepository{
+		sequences: r.sequences.withTx(tx),
+		log:       r.log,
+	}
+}
+
+// Next advances the named counter and returns its new value. The counter
+// is first raised to floor, so numbers already in use from before the
+// counter existed are skipped.
+func (r *sequenceRepository) Next(ctx context.Context, name string, floor int) (int, error) {
+	var value int
+	err := r.sequences.mutate(ctx, func(sequences *records[models.Sequence]) error {
+		sequence, ok := sequences.get(name)
+		if !ok {
+			sequence = &models.Sequence{Name: name}
+		}
+		sequence.Value = max(sequence.Value, floor) + 1
+		sequences.put(*sequence)
+		value = sequence.Value
+		return nil
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save sequence", "error", err, "sequence", name)
+		return 0, err
+	}
+
+	r.log.InfoContext(ctx, "advanced sequence", "sequence", name, "value", value)
+	return value, nil
+}
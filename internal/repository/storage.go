@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+)
+
+var (
+	ErrStorageOperation = errors.New("storage operation failed")
+	ErrStorageClosed    = errors.New("storage is closed")
+)
+
+// Storage persists one collection of records. Retrieve and Save work on the
+// whole collection, encoded the same way as a JSON array of records.
+// Stamp changes whenever the stored content may have changed, including
+// edits made behind the storage's back. Close waits for a Save in progress
+// and makes everything saved durable; no Save succeeds after it. Validate
+// reports whether the storage can be used.
+type Storage interface {
+	Name() string
+	Retrieve(v interface{}) error
+	Save(v interface{}) error
+	Clear() error
+	Stamp() (string, error)
+	Close() error
+	Validate() error
+}
+
+// Appender is a storage for a collection that only ever grows. Append adds
+// the records of a collection without rewriting the ones stored, so a write
+// costs the size of the new records. A record whose key is stored already
+// is skipped, which makes an append safe to replay.
+type Appender interface {
+	Storage
+	Append(v interface{}) error
+}
+
+// NewStorage creates the storage backend of the given kind for one of the
+// collection files in dir
+func NewStorage(kind, dir, filename string) (Storage, error) {
+	switch kind {
+	case core.StorageJSON:
+		storage, err := NewJSONStorage(filepath.Join(dir, filename))
+		if err != nil {
+			return nil, err
+		}
+		return instrument(storage), nil
+	case core.StorageLog:
+		key := determineKey(filename)
+		if key == "" {
+			return nil, fmt.Errorf("unsupported file type: %s", filename)
+		}
+		logFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".log"
+		storage, err := NewLogStorage(filepath.Join(dir, logFile), key)
+		if err != nil {
+			return nil, err
+		}
+		return instrument(storage), nil
+	case core.StorageMemory:
+		return instrument(NewMemoryStorage(filename)), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", kind)
+	}
+}
+
+// NewLedgerStorage creates the storage of an append-only collection in dir.
+// Both file backends keep it as a log, as rewriting a JSON array on every
+// append would make each write cost the size of the whole history. A
+// collection an earlier version kept as a JSON array is moved into the log.
+func NewLedgerStorage(kind, dir, filename string) (Appender, error) {
+	switch kind {
+	case core.StorageJSON, core.StorageLog:
+		key := determineKey(filename)
+		if key == "" {
+			return nil, fmt.Errorf("unsupported file type: %s", filename)
+		}
+		logFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".log"
+		storage, err := NewLogStorage(filepath.Join(dir, logFile), key)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateToLog(filepath.Join(dir, filename), storage); err != nil {
+			storage.Close()
+			return nil, fmt.Errorf("storage migration failed: %w", err)
+		}
+		return instrumentAppender(storage), nil
+	case core.StorageMemory:
+		return instrumentAppender(NewMemoryStorage(filename)), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", kind)
+	}
+}
+
+// migrateToLog appends the records of the JSON array at path to the log and
+// removes the file. Records already in the log are skipped, so a migration
+// cut short is simply run again on the next start.
+func migrateToLog(path string, storage *LogStorage) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	if err := storage.Append(records); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// determineKey returns the JSON field that identifies a record in the file
+func determineKey(filename string) string {
+	switch filename {
+	case core.MenuFile:
+		return "product_id"
+	case core.InventoryFile:
+		return "ingredient_id"
+	case core.OrderFile:
+		return "order_id"
+	case core.MovementFile:
+		return "movement_id"
+	case core.SupplierFile:
+		return "supplier_id"
+	case core.PurchaseFile:
+		return "purchase_order_id"
+	case core.UserFile:
+		return "username"
+	case core.SequenceFile:
+		return "name"
+	default:
+		return ""
+	}
+}
+
+// CheckWritable makes sure files can be created, written and removed in dir
+func CheckWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("file create failed: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write([]byte("ok")); err != nil {
+		file.Close()
+		return fmt.Errorf("file write failed: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("file sync failed: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("file close failed: %w", err)
+	}
+	return nil
+}
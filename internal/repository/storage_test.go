@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestStorageBackends(t *testing.T) {
+	tests := []struct {
+		kind    string
+		durable bool // content survives reopening and Close stops saves
+	}{
+		{kind: core.StorageJSON, durable: true},
+		{kind: core.StorageLog, durable: true},
+		{kind: core.StorageMemory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			dir := t.TempDir()
+			storage, err := NewStorage(tt.kind, dir, core.SupplierFile)
+			if err != nil {
+				t.Fatalf("NewStorage() error = %v", err)
+			}
+
+			if got := storedIDs(t, storage); len(got) != 0 {
+				t.Fatalf("new storage holds %v", got)
+			}
+			if err := storage.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			stamp, err := storage.Stamp()
+			if err != nil {
+				t.Fatalf("Stamp() error = %v", err)
+			}
+			if err := storage.Save([]models.Supplier{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if next, _ := storage.Stamp(); next == stamp {
+				t.Errorf("Stamp() = %q unchanged by Save", next)
+			}
+			if got := storedIDs(t, storage); !equalIDs(got, []string{"a", "b"}) {
+				t.Errorf("records = %v, want [a b]", got)
+			}
+
+			if err := storage.Save([]models.Supplier{{ID: "b", Name: "B"}}); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if got := storedIDs(t, storage); !equalIDs(got, []string{"b"}) {
+				t.Errorf("records = %v, want [b]", got)
+			}
+
+			if err := storage.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if !tt.durable {
+				return
+			}
+
+			if err := storage.Save([]models.Supplier{{ID: "c"}}); !errors.Is(err, ErrStorageClosed) {
+				t.Errorf("Save() after Close error = %v, want ErrStorageClosed", err)
+			}
+
+			reopened, err := NewStorage(tt.kind, dir, core.SupplierFile)
+			if err != nil {
+				t.Fatalf("NewStorage() on reopen error = %v", err)
+			}
+			defer reopened.Close()
+			if got := storedIDs(t, reopened); !equalIDs(got, []string{"b"}) {
+				t.Errorf("records after reopen = %v, want [b]", got)
+			}
+		})
+	}
+}
+
+func TestNewStorageCleansUp(t *testing.T) {
+	tests := []struct {
+		kind string
+		file string
+	}{
+		{core.StorageJSON, core.SupplierFile},
+		{core.StorageLog, "suppliers.log"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			dir := t.TempDir()
+			leftover := filepath.Join(dir, tt.file+".tmp")
+			if err := os.WriteFile(leftover, []byte(`[{"supplier_id":"half written`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			storage, err := NewStorage(tt.kind, dir, core.SupplierFile)
+			if err != nil {
+				t.Fatalf("NewStorage() error = %v", err)
+			}
+			defer storage.Close()
+
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("temporary file left: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewStorageUnsupported(t *testing.T) {
+	tests := []struct {
+		kind string
+		file string
+	}{
+		{"sqlite", core.SupplierFile},
+		{core.StorageJSON, "unknown.json"},
+		{core.StorageLog, "unknown.json"},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewStorage(tt.kind, t.TempDir(), tt.file); err == nil {
+			t.Errorf("NewStorage(%q, %q) succeeded, want an error", tt.kind, tt.file)
+		}
+	}
+}
+
+func TestNewLedgerStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		json    string // content of an inventory_movements.json left by an earlier version
+		log     string // content of the log before the start
+		want    []string
+		wantErr bool
+	}{
+		{name: "new", kind: core.StorageJSON, want: []string{}},
+		{name: "memory", kind: core.StorageMemory, want: []string{}},
+		{
+			name: "JSON array is moved into the log",
+			kind: core.StorageJSON,
+			json: `[{"movement_id":"1","delta":5},{"movement_id":"2","delta":-1}]`,
+			want: []string{"1", "2"},
+		},
+		{
+			name: "interrupted migration is finished",
+			kind: core.StorageLog,
+			json: `[{"movement_id":"1","delta":5},{"movement_id":"2","delta":-1}]`,
+			log:  `{"op":"put","key":"1","value":{"movement_id":"1","delta":5}}` + "\n",
+			want: []string{"1", "2"},
+		},
+		{name: "unreadable JSON array", kind: core.StorageJSON, json: `[{"movement_id":`, wantErr: true},
+		{name: "unsupported backend", kind: "sqlite", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			jsonPath := filepath.Join(dir, core.MovementFile)
+			if tt.json != "" {
+				if err := os.WriteFile(jsonPath, []byte(tt.json), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.log != "" {
+				if err := os.WriteFile(filepath.Join(dir, "inventory_movements.log"), []byte(tt.log), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			storage, err := NewLedgerStorage(tt.kind, dir, core.MovementFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLedgerStorage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer storage.Close()
+
+			var stored []models.InventoryMovement
+			if err := storage.Retrieve(&stored); err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			got := make([]string, len(stored))
+			for i, movement := range stored {
+				got[i] = movement.ID
+			}
+			if !equalIDs(got, tt.want) {
+				t.Errorf("movements = %v, want %v", got, tt.want)
+			}
+			if _, err := os.Stat(jsonPath); tt.json != "" && !os.IsNotExist(err) {
+				t.Errorf("%s left after migration: %v", core.MovementFile, err)
+			}
+		})
+	}
+}
+
+func TestJSONStorageValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "records", content: `[{"supplier_id":"a","name":"A"}]`},
+		{name: "empty array", content: `[]`},
+		{name: "empty file", content: ``, wantErr: true},
+		{name: "not JSON", content: `[{"supplier_id":`, wantErr: true},
+		{name: "wrong shape", content: `{"supplier_id":"a"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), core.SupplierFile)
+			storage, err := NewJSONStorage(path)
+			if err != nil {
+				t.Fatalf("NewJSONStorage() error = %v", err)
+			}
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := storage.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// Validating never writes to the file
+			data, _ := os.ReadFile(path)
+			if string(data) != tt.content {
+				t.Errorf("file after Validate = %q, want %q", data, tt.content)
+			}
+		})
+	}
+}
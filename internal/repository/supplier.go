@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type SupplierRepository interface {
+	Create(ctx context.Context, supplier *models.Supplier) error
+	GetByID(ctx context.Context, id string) (*models.Supplier, error)
+	GetAll(ctx context.Context) (*[]models.Supplier, error)
+	Update(ctx context.Context, supplier *models.Supplier) error
+	Delete(ctx context.Context, id string) error
+
+	WithTx(tx *Tx) SupplierRepository
+}
+
+// SupplierRepository manages supplier data
+type supplierRepository struct {
+	suppliers collection[models.Supplier]
+	log       *slog.Logger
+}
+
+// NewSupplierRepository initializes a SupplierRepository with storage and logging
+func NewSupplierRepository(storage Storage, log *slog.Logger) *supplierRepository {
+	return &supplierRepository{
+		suppliers: newTable(storage, func(supplier models.Supplier) string { return supplier.ID }),
+		log:       log,
+	}
+}
+
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *supplierRepository) WithTx(tx *Tx) SupplierRepository {
+	return &supplierRepository{
+		suppliers: r.suppliers.withTx(tx),
+		log:       r.log,
+	}
+}
+
+func (r *supplierRepository) Create(ctx context.Context, supplier *models.Supplier) error {
+	r.log.InfoContext(ctx, "creating supplier", "supplier_id", supplier.ID)
+
+	err := r.suppliers.mutate(ctx, func(suppliers *records[models.Supplier]) error {
+		return suppliers.add(*supplier)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save new supplier", "error", err, "supplier_id", supplier.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (r *supplierRepository) GetByID(ctx context.Context, id string) (*models.Supplier, error) {
+	r.log.InfoContext(ctx, "retrieving supplier", "supplier_id", id)
+
+	supplier, err := r.suppliers.get(ctx, id)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load suppliers", "error", err)
+		return nil, err
+	}
+
+	return supplier, nil
+}
+
+func (r *supplierRepository) GetAll(ctx context.Context) (*[]models.Supplier, error) {
+	r.log.InfoContext(ctx, "retrieving all suppliers")
+
+	suppliers, err := r.suppliers.all(ctx)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load suppliers", "error", err)
+		return nil, err
+	}
+
+	return &suppliers, nil
+}
+
+func (r *supplierRepository) Update(ctx context.Context, supplier *models.Supplier) error {
+	r.log.InfoContext(ctx, "updating supplier", "supplier_id", supplier.ID)
+
+	err := r.suppliers.mutate(ctx, func(suppliers *records[models.Supplier]) error {
+		return suppliers.update(*supplier)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated supplier", "error", err, "supplier_id", supplier.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (r *supplierRepository) Delete(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "deleting supplier", "supplier_id", id)
+
+	err := r.suppliers.mutate(ctx, func(suppliers *records[models.Supplier]) error {
+		suppliers.remove(id)
+		return nil
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save suppliers after deletion", "error", err, "supplier_id", id)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, username string) (*models.User, error)
+	GetByKeyHash(ctx context.Context, keyHash string) (*models.User, error)
+	GetAll(ctx context.Context) (*[]models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, username string) error
+
+	WithTx(tx *Tx) UserRepository
+}
+
+// userRepository manages API users
+type userRepository struct {
+	users collection[models.User]
+	log   *slog.Logger
+}
+
+// NewUserRepository initializes a UserRepository with storage and logging
+func NewUserRepository(storage Storage, log *slog.Logger) *userRepository {
+	return &userRepository{
+		users: newTable(storage, func(user models.User) string { return user.Username }),
+		log:   log,
+	}
+}
+
+// WithTx returns a repository whose reads and writes belong to tx
+func (r *userRepository) WithTx(tx *Tx) UserRepository {
+	return &userRepository{
+		users: r.users.withTx(tx),
+		log:   r.log,
+	}
+}
+
+func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	r.log.InfoContext(ctx, "creating user", "username", user.Username)
+
+	err := r.users.mutate(ctx, func(users *records[models.User]) error {
+		return users.add(*user)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save new user", "error", err, "username", user.Username)
+		return err
+	}
+
+	return nil
+}
+
+func (r *userRepository) GetByID(ctx context.Context, username string) (*models.User, error) {
+	user, err := r.users.get(ctx, username)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load users", "error", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetByKeyHash returns the user whose API key has the given hash
+func (r *userRepository) GetByKeyHash(ctx context.Context, keyHash string) (*models.User, error) {
+	match := func(user *models.User) bool { return user.KeyHash == keyHash }
+	users, _, err := r.users.list(ctx, query[models.User]{match: match, limit: 1})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load users", "error", err)
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		return nil, nil
+	}
+	return &users[0], nil
+}
+
+func (r *userRepository) GetAll(ctx context.Context) (*[]models.User, error) {
+	r.log.InfoContext(ctx, "retrieving all users")
+
+	users, err := r.users.all(ctx)
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to load users", "error", err)
+		return nil, err
+	}
+
+	return &users, nil
+}
+
+func (r *userRepository) Update(ctx context.Context, user *models.User) error {
+	r.log.InfoContext(ctx, "updating user", "username", user.Username)
+
+	err := r.users.mutate(ctx, func(users *records[models.User]) error {
+		return users.update(*user)
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save updated user", "error", err, "username", user.Username)
+		return err
+	}
+
+	return nil
+}
+
+func (r *userRepository) Delete(ctx context.Context, username string) error {
+	r.log.InfoContext(ctx, "deleting user", "username", username)
+
+	err := r.users.mutate(ctx, func(users *records[models.User]) error {
+		users.remove(username)
+		return nil
+	})
+	if err != nil {
+		r.log.ErrorContext(ctx, "failed to save users after deletion", "error", err, "username", username)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// ErrImportFailed is returned when rows of an import were rejected; the
+// import result lists them
+var ErrImportFailed = errors.New("import has invalid rows")
+
+// errDryRun rolls back the transaction of a dry run that found no errors
+var errDryRun = errors.New("dry run")
+
+// importRowErrors are the errors that reject a single row of an import.
+// Any other error aborts the import.
+var importRowErrors = []error{
+	ErrInventoryItemExists,
+	ErrInventoryItemNotFound,
+	ErrMenuItemAlreadyExists,
+	models.ErrIncompatibleUnits,
+	models.ErrUnknownUnit,
+}
+
+func isImportRowError(err error) bool {
+	for _, rowErr := range importRowErrors {
+		if errors.Is(err, rowErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// endImport is the last step of the transaction of an import. Its error
+// rolls the transaction back when rows were rejected or for a dry run. A
+// dry run keeps listing the rows that would have been saved.
+func endImport(result *models.ImportResult) error {
+	if len(result.Errors) > 0 {
+		if !result.DryRun {
+			result.Created = []string{}
+			result.Updated = []string{}
+		}
+		return ErrImportFailed
+	}
+	if result.DryRun {
+		return errDryRun
+	}
+	return nil
+}
+
+// importOutcome turns the error of the transaction of an import into the
+// error of the import
+func importOutcome(err error) error {
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
@@ -1,24 +1,41 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 type InventoryService interface {
-	CreateInventoryItems(items *[]models.InventoryItem) error
-	CreateInventoryItem(item *models.InventoryItem) error
-	GetInventoryItem(id string) (*models.InventoryItem, error)
-	GetAllInventoryItems() (*[]models.InventoryItem, error)
-	UpdateInventoryItem(id string, item *models.InventoryItem) error
-	DeleteInventoryItem(id string) error
-
-	CheckIngredients(ingredients []models.MenuItemIngredient, quantity int) (bool, error)
-	DeductIngredients(ingredients []models.MenuItemIngredient, quantity int) error
+	CreateInventoryItems(ctx context.Context, items *[]models.InventoryItem) error
+	CreateInventoryItem(ctx context.Context, item *models.InventoryItem) error
+	GetInventoryItem(ctx context.Context, id string) (*models.InventoryItem, error)
+	GetAllInventoryItems(ctx context.Context) (*[]models.InventoryItem, error)
+	GetLowStockItems(ctx context.Context) (*[]models.InventoryItem, error)
+	ListInventoryItems(ctx context.Context, filter models.InventoryFilter, opts models.ListOptions) (*[]models.InventoryItem, int, error)
+	UpdateInventoryItem(ctx context.Context, id string, item *models.InventoryItem) error
+	DeleteInventoryItem(ctx context.Context, id string, cascade bool) error
+	GetMenuItemsUsing(ctx context.Context, id string) (*[]models.MenuItem, error)
+	ImportInventoryItems(ctx context.Context, items []models.InventoryItem, upsert, dryRun bool) (*models.ImportResult, error)
+
+	RecordMovement(ctx context.Context, id string, movement *models.InventoryMovement) error
+	GetMovements(ctx context.Context, id string) (*models.InventoryLedger, error)
+
+	CheckIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int) (bool, error)
+	CheckRecipe(ctx context.Context, ingredients []models.MenuItemIngredient) error
+	CountPortions(ctx context.Context, ingredients []models.MenuItemIngredient) (portions int, limited bool, err error)
+	DeductIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int, orderID string) error
+	RestockIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int, orderID string) error
+	ReceiveIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, purchaseOrderID string) error
+
+	WithTx(tx *repository.Tx) InventoryService
 }
 
 var (
@@ -26,60 +43,168 @@ var (
 	ErrInsufficientQuantity  = errors.New("insufficient quantity in inventory")
 	ErrInventoryItemExists   = errors.New("inventory item already exists")
 	ErrInventoryItemNotFound = errors.New("inventory item not found")
+	ErrInventoryItemInUse    = errors.New("inventory item is used by menu items")
 )
 
 // InventoryService handles business logic for inventory items
 type inventoryService struct {
-	inventoryRepo repository.InventoryRepository
-	log           *slog.Logger
+	inventoryRepo     repository.InventoryRepository
+	movementRepo      repository.MovementRepository
+	menuRepo          repository.MenuRepository
+	orderRepo         repository.OrderRepository
+	purchaseOrderRepo repository.PurchaseOrderRepository
+	stockMonitor      *StockMonitor
+	transactor        repository.Transactor
+	log               *slog.Logger
 }
 
-// NewInventoryService initializes InventoryService with repository and logging
-func NewInventoryService(inventoryRepo repository.InventoryRepository, log *slog.Logger) inventoryService {
+// NewInventoryService initializes InventoryService with repositories, transactor and logging.
+// The menu repository is used to keep recipes pointing at existing items;
+// recipes, orders and purchase orders are updated when an item changes unit.
+// stockMonitor, if not nil, is triggered whenever quantities change.
+func NewInventoryService(inventoryRepo repository.InventoryRepository, movementRepo repository.MovementRepository, menuRepo repository.MenuRepository, orderRepo repository.OrderRepository, purchaseOrderRepo repository.PurchaseOrderRepository, stockMonitor *StockMonitor, transactor repository.Transactor, log *slog.Logger) inventoryService {
 	return inventoryService{
-		inventoryRepo: inventoryRepo,
-		log:           log,
+		inventoryRepo:     inventoryRepo,
+		movementRepo:      movementRepo,
+		menuRepo:          menuRepo,
+		orderRepo:         orderRepo,
+		purchaseOrderRepo: purchaseOrderRepo,
+		stockMonitor:      stockMonitor,
+		transactor:        transactor,
+		log:               log,
 	}
 }
 
-func (s inventoryService) CreateInventoryItems(items *[]models.InventoryItem) error {
-	s.log.Info("creating multiple inventory items", "count", len(*items))
+// WithTx returns a service whose changes become part of tx
+func (s inventoryService) WithTx(tx *repository.Tx) InventoryService {
+	return s.withTx(tx)
+}
 
-	for i := range *items {
-		if err := s.CreateInventoryItem(&(*items)[i]); err != nil {
-			return fmt.Errorf("failed to create item with id %s: %w", (*items)[i].IngredientID, err)
-		}
-	}
-	return nil
+func (s inventoryService) withTx(tx *repository.Tx) inventoryService {
+	s.inventoryRepo = s.inventoryRepo.WithTx(tx)
+	s.movementRepo = s.movementRepo.WithTx(tx)
+	s.menuRepo = s.menuRepo.WithTx(tx)
+	s.orderRepo = s.orderRepo.WithTx(tx)
+	s.purchaseOrderRepo = s.purchaseOrderRepo.WithTx(tx)
+	s.transactor = tx
+	return s
 }
 
-func (s inventoryService) CreateInventoryItem(item *models.InventoryItem) error {
-	s.log.Info("creating inventory item", "id", item.IngredientID)
+// atomically runs fn with a copy of the service bound to a transaction, so
+// every change fn makes is saved together or not at all
+func (s inventoryService) atomically(ctx context.Context, fn func(s inventoryService) error) error {
+	return s.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		return fn(s.withTx(tx))
+	})
+}
 
-	existingItem, err := s.inventoryRepo.GetByID(item.IngredientID)
-	if err != nil {
-		s.log.Error("failed to check existing item", "error", err, "id", item.IngredientID)
-		return fmt.Errorf("failed to check existing item: %w", err)
+// watchStock has the stock monitor check the inventory once the current
+// transaction has been committed
+func (s inventoryService) watchStock() {
+	if s.stockMonitor == nil {
+		return
 	}
-
-	if existingItem != nil {
-		s.log.Info("item already exists", "id", item.IngredientID)
-		return ErrInventoryItemExists
+	if tx, ok := s.transactor.(*repository.Tx); ok {
+		tx.OnCommit(s.stockMonitor.Trigger)
+		return
 	}
+	s.stockMonitor.Trigger()
+}
 
-	if err := s.inventoryRepo.Create(item); err != nil {
-		s.log.Error("failed to create item", "error", err, "id", item.IngredientID)
-		return fmt.Errorf("failed to create item: %w", err)
-	}
-	return nil
+func (s inventoryService) CreateInventoryItems(ctx context.Context, items *[]models.InventoryItem) error {
+	s.log.InfoContext(ctx, "creating multiple inventory items", "count", len(*items))
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		for i := range *items {
+			if err := s.CreateInventoryItem(ctx, &(*items)[i]); err != nil {
+				return fmt.Errorf("failed to create item with id %s: %w", (*items)[i].IngredientID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s inventoryService) CreateInventoryItem(ctx context.Context, item *models.InventoryItem) error {
+	s.log.InfoContext(ctx, "creating inventory item", "id", item.IngredientID)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		existingItem, err := s.inventoryRepo.GetByID(ctx, item.IngredientID)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing item", "error", err, "id", item.IngredientID)
+			return fmt.Errorf("failed to check existing item: %w", err)
+		}
+
+		if existingItem != nil {
+			s.log.InfoContext(ctx, "item already exists", "id", item.IngredientID)
+			return ErrInventoryItemExists
+		}
+
+		if err := s.inventoryRepo.Create(ctx, item); err != nil {
+			s.log.ErrorContext(ctx, "failed to create item", "error", err, "id", item.IngredientID)
+			return fmt.Errorf("failed to create item: %w", err)
+		}
+
+		s.watchStock()
+		if item.Quantity == 0 {
+			return nil
+		}
+		return s.record(ctx, models.MovementReceipt, "", "initial stock", models.InventoryMovement{
+			IngredientID: item.IngredientID,
+			Delta:        item.Quantity,
+			Unit:         item.Unit,
+		})
+	})
+}
+
+// ImportInventoryItems creates the items, or with upsert also updates the
+// ones that exist, in a single transaction. items[i] is reported as row i+2,
+// the row after the header. Rows that fail are listed in the result and
+// nothing is saved; a dry run reports the same but never saves.
+func (s inventoryService) ImportInventoryItems(ctx context.Context, items []models.InventoryItem, upsert, dryRun bool) (*models.ImportResult, error) {
+	s.log.InfoContext(ctx, "importing inventory items", "count", len(items), "upsert", upsert, "dry_run", dryRun)
+
+	result := models.NewImportResult(dryRun, upsert)
+	err := s.atomically(ctx, func(s inventoryService) error {
+		for i := range items {
+			item := &items[i]
+
+			existing, err := s.inventoryRepo.GetByID(ctx, item.IngredientID)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to check existing item", "error", err, "id", item.IngredientID)
+				return fmt.Errorf("failed to check existing item: %w", err)
+			}
+
+			switch {
+			case existing == nil:
+				if err = s.CreateInventoryItem(ctx, item); err == nil {
+					result.Created = append(result.Created, item.IngredientID)
+				}
+			case upsert:
+				if err = s.UpdateInventoryItem(ctx, item.IngredientID, item); err == nil {
+					result.Updated = append(result.Updated, item.IngredientID)
+				}
+			default:
+				err = ErrInventoryItemExists
+			}
+
+			if err != nil {
+				if !isImportRowError(err) {
+					return err
+				}
+				result.AddError(i+2, item.IngredientID, err)
+			}
+		}
+		return endImport(result)
+	})
+	return result, importOutcome(err)
 }
 
-func (s inventoryService) GetInventoryItem(id string) (*models.InventoryItem, error) {
-	s.log.Info("retrieving inventory item", "id", id)
+func (s inventoryService) GetInventoryItem(ctx context.Context, id string) (*models.InventoryItem, error) {
+	s.log.InfoContext(ctx, "retrieving inventory item", "id", id)
 
-	item, err := s.inventoryRepo.GetByID(id)
+	item, err := s.inventoryRepo.GetByID(ctx, id)
 	if err != nil {
-		s.log.Error("failed to get item", "error", err, "id", id)
+		s.log.ErrorContext(ctx, "failed to get item", "error", err, "id", id)
 		return nil, fmt.Errorf("failed to get item: %w", err)
 	}
 
@@ -90,114 +215,710 @@ func (s inventoryService) GetInventoryItem(id string) (*models.InventoryItem, er
 	return item, nil
 }
 
-func (s inventoryService) GetAllInventoryItems() (*[]models.InventoryItem, error) {
-	s.log.Info("retrieving all inventory items")
+func (s inventoryService) GetAllInventoryItems(ctx context.Context) (*[]models.InventoryItem, error) {
+	s.log.InfoContext(ctx, "retrieving all inventory items")
 
-	items, err := s.inventoryRepo.GetAll()
+	items, err := s.inventoryRepo.GetAll(ctx)
 	if err != nil {
-		s.log.Error("failed to get all items", "error", err)
+		s.log.ErrorContext(ctx, "failed to get all items", "error", err)
 		return nil, fmt.Errorf("failed to get all items: %w", err)
 	}
 	return items, nil
 }
 
-func (s inventoryService) UpdateInventoryItem(id string, item *models.InventoryItem) error {
-	s.log.Info("updating inventory item", "id", id)
+// GetLowStockItems returns the items at or below their reorder threshold
+func (s inventoryService) GetLowStockItems(ctx context.Context) (*[]models.InventoryItem, error) {
+	s.log.InfoContext(ctx, "retrieving low stock inventory items")
+
+	items, _, err := s.inventoryRepo.List(ctx, models.InventoryFilter{LowStock: true}, models.ListOptions{})
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get low stock items", "error", err)
+		return nil, fmt.Errorf("failed to get low stock items: %w", err)
+	}
+	return items, nil
+}
+
+// ListInventoryItems returns a page of the items that pass the filter and
+// the number of items that pass it
+func (s inventoryService) ListInventoryItems(ctx context.Context, filter models.InventoryFilter, opts models.ListOptions) (*[]models.InventoryItem, int, error) {
+	s.log.InfoContext(ctx, "listing inventory items")
+
+	items, total, err := s.inventoryRepo.List(ctx, filter, opts)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to list items", "error", err)
+		return nil, 0, fmt.Errorf("failed to list items: %w", err)
+	}
+	return items, total, nil
+}
+
+func (s inventoryService) UpdateInventoryItem(ctx context.Context, id string, item *models.InventoryItem) error {
+	s.log.InfoContext(ctx, "updating inventory item", "id", id)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		existingItem, err := s.inventoryRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing item", "error", err, "id", id)
+			return fmt.Errorf("failed to check existing item: %w", err)
+		}
+
+		if existingItem == nil {
+			return ErrInventoryItemNotFound
+		}
+
+		if item.Unit != existingItem.Unit || item.ShotSize != existingItem.ShotSize {
+			if err := s.checkRecipesFor(ctx, item, existingItem.Unit); err != nil {
+				return err
+			}
+		}
+		if item.Unit != existingItem.Unit {
+			if err := s.pinUnit(ctx, item, existingItem.Unit); err != nil {
+				return err
+			}
+		}
+
+		if err := s.inventoryRepo.Update(ctx, item); err != nil {
+			s.log.ErrorContext(ctx, "failed to update item", "error", err, "id", id)
+			return fmt.Errorf("failed to update item: %w", err)
+		}
+
+		s.watchStock()
+		if item.Unit != existingItem.Unit {
+			// Past movements stay in the old unit: close the balance in it
+			// and open it again in the new one, so the deltas still add up
+			var movements []models.InventoryMovement
+			if existingItem.Quantity != 0 {
+				movements = append(movements, models.InventoryMovement{IngredientID: id, Delta: -existingItem.Quantity, Unit: existingItem.Unit})
+			}
+			if item.Quantity != 0 {
+				movements = append(movements, models.InventoryMovement{IngredientID: id, Delta: item.Quantity, Unit: item.Unit})
+			}
+			reason := fmt.Sprintf("unit changed from %s to %s", existingItem.Unit, item.Unit)
+			return s.record(ctx, models.MovementAdjustment, "", reason, movements...)
+		}
+		if item.Quantity == existingItem.Quantity {
+			return nil
+		}
+		return s.record(ctx, models.MovementAdjustment, "", "quantity set by update", models.InventoryMovement{
+			IngredientID: id,
+			Delta:        item.Quantity - existingItem.Quantity,
+			Unit:         item.Unit,
+		})
+	})
+}
+
+// DeleteInventoryItem removes an item from the inventory. An item that menu
+// recipes still use is only deleted with cascade, which also takes it out of
+// those recipes.
+func (s inventoryService) DeleteInventoryItem(ctx context.Context, id string, cascade bool) error {
+	s.log.InfoContext(ctx, "deleting inventory item", "id", id, "cascade", cascade)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		existingItem, err := s.inventoryRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing item", "error", err, "id", id)
+			return fmt.Errorf("failed to check existing item: %w", err)
+		}
+
+		if existingItem == nil {
+			return ErrInventoryItemNotFound
+		}
+
+		menuItems, err := s.menuRepo.GetByIngredient(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get menu items using item", "error", err, "id", id)
+			return fmt.Errorf("failed to get menu items: %w", err)
+		}
+
+		if len(*menuItems) > 0 {
+			if !cascade {
+				s.log.InfoContext(ctx, "item is used by menu items", "id", id, "count", len(*menuItems))
+				return fmt.Errorf("%w: %s", ErrInventoryItemInUse, menuItemIDs(*menuItems))
+			}
+			if err := s.removeFromRecipes(ctx, id, *menuItems); err != nil {
+				return err
+			}
+		}
+
+		if err := s.inventoryRepo.Delete(ctx, id); err != nil {
+			s.log.ErrorContext(ctx, "failed to delete item", "error", err, "id", id)
+			return fmt.Errorf("failed to delete item: %w", err)
+		}
+
+		// Zero the ledger, so an item created again under the same ID
+		// starts from a balanced history
+		if existingItem.Quantity == 0 {
+			return nil
+		}
+		return s.record(ctx, models.MovementAdjustment, "", "item deleted", models.InventoryMovement{
+			IngredientID: id,
+			Delta:        -existingItem.Quantity,
+			Unit:         existingItem.Unit,
+		})
+	})
+}
+
+// GetMenuItemsUsing returns the menu items whose recipe uses the item
+func (s inventoryService) GetMenuItemsUsing(ctx context.Context, id string) (*[]models.MenuItem, error) {
+	s.log.InfoContext(ctx, "retrieving menu items using inventory item", "id", id)
+
+	item, err := s.inventoryRepo.GetByID(ctx, id)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get item", "error", err, "id", id)
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	if item == nil {
+		return nil, ErrInventoryItemNotFound
+	}
 
-	existingItem, err := s.inventoryRepo.GetByID(id)
+	menuItems, err := s.menuRepo.GetByIngredient(ctx, id)
 	if err != nil {
-		s.log.Error("failed to check existing item", "error", err, "id", id)
-		return fmt.Errorf("failed to check existing item: %w", err)
+		s.log.ErrorContext(ctx, "failed to get menu items using item", "error", err, "id", id)
+		return nil, fmt.Errorf("failed to get menu items: %w", err)
 	}
+	return menuItems, nil
+}
+
+// removeFromRecipes drops the ingredient from the recipes of menuItems
+func (s inventoryService) removeFromRecipes(ctx context.Context, id string, menuItems []models.MenuItem) error {
+	for _, menuItem := range menuItems {
+		// Build a new slice: the stored item shares its ingredients with menuItem
+		ingredients := make([]models.MenuItemIngredient, 0, len(menuItem.Ingredients))
+		for _, ingredient := range menuItem.Ingredients {
+			if ingredient.IngredientID != id {
+				ingredients = append(ingredients, ingredient)
+			}
+		}
+		menuItem.Ingredients = ingredients
 
-	if existingItem == nil {
-		return ErrInventoryItemNotFound
+		if err := s.menuRepo.Update(ctx, &menuItem); err != nil {
+			s.log.ErrorContext(ctx, "failed to remove ingredient from menu item", "error", err, "id", id, "menu_item_id", menuItem.ID)
+			return fmt.Errorf("failed to update menu item %s: %w", menuItem.ID, err)
+		}
+		s.log.InfoContext(ctx, "removed ingredient from menu item", "id", id, "menu_item_id", menuItem.ID)
 	}
+	return nil
+}
 
-	if err := s.inventoryRepo.Update(item); err != nil {
-		s.log.Error("failed to update item", "error", err, "id", id)
-		return fmt.Errorf("failed to update item: %w", err)
+// checkRecipesFor makes sure the recipes that use item can still be
+// converted to its unit. Recipe quantities without a unit were given in
+// oldUnit.
+func (s inventoryService) checkRecipesFor(ctx context.Context, item *models.InventoryItem, oldUnit string) error {
+	menuItems, err := s.menuRepo.GetByIngredient(ctx, item.IngredientID)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get menu items using item", "error", err, "id", item.IngredientID)
+		return fmt.Errorf("failed to get menu items: %w", err)
+	}
+
+	for _, menuItem := range *menuItems {
+		for _, ingredient := range menuItem.Ingredients {
+			if ingredient.IngredientID != item.IngredientID {
+				continue
+			}
+			unit := ingredient.Unit
+			if unit == "" {
+				unit = oldUnit
+			}
+			if _, err := item.ConvertFrom(ingredient.Quantity, unit); err != nil {
+				return fmt.Errorf("%w (used by menu item %s)", err, menuItem.ID)
+			}
+		}
 	}
 	return nil
 }
 
-func (s inventoryService) DeleteInventoryItem(id string) error {
-	s.log.Info("deleting inventory item", "id", id)
+// pinUnit gives the quantities of item that are stored without a unit, and
+// so are read in the unit of the item, the unit they were given in: oldUnit.
+// Recipes, the ingredients taken for orders and purchase order items are
+// rewritten, so that they keep their amount once the item changes unit.
+// Orders that can still return their ingredients and open purchase orders
+// must convert to the new unit.
+func (s inventoryService) pinUnit(ctx context.Context, item *models.InventoryItem, oldUnit string) error {
+	id := item.IngredientID
+
+	menuItems, err := s.menuRepo.GetByIngredient(ctx, id)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get menu items using item", "error", err, "id", id)
+		return fmt.Errorf("failed to get menu items: %w", err)
+	}
+	for _, menuItem := range *menuItems {
+		ingredients, changed := pinIngredientUnit(menuItem.Ingredients, id, oldUnit)
+		if !changed {
+			continue
+		}
+		menuItem.Ingredients = ingredients
+		if err := s.menuRepo.Update(ctx, &menuItem); err != nil {
+			s.log.ErrorContext(ctx, "failed to update menu item", "error", err, "id", id, "menu_item_id", menuItem.ID)
+			return fmt.Errorf("failed to update menu item %s: %w", menuItem.ID, err)
+		}
+	}
 
-	existingItem, err := s.inventoryRepo.GetByID(id)
+	orders, err := s.orderRepo.GetAll(ctx)
 	if err != nil {
-		s.log.Error("failed to check existing item", "error", err, "id", id)
-		return fmt.Errorf("failed to check existing item: %w", err)
+		s.log.ErrorContext(ctx, "failed to get orders", "error", err)
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+	for _, order := range *orders {
+		ingredients, changed := pinIngredientUnit(order.Ingredients, id, oldUnit)
+		if order.Status != models.StatusCompleted && order.Status != models.StatusCancelled {
+			if err := convertsTo(item, ingredients); err != nil {
+				return fmt.Errorf("%w (taken for order %s)", err, order.ID)
+			}
+		}
+		if !changed {
+			continue
+		}
+		order.Ingredients = ingredients
+		if err := s.orderRepo.Update(ctx, &order); err != nil {
+			s.log.ErrorContext(ctx, "failed to update order", "error", err, "id", id, "order_id", order.ID)
+			return fmt.Errorf("failed to update order %s: %w", order.ID, err)
+		}
 	}
 
-	if existingItem == nil {
-		return ErrInventoryItemNotFound
+	purchaseOrders, err := s.purchaseOrderRepo.GetAll(ctx)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get purchase orders", "error", err)
+		return fmt.Errorf("failed to get purchase orders: %w", err)
 	}
+	for _, order := range *purchaseOrders {
+		changed := false
+		// Build a new slice: the stored order shares its items with order
+		items := make([]models.PurchaseOrderItem, len(order.Items))
+		for i, orderItem := range order.Items {
+			if orderItem.IngredientID == id && orderItem.Unit == "" {
+				orderItem.Unit = oldUnit
+				changed = true
+			}
+			items[i] = orderItem
+		}
+		order.Items = items
 
-	if err := s.inventoryRepo.Delete(id); err != nil {
-		s.log.Error("failed to delete item", "error", err, "id", id)
-		return fmt.Errorf("failed to delete item: %w", err)
+		if order.IsOpen() {
+			if err := convertsTo(item, order.Ingredients()); err != nil {
+				return fmt.Errorf("%w (ordered on purchase order %s)", err, order.ID)
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := s.purchaseOrderRepo.Update(ctx, &order); err != nil {
+			s.log.ErrorContext(ctx, "failed to update purchase order", "error", err, "id", id, "purchase_order_id", order.ID)
+			return fmt.Errorf("failed to update purchase order %s: %w", order.ID, err)
+		}
 	}
+
+	s.log.InfoContext(ctx, "quantities without a unit now carry the old unit", "id", id, "unit", oldUnit)
 	return nil
 }
 
-func (s inventoryService) CheckIngredients(ingredients []models.MenuItemIngredient, quantity int) (bool, error) {
-	s.log.Info("checking ingredients availability", "ingredients_count", len(ingredients), "quantity", quantity)
+// pinIngredientUnit returns ingredients with the unit-less quantities of
+// ingredient id set to unit, and whether any was. The slice is a copy, as
+// the given one may be shared with the cache.
+func pinIngredientUnit(ingredients []models.MenuItemIngredient, id, unit string) ([]models.MenuItemIngredient, bool) {
+	pinned := make([]models.MenuItemIngredient, len(ingredients))
+	changed := false
+	for i, ingredient := range ingredients {
+		if ingredient.IngredientID == id && ingredient.Unit == "" {
+			ingredient.Unit = unit
+			changed = true
+		}
+		pinned[i] = ingredient
+	}
+	return pinned, changed
+}
 
+// convertsTo makes sure every quantity of item among ingredients converts
+// to its unit
+func convertsTo(item *models.InventoryItem, ingredients []models.MenuItemIngredient) error {
 	for _, ingredient := range ingredients {
-		item, err := s.inventoryRepo.GetByID(ingredient.IngredientID)
-		if err != nil {
-			s.log.Error("failed to get item for availability check",
-				"error", err, "ingredient_id", ingredient.IngredientID)
-			return false, fmt.Errorf("failed to check ingredient %s: %w", ingredient.IngredientID, err)
+		if ingredient.IngredientID != item.IngredientID {
+			continue
 		}
-
-		if item == nil {
-			s.log.Info("ingredient not found", "ingredient_id", ingredient.IngredientID)
-			return false, nil
+		if _, err := item.ConvertFrom(ingredient.Quantity, ingredient.Unit); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		requiredQuantity := ingredient.Quantity * float64(quantity)
-		if item.Quantity < requiredQuantity {
-			s.log.Info("insufficient quantity",
-				"ingredient_id", ingredient.IngredientID,
-				"available", item.Quantity,
-				"required", requiredQuantity)
+// menuItemIDs lists the IDs of menuItems for error messages
+func menuItemIDs(menuItems []models.MenuItem) string {
+	ids := make([]string, len(menuItems))
+	for i, menuItem := range menuItems {
+		ids[i] = menuItem.ID
+	}
+	return strings.Join(ids, ", ")
+}
+
+func (s inventoryService) CheckIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int) (bool, error) {
+	s.log.InfoContext(ctx, "checking ingredients availability", "ingredients_count", len(ingredients), "quantity", quantity)
+
+	_, _, err := s.applyIngredients(ctx, ingredients, -float64(quantity))
+	if err != nil {
+		if errors.Is(err, ErrInventoryItemNotFound) || errors.Is(err, ErrInsufficientQuantity) ||
+			errors.Is(err, models.ErrIncompatibleUnits) || errors.Is(err, models.ErrUnknownUnit) {
+			s.log.InfoContext(ctx, "ingredients not available", "reason", err)
 			return false, nil
 		}
+		return false, err
 	}
 
 	return true, nil
 }
 
-func (s inventoryService) DeductIngredients(ingredients []models.MenuItemIngredient, quantity int) error {
-	s.log.Info("deducting ingredients", "ingredients_count", len(ingredients), "quantity", quantity)
+// CheckRecipe makes sure every ingredient is in the inventory and is measured
+// in a unit that converts to the unit its inventory item is stocked in
+func (s inventoryService) CheckRecipe(ctx context.Context, ingredients []models.MenuItemIngredient) error {
+	for _, ingredient := range ingredients {
+		item, err := s.inventoryRepo.GetByID(ctx, ingredient.IngredientID)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get inventory item", "error", err, "ingredient_id", ingredient.IngredientID)
+			return fmt.Errorf("failed to get ingredient %s: %w", ingredient.IngredientID, err)
+		}
+
+		if item == nil {
+			return fmt.Errorf("%w: %s", ErrInventoryItemNotFound, ingredient.IngredientID)
+		}
 
-	// Then deduct all ingredients
+		if _, err := item.ConvertFrom(ingredient.Quantity, ingredient.Unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountPortions returns how many times the ingredients can be taken from the
+// current stock. An ingredient that is missing from the inventory, or measured
+// in a unit that cannot be converted, allows no portions. limited is false
+// when there are no ingredients to run out of.
+func (s inventoryService) CountPortions(ctx context.Context, ingredients []models.MenuItemIngredient) (int, bool, error) {
+	required := make(map[string]float64, len(ingredients))
+	var ids []string
 	for _, ingredient := range ingredients {
-		item, err := s.inventoryRepo.GetByID(ingredient.IngredientID)
+		item, err := s.inventoryRepo.GetByID(ctx, ingredient.IngredientID)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get inventory item", "error", err, "ingredient_id", ingredient.IngredientID)
+			return 0, false, fmt.Errorf("failed to get ingredient %s: %w", ingredient.IngredientID, err)
+		}
+		if item == nil {
+			return 0, true, nil
+		}
+
+		quantity, err := item.ConvertFrom(ingredient.Quantity, ingredient.Unit)
+		if err != nil {
+			s.log.InfoContext(ctx, "ingredient unit cannot be converted", "ingredient_id", item.IngredientID, "error", err)
+			return 0, true, nil
+		}
+
+		if _, ok := required[item.IngredientID]; !ok {
+			ids = append(ids, item.IngredientID)
+		}
+		required[item.IngredientID] += quantity
+	}
+
+	portions, limited := 0, false
+	for _, id := range ids {
+		if required[id] <= 0 {
+			continue
+		}
+		item, err := s.inventoryRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get inventory item", "error", err, "ingredient_id", id)
+			return 0, false, fmt.Errorf("failed to get ingredient %s: %w", id, err)
+		}
+
+		n := int(math.Floor(models.RoundQuantity(item.Quantity / models.RoundQuantity(required[id]))))
+		if !limited || n < portions {
+			portions, limited = n, true
+		}
+	}
+	return portions, limited, nil
+}
+
+// DeductIngredients removes the ingredients for quantity portions from the
+// inventory and records them as consumed by the order. Either every
+// ingredient is deducted or none is.
+func (s inventoryService) DeductIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int, orderID string) error {
+	s.log.InfoContext(ctx, "deducting ingredients", "ingredients_count", len(ingredients), "quantity", quantity, "order_id", orderID)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		items, movements, err := s.applyIngredients(ctx, ingredients, -float64(quantity))
 		if err != nil {
-			s.log.Error("failed to get item for deduction",
-				"error", err,
-				"ingredient_id", ingredient.IngredientID)
-			return fmt.Errorf("failed to deduct ingredient %s: %w",
-				ingredient.IngredientID, err)
+			return err
+		}
+
+		if err := s.inventoryRepo.UpdateMany(ctx, items); err != nil {
+			s.log.ErrorContext(ctx, "failed to save deducted ingredients", "error", err)
+			return fmt.Errorf("failed to deduct ingredients: %w", err)
+		}
+
+		s.watchStock()
+		return s.record(ctx, models.MovementOrderConsumption, orderID, "", movements...)
+	})
+}
+
+// RestockIngredients returns the ingredients for quantity portions to the
+// inventory, undoing a previous DeductIngredients for the order.
+func (s inventoryService) RestockIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, quantity int, orderID string) error {
+	s.log.InfoContext(ctx, "restocking ingredients", "ingredients_count", len(ingredients), "quantity", quantity, "order_id", orderID)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		items, movements, err := s.applyIngredients(ctx, ingredients, float64(quantity))
+		if err != nil {
+			return err
+		}
+
+		if err := s.inventoryRepo.UpdateMany(ctx, items); err != nil {
+			s.log.ErrorContext(ctx, "failed to save restocked ingredients", "error", err)
+			return fmt.Errorf("failed to restock ingredients: %w", err)
+		}
+
+		s.watchStock()
+		return s.record(ctx, models.MovementOrderRestock, orderID, "", movements...)
+	})
+}
+
+// ReceiveIngredients adds the ingredients delivered for a purchase order to
+// the inventory. Every ingredient must still be in the inventory.
+func (s inventoryService) ReceiveIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, purchaseOrderID string) error {
+	s.log.InfoContext(ctx, "receiving ingredients", "ingredients_count", len(ingredients), "purchase_order_id", purchaseOrderID)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		for _, ingredient := range ingredients {
+			item, err := s.inventoryRepo.GetByID(ctx, ingredient.IngredientID)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to get inventory item", "error", err, "ingredient_id", ingredient.IngredientID)
+				return fmt.Errorf("failed to get ingredient %s: %w", ingredient.IngredientID, err)
+			}
+			if item == nil {
+				return fmt.Errorf("%w: %s", ErrInventoryItemNotFound, ingredient.IngredientID)
+			}
+		}
+
+		items, movements, err := s.applyIngredients(ctx, ingredients, 1)
+		if err != nil {
+			return err
+		}
+
+		if err := s.inventoryRepo.UpdateMany(ctx, items); err != nil {
+			s.log.ErrorContext(ctx, "failed to save received ingredients", "error", err)
+			return fmt.Errorf("failed to receive ingredients: %w", err)
+		}
+
+		s.watchStock()
+
+		for i := range movements {
+			movements[i].PurchaseOrderID = purchaseOrderID
+		}
+		return s.record(ctx, models.MovementReceipt, "", "purchase order received", movements...)
+	})
+}
+
+// RecordMovement applies a receipt, waste or manual adjustment to the item
+// and records it in the ledger
+func (s inventoryService) RecordMovement(ctx context.Context, id string, movement *models.InventoryMovement) error {
+	s.log.InfoContext(ctx, "recording inventory movement", "id", id, "type", movement.Type, "delta", movement.Delta)
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		item, err := s.inventoryRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get item", "error", err, "id", id)
+			return fmt.Errorf("failed to get item: %w", err)
 		}
 
 		if item == nil {
-			s.log.Info("ingredient not found", "ingredient_id", ingredient.IngredientID)
-			return fmt.Errorf("ingredient not found: %s", ingredient.IngredientID)
+			return ErrInventoryItemNotFound
 		}
 
-		item.Quantity -= ingredient.Quantity * float64(quantity)
-		if err := s.inventoryRepo.Update(item); err != nil {
-			s.log.Error("failed to update item after deduction",
-				"error", err,
-				"ingredient_id", ingredient.IngredientID)
-			return fmt.Errorf("failed to update ingredient %s: %w",
-				ingredient.IngredientID, err)
+		// A delta may be given in another unit than the item is stocked in
+		if movement.Unit != "" && movement.Unit != item.Unit {
+			delta, err := item.ConvertFrom(movement.Delta, movement.Unit)
+			if err != nil {
+				return err
+			}
+			movement.Delta = models.RoundQuantity(delta)
 		}
+		movement.Unit = item.Unit
+
+		if item.Quantity+movement.Delta < 0 {
+			return fmt.Errorf("%w: %s", ErrInsufficientQuantity, id)
+		}
+
+		item.Quantity += movement.Delta
+		if err := s.inventoryRepo.Update(ctx, item); err != nil {
+			s.log.ErrorContext(ctx, "failed to update item", "error", err, "id", id)
+			return fmt.Errorf("failed to update item: %w", err)
+		}
+
+		s.watchStock()
+
+		movement.IngredientID = id
+		movements := []models.InventoryMovement{*movement}
+		if err := s.record(ctx, movement.Type, "", movement.Reason, movements...); err != nil {
+			return err
+		}
+
+		*movement = movements[0]
+		return nil
+	})
+}
+
+// GetMovements returns the ledger of an item. The history of a deleted item
+// is still available.
+func (s inventoryService) GetMovements(ctx context.Context, id string) (*models.InventoryLedger, error) {
+	s.log.InfoContext(ctx, "retrieving inventory movements", "id", id)
+
+	item, err := s.inventoryRepo.GetByID(ctx, id)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get item", "error", err, "id", id)
+		return nil, fmt.Errorf("failed to get item: %w", err)
+	}
+
+	movements, err := s.movementRepo.GetByIngredient(ctx, id)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to get movements", "error", err, "id", id)
+		return nil, fmt.Errorf("failed to get movements: %w", err)
+	}
+
+	if item == nil && len(movements) == 0 {
+		return nil, ErrInventoryItemNotFound
+	}
+
+	var quantity float64
+	if item != nil {
+		quantity = item.Quantity
+	}
+
+	ledger := models.NewInventoryLedger(id, quantity, movements)
+	if ledger.Discrepancy != 0 {
+		s.log.WarnContext(ctx, "inventory does not match its ledger", "id", id, "discrepancy", ledger.Discrepancy)
 	}
+	return &ledger, nil
+}
+
+// OpenLedger records an opening balance for every item with stock but no
+// movements: stock from before the ledger was kept, or added to the
+// inventory file by hand. Its ledger then adds up to its quantity.
+func (s inventoryService) OpenLedger(ctx context.Context) error {
+	s.log.InfoContext(ctx, "opening inventory ledger")
+
+	return s.atomically(ctx, func(s inventoryService) error {
+		items, err := s.inventoryRepo.GetAll(ctx)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get all items", "error", err)
+			return fmt.Errorf("failed to get all items: %w", err)
+		}
+
+		movements, err := s.movementRepo.GetAll(ctx)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get movements", "error", err)
+			return fmt.Errorf("failed to get movements: %w", err)
+		}
+
+		recorded := make(map[string]bool, len(*items))
+		for _, movement := range movements {
+			recorded[movement.IngredientID] = true
+		}
 
+		var opening []models.InventoryMovement
+		for _, item := range *items {
+			if item.Quantity == 0 || recorded[item.IngredientID] {
+				continue
+			}
+			opening = append(opening, models.InventoryMovement{
+				IngredientID: item.IngredientID,
+				Delta:        item.Quantity,
+				Unit:         item.Unit,
+			})
+		}
+
+		if len(opening) > 0 {
+			s.log.InfoContext(ctx, "recording opening balances", "count", len(opening))
+		}
+		return s.record(ctx, models.MovementOpening, "", "opening balance", opening...)
+	})
+}
+
+// record stamps the movements with their type, order, reason and time and
+// appends them to the ledger
+func (s inventoryService) record(ctx context.Context, movementType, orderID, reason string, movements ...models.InventoryMovement) error {
+	if len(movements) == 0 {
+		return nil
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	for i := range movements {
+		movements[i].Type = movementType
+		movements[i].OrderID = orderID
+		movements[i].Reason = reason
+		movements[i].CreatedAt = now
+	}
+
+	if err := s.movementRepo.Append(ctx, movements); err != nil {
+		s.log.ErrorContext(ctx, "failed to record inventory movements", "error", err)
+		return fmt.Errorf("failed to record inventory movements: %w", err)
+	}
 	return nil
 }
+
+// applyIngredients aggregates the ingredients, multiplies them by factor and
+// returns the inventory items with their new quantities, along with the
+// change made to each as a movement. Nothing is saved.
+// A negative factor that would drive any item below zero fails the whole batch.
+// Returning ingredients that have since been removed from the inventory is
+// not an error; they are skipped.
+func (s inventoryService) applyIngredients(ctx context.Context, ingredients []models.MenuItemIngredient, factor float64) ([]models.InventoryItem, []models.InventoryMovement, error) {
+	byID := make(map[string][]models.MenuItemIngredient, len(ingredients))
+	var ids []string
+	for _, ingredient := range ingredients {
+		if _, ok := byID[ingredient.IngredientID]; !ok {
+			ids = append(ids, ingredient.IngredientID)
+		}
+		byID[ingredient.IngredientID] = append(byID[ingredient.IngredientID], ingredient)
+	}
+
+	items := make([]models.InventoryItem, 0, len(ids))
+	movements := make([]models.InventoryMovement, 0, len(ids))
+	for _, id := range ids {
+		item, err := s.inventoryRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get inventory item", "error", err, "ingredient_id", id)
+			return nil, nil, fmt.Errorf("failed to get ingredient %s: %w", id, err)
+		}
+
+		if item == nil {
+			if factor > 0 {
+				s.log.WarnContext(ctx, "skipping ingredient no longer in inventory", "ingredient_id", id)
+				continue
+			}
+			s.log.InfoContext(ctx, "ingredient not found", "ingredient_id", id)
+			return nil, nil, fmt.Errorf("%w: %s", ErrInventoryItemNotFound, id)
+		}
+
+		// Recipes may measure an ingredient in another unit than it is stocked in
+		var total float64
+		for _, ingredient := range byID[id] {
+			quantity, err := item.ConvertFrom(ingredient.Quantity, ingredient.Unit)
+			if err != nil {
+				s.log.InfoContext(ctx, "ingredient unit cannot be converted", "ingredient_id", id, "error", err)
+				return nil, nil, err
+			}
+			total += quantity
+		}
+
+		change := models.RoundQuantity(total * factor)
+		if item.Quantity+change < 0 {
+			s.log.InfoContext(ctx, "insufficient quantity",
+				"ingredient_id", id,
+				"available", item.Quantity,
+				"required", -change)
+			return nil, nil, fmt.Errorf("%w: %s", ErrInsufficientQuantity, id)
+		}
+
+		item.Quantity = models.RoundQuantity(item.Quantity + change)
+		items = append(items, *item)
+		movements = append(movements, models.InventoryMovement{IngredientID: id, Delta: change, Unit: item.Unit})
+	}
+
+	return items, movements, nil
+}
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestUpdateInventoryItemUnit(t *testing.T) {
+	tests := []struct {
+		name         string
+		recipeQty    float64
+		recipeUnit   string // "" measures the recipe in the unit of the item
+		newUnit      string
+		newQuantity  float64
+		wantErr      error
+		wantUnit     string  // unit of the recipe and order quantities afterwards
+		wantPOUnit   string  // unit of the unit-less purchase order quantity afterwards
+		wantCancel   float64 // quantity once the order is cancelled
+		wantReceived float64 // quantity once the purchase order is received as well
+	}{
+		{
+			name:      "unit-less quantities keep their amount",
+			recipeQty: 18, newUnit: "kg", newQuantity: 0.964,
+			wantUnit: "g", wantPOUnit: "g", wantCancel: 1, wantReceived: 1.5,
+		},
+		{
+			name:      "explicit unit is kept",
+			recipeQty: 0.018, recipeUnit: "kg", newUnit: "kg", newQuantity: 0.964,
+			wantUnit: "kg", wantPOUnit: "g", wantCancel: 1, wantReceived: 1.5,
+		},
+		{
+			name:      "incompatible unit is refused",
+			recipeQty: 18, newUnit: "ml", newQuantity: 964,
+			wantErr: models.ErrIncompatibleUnits, wantCancel: 1000, wantReceived: 1500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+			s.addMenu(t, models.MenuItem{
+				ID: "espresso", Name: "Espresso", Price: models.NewMoney(200, "USD"),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: tt.recipeQty, Unit: tt.recipeUnit}},
+			})
+
+			order, err := s.order.CreateOrder(ctx, &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "espresso", Quantity: 2}}})
+			if err != nil {
+				t.Fatalf("CreateOrder() error = %v", err)
+			}
+			purchaseOrder := &models.PurchaseOrder{Items: []models.PurchaseOrderItem{{IngredientID: "beans", Quantity: 500}}}
+			if err := s.purchaseOrder.CreatePurchaseOrder(ctx, purchaseOrder); err != nil {
+				t.Fatalf("CreatePurchaseOrder() error = %v", err)
+			}
+
+			err = s.inventory.UpdateInventoryItem(ctx, "beans", &models.InventoryItem{
+				IngredientID: "beans", Name: "Beans", Quantity: tt.newQuantity, Unit: tt.newUnit,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateInventoryItem() error = %v, want %v", err, tt.wantErr)
+			}
+
+			menuItem, _ := s.menu.GetMenuItem(ctx, "espresso")
+			if got := menuItem.Ingredients[0].Unit; got != tt.wantUnit {
+				t.Errorf("recipe unit = %q, want %q", got, tt.wantUnit)
+			}
+			stored, _ := s.order.GetOrder(ctx, order.ID)
+			if got := stored.Ingredients[0].Unit; got != tt.wantUnit {
+				t.Errorf("order ingredient unit = %q, want %q", got, tt.wantUnit)
+			}
+			storedPO, _ := s.purchaseOrder.GetPurchaseOrder(ctx, purchaseOrder.ID)
+			if got := storedPO.Items[0].Unit; got != tt.wantPOUnit {
+				t.Errorf("purchase order unit = %q, want %q", got, tt.wantPOUnit)
+			}
+
+			ledger, err := s.inventory.GetMovements(ctx, "beans")
+			if err != nil {
+				t.Fatalf("GetMovements() error = %v", err)
+			}
+			if ledger.Discrepancy != 0 {
+				t.Errorf("ledger discrepancy = %v after unit change, movements %+v", ledger.Discrepancy, ledger.Movements)
+			}
+
+			// What was taken is returned in the amount it was taken
+			if err := s.order.CancelOrder(ctx, order.ID); err != nil {
+				t.Fatalf("CancelOrder() error = %v", err)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantCancel {
+				t.Errorf("quantity after cancel = %v, want %v", got, tt.wantCancel)
+			}
+
+			if _, err := s.purchaseOrder.ReceivePurchaseOrder(ctx, purchaseOrder.ID); err != nil {
+				t.Fatalf("ReceivePurchaseOrder() error = %v", err)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantReceived {
+				t.Errorf("quantity after receipt = %v, want %v", got, tt.wantReceived)
+			}
+
+			ledger, _ = s.inventory.GetMovements(ctx, "beans")
+			if ledger.Discrepancy != 0 {
+				t.Errorf("ledger discrepancy = %v at the end", ledger.Discrepancy)
+			}
+		})
+	}
+}
+
+func TestUpdateInventoryItemUnitWithOpenPurchaseOrder(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t, models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 1000, Unit: "ml"})
+
+	purchaseOrder := &models.PurchaseOrder{Items: []models.PurchaseOrderItem{{IngredientID: "milk", Quantity: 500}}}
+	if err := s.purchaseOrder.CreatePurchaseOrder(ctx, purchaseOrder); err != nil {
+		t.Fatalf("CreatePurchaseOrder() error = %v", err)
+	}
+
+	// 500 ml on order cannot be received into grams
+	err := s.inventory.UpdateInventoryItem(ctx, "milk", &models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 1000, Unit: "g"})
+	if !errors.Is(err, models.ErrIncompatibleUnits) {
+		t.Fatalf("UpdateInventoryItem() error = %v, want ErrIncompatibleUnits", err)
+	}
+
+	item, _ := s.inventory.GetInventoryItem(ctx, "milk")
+	if item.Unit != "ml" {
+		t.Errorf("unit = %q after refused change, want ml", item.Unit)
+	}
+}
+
+func TestDeleteInventoryItem(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		cascade     bool
+		wantErr     error
+		wantDeleted bool     // the item is gone from the inventory afterwards
+		wantRecipe  []string // ingredients of the latte afterwards
+	}{
+		{name: "unused", id: "sugar", wantDeleted: true, wantRecipe: []string{"beans", "milk"}},
+		{name: "used by a recipe", id: "milk", wantErr: ErrInventoryItemInUse, wantRecipe: []string{"beans", "milk"}},
+		{name: "cascade", id: "milk", cascade: true, wantDeleted: true, wantRecipe: []string{"beans"}},
+		{name: "missing", id: "cocoa", wantErr: ErrInventoryItemNotFound, wantDeleted: true, wantRecipe: []string{"beans", "milk"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t,
+				models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"},
+				models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 2000, Unit: "ml"},
+				models.InventoryItem{IngredientID: "sugar", Name: "Sugar", Quantity: 500, Unit: "g"},
+			)
+			s.addMenu(t, models.MenuItem{
+				ID: "latte", Name: "Latte", Price: models.NewMoney(350, "USD"),
+				Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}, {IngredientID: "milk", Quantity: 200}},
+			})
+
+			err := s.inventory.DeleteInventoryItem(ctx, tt.id, tt.cascade)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DeleteInventoryItem() error = %v, want %v", err, tt.wantErr)
+			}
+
+			_, err = s.inventory.GetInventoryItem(ctx, tt.id)
+			if deleted := errors.Is(err, ErrInventoryItemNotFound); deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+
+			latte, err := s.menu.GetMenuItem(ctx, "latte")
+			if err != nil {
+				t.Fatalf("GetMenuItem() error = %v", err)
+			}
+			var got []string
+			for _, ingredient := range latte.Ingredients {
+				got = append(got, ingredient.IngredientID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantRecipe, ",") {
+				t.Errorf("recipe = %v, want %v", got, tt.wantRecipe)
+			}
+
+			// A deleted item leaves a balanced, empty ledger behind
+			if tt.wantErr == nil {
+				s.addInventory(t, models.InventoryItem{IngredientID: tt.id, Name: "Again", Quantity: 0, Unit: "g"})
+				ledger, err := s.inventory.GetMovements(ctx, tt.id)
+				if err != nil {
+					t.Fatalf("GetMovements() error = %v", err)
+				}
+				if ledger.Discrepancy != 0 {
+					t.Errorf("ledger discrepancy = %v after delete", ledger.Discrepancy)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordMovement(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		movement     models.InventoryMovement
+		wantErr      error
+		wantDelta    float64 // recorded, in the unit of the item
+		wantQuantity float64
+	}{
+		{name: "receipt", id: "beans", movement: models.InventoryMovement{Type: models.MovementReceipt, Delta: 500}, wantDelta: 500, wantQuantity: 1500},
+		{name: "waste", id: "beans", movement: models.InventoryMovement{Type: models.MovementWaste, Delta: -200, Reason: "spilled"}, wantDelta: -200, wantQuantity: 800},
+		{name: "other unit", id: "beans", movement: models.InventoryMovement{Type: models.MovementReceipt, Delta: 0.25, Unit: "kg"}, wantDelta: 250, wantQuantity: 1250},
+		{name: "incompatible unit", id: "beans", movement: models.InventoryMovement{Type: models.MovementReceipt, Delta: 1, Unit: "l"}, wantErr: models.ErrIncompatibleUnits, wantQuantity: 1000},
+		{name: "below zero", id: "beans", movement: models.InventoryMovement{Type: models.MovementWaste, Delta: -1001}, wantErr: ErrInsufficientQuantity, wantQuantity: 1000},
+		{name: "missing item", id: "cocoa", movement: models.InventoryMovement{Type: models.MovementReceipt, Delta: 1}, wantErr: ErrInventoryItemNotFound, wantQuantity: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+
+			movement := tt.movement
+			err := s.inventory.RecordMovement(ctx, tt.id, &movement)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RecordMovement() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantQuantity {
+				t.Errorf("quantity = %v, want %v", got, tt.wantQuantity)
+			}
+
+			ledger, err := s.inventory.GetMovements(ctx, "beans")
+			if err != nil {
+				t.Fatalf("GetMovements() error = %v", err)
+			}
+			if ledger.Discrepancy != 0 {
+				t.Errorf("discrepancy = %v, want 0", ledger.Discrepancy)
+			}
+			if tt.wantErr != nil {
+				if len(ledger.Movements) != 1 {
+					t.Errorf("%d movements after a refused one, want only the initial stock", len(ledger.Movements))
+				}
+				return
+			}
+
+			if movement.ID == "" || movement.IngredientID != "beans" || movement.Unit != "g" || movement.Delta != tt.wantDelta {
+				t.Errorf("recorded movement = %+v, want delta %v g", movement, tt.wantDelta)
+			}
+			last := ledger.Movements[len(ledger.Movements)-1]
+			if last.ID != movement.ID || last.Type != tt.movement.Type || last.Reason != tt.movement.Reason {
+				t.Errorf("last movement = %+v, want %+v", last, movement)
+			}
+		})
+	}
+}
+
+func TestGetMovements(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+	if err := s.inventory.RecordMovement(ctx, "beans", &models.InventoryMovement{Type: models.MovementWaste, Delta: -100}); err != nil {
+		t.Fatalf("RecordMovement() error = %v", err)
+	}
+
+	ledger, err := s.inventory.GetMovements(ctx, "beans")
+	if err != nil {
+		t.Fatalf("GetMovements() error = %v", err)
+	}
+	if ledger.Quantity != 900 || ledger.LedgerQuantity != 900 || ledger.Discrepancy != 0 || len(ledger.Movements) != 2 {
+		t.Errorf("ledger = %+v, want 900 on both sides over 2 movements", ledger)
+	}
+
+	// A quantity changed behind the ledger's back shows as a discrepancy
+	item, _ := s.inventory.inventoryRepo.GetByID(ctx, "beans")
+	item.Quantity = 950
+	if err := s.inventory.inventoryRepo.Update(ctx, item); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	ledger, _ = s.inventory.GetMovements(ctx, "beans")
+	if ledger.LedgerQuantity != 900 || ledger.Discrepancy != 50 {
+		t.Errorf("ledger = %+v, want ledger quantity 900 and discrepancy 50", ledger)
+	}
+
+	// The history of a deleted item stays, one never stocked is not found
+	if err := s.inventory.DeleteInventoryItem(ctx, "beans", false); err != nil {
+		t.Fatalf("DeleteInventoryItem() error = %v", err)
+	}
+	if ledger, err := s.inventory.GetMovements(ctx, "beans"); err != nil || ledger.Quantity != 0 {
+		t.Errorf("GetMovements() after delete = %+v, %v, want the history", ledger, err)
+	}
+	if _, err := s.inventory.GetMovements(ctx, "cocoa"); !errors.Is(err, ErrInventoryItemNotFound) {
+		t.Errorf("GetMovements(cocoa) error = %v, want ErrInventoryItemNotFound", err)
+	}
+}
+
+func TestOpenLedger(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+
+	// Stock from before the ledger was kept, and none at all
+	for _, item := range []models.InventoryItem{
+		{IngredientID: "milk", Name: "Milk", Quantity: 2000, Unit: "ml"},
+		{IngredientID: "sugar", Name: "Sugar", Quantity: 0, Unit: "g"},
+	} {
+		if err := s.inventory.inventoryRepo.Create(ctx, &item); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	// Running it again, as every start does, opens nothing twice
+	for range 2 {
+		if err := s.inventory.OpenLedger(ctx); err != nil {
+			t.Fatalf("OpenLedger() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		id            string
+		wantMovements int
+	}{
+		{id: "beans", wantMovements: 1},
+		{id: "milk", wantMovements: 1},
+		{id: "sugar", wantMovements: 0},
+	}
+	for _, tt := range tests {
+		ledger, err := s.inventory.GetMovements(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("GetMovements(%s) error = %v", tt.id, err)
+		}
+		if ledger.Discrepancy != 0 || len(ledger.Movements) != tt.wantMovements {
+			t.Errorf("%s: discrepancy %v over %d movements, want 0 over %d", tt.id, ledger.Discrepancy, len(ledger.Movements), tt.wantMovements)
+		}
+	}
+
+	milk, _ := s.inventory.GetMovements(ctx, "milk")
+	if opening := milk.Movements[0]; opening.Type != models.MovementOpening || opening.Delta != 2000 || opening.Unit != "ml" {
+		t.Errorf("opening movement = %+v, want 2000 ml", opening)
+	}
+}
+
+func TestCountPortions(t *testing.T) {
+	tests := []struct {
+		name         string
+		ingredients  []models.MenuItemIngredient
+		wantPortions int
+		wantLimited  bool
+	}{
+		{name: "no ingredients"},
+		{name: "stock unit", ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 0.018}}, wantPortions: 55, wantLimited: true},
+		{name: "grams of kilograms", ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18, Unit: "g"}}, wantPortions: 55, wantLimited: true},
+		{
+			name:         "same ingredient twice adds up",
+			ingredients:  []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18, Unit: "g"}, {IngredientID: "beans", Quantity: 0.002}},
+			wantPortions: 50, wantLimited: true,
+		},
+		{name: "shots of millilitres", ingredients: []models.MenuItemIngredient{{IngredientID: "espresso", Quantity: 2, Unit: "shots"}}, wantPortions: 1, wantLimited: true},
+		{name: "millilitres of shots", ingredients: []models.MenuItemIngredient{{IngredientID: "syrup", Quantity: 25, Unit: "ml"}}, wantPortions: 4, wantLimited: true},
+		{name: "no residue lost to rounding", ingredients: []models.MenuItemIngredient{{IngredientID: "water", Quantity: 100, Unit: "ml"}}, wantPortions: 3, wantLimited: true},
+		{
+			name:         "scarcest ingredient limits",
+			ingredients:  []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18, Unit: "g"}, {IngredientID: "milk", Quantity: 200}},
+			wantPortions: 10, wantLimited: true,
+		},
+		{name: "zero stock", ingredients: []models.MenuItemIngredient{{IngredientID: "sugar", Quantity: 5}}, wantPortions: 0, wantLimited: true},
+		{
+			name:         "missing ingredient",
+			ingredients:  []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18, Unit: "g"}, {IngredientID: "cocoa", Quantity: 10}},
+			wantPortions: 0, wantLimited: true,
+		},
+		{name: "incompatible unit", ingredients: []models.MenuItemIngredient{{IngredientID: "milk", Quantity: 10, Unit: "g"}}, wantPortions: 0, wantLimited: true},
+	}
+
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t,
+		models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1, Unit: "kg"},
+		models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 2000, Unit: "ml"},
+		models.InventoryItem{IngredientID: "espresso", Name: "Espresso", Quantity: 100, Unit: "ml", ShotSize: 30},
+		models.InventoryItem{IngredientID: "syrup", Name: "Syrup", Quantity: 4, Unit: "shots", ShotSize: 25},
+		models.InventoryItem{IngredientID: "water", Name: "Water", Quantity: 0.3, Unit: "l"},
+		models.InventoryItem{IngredientID: "sugar", Name: "Sugar", Quantity: 0, Unit: "g"},
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portions, limited, err := s.inventory.CountPortions(ctx, tt.ingredients)
+			if err != nil {
+				t.Fatalf("CountPortions() error = %v", err)
+			}
+			if portions != tt.wantPortions || limited != tt.wantLimited {
+				t.Errorf("CountPortions() = %d, %v, want %d, %v", portions, limited, tt.wantPortions, tt.wantLimited)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 
 	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
@@ -9,18 +11,23 @@ import (
 )
 
 type MenuService interface {
-	CreateMenuItems(items *[]models.MenuItem) (*models.MenuItem, error)
-	CreateMenuItem(item *models.MenuItem) error
-	GetMenuItem(id string) (*models.MenuItem, error)
-	GetAllMenuItems() (*[]models.MenuItem, error)
-	GetAvailableMenuItems() (*[]models.MenuItem, error)
-	UpdateMenuItem(id string, item *models.MenuItem) error
-	DeleteMenuItem(id string) error
-
-	IsMenuAvailable(id string, quantity int) (bool, error)
-	PrepareMenu(id string, quantity int) error
-
-	GetPriceByID(id string) (float64, error)
+	CreateMenuItems(ctx context.Context, items *[]models.MenuItem) (*models.MenuItem, error)
+	CreateMenuItem(ctx context.Context, item *models.MenuItem) error
+	ImportMenuItems(ctx context.Context, items []models.MenuItem, upsert, dryRun bool) (*models.ImportResult, error)
+	GetMenuItem(ctx context.Context, id string) (*models.MenuItem, error)
+	GetAllMenuItems(ctx context.Context) (*[]models.MenuItem, error)
+	ListMenuItems(ctx context.Context, filter models.MenuFilter, opts models.ListOptions) (*[]models.MenuItem, int, error)
+	GetAvailableMenuItems(ctx context.Context) (*[]models.AvailableMenuItem, error)
+	UpdateMenuItem(ctx context.Context, id string, item *models.MenuItem) error
+	DeleteMenuItem(ctx context.Context, id string) error
+
+	IsMenuAvailable(ctx context.Context, id string, quantity int) (bool, error)
+	PrepareMenu(ctx context.Context, id string, quantity int) error
+	GetOrderIngredients(ctx context.Context, items []models.OrderItem) ([]models.MenuItemIngredient, error)
+
+	GetPriceByID(ctx context.Context, id string) (models.Money, error)
+
+	WithTx(tx *repository.Tx) MenuService
 }
 
 var (
@@ -32,188 +39,354 @@ var (
 type menuService struct {
 	menuRepo         repository.MenuRepository
 	inventoryService InventoryService
+	transactor       repository.Transactor
 	log              *slog.Logger
 }
 
-// NewMenuService initializes MenuService with repository and logging
-func NewMenuService(menuRepo repository.MenuRepository, inventoryService InventoryService, log *slog.Logger) menuService {
+// NewMenuService initializes MenuService with repository, transactor and logging
+func NewMenuService(menuRepo repository.MenuRepository, inventoryService InventoryService, transactor repository.Transactor, log *slog.Logger) menuService {
 	return menuService{
 		menuRepo:         menuRepo,
 		inventoryService: inventoryService,
+		transactor:       transactor,
 		log:              log,
 	}
 }
 
-func (s menuService) CreateMenuItems(items *[]models.MenuItem) (*models.MenuItem, error) {
-	s.log.Info("CreateMenuItems called")
+// WithTx returns a service whose changes become part of tx
+func (s menuService) WithTx(tx *repository.Tx) MenuService {
+	return s.withTx(tx)
+}
 
-	for _, item := range *items {
-		if err := s.CreateMenuItem(&item); err != nil {
-			return &item, err
+func (s menuService) withTx(tx *repository.Tx) menuService {
+	s.menuRepo = s.menuRepo.WithTx(tx)
+	s.inventoryService = s.inventoryService.WithTx(tx)
+	s.transactor = tx
+	return s
+}
+
+// atomically runs fn with a copy of the service bound to a transaction
+func (s menuService) atomically(ctx context.Context, fn func(s menuService) error) error {
+	return s.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		return fn(s.withTx(tx))
+	})
+}
+
+func (s menuService) CreateMenuItems(ctx context.Context, items *[]models.MenuItem) (*models.MenuItem, error) {
+	s.log.InfoContext(ctx, "CreateMenuItems called")
+
+	var failed *models.MenuItem
+	err := s.atomically(ctx, func(s menuService) error {
+		for _, item := range *items {
+			if err := s.CreateMenuItem(ctx, &item); err != nil {
+				failed = &item
+				return err
+			}
 		}
-	}
-	return nil, nil
+		return nil
+	})
+	return failed, err
 }
 
-func (s menuService) CreateMenuItem(item *models.MenuItem) error {
-	s.log.Info("CreateMenuItem called")
+func (s menuService) CreateMenuItem(ctx context.Context, item *models.MenuItem) error {
+	s.log.InfoContext(ctx, "CreateMenuItem called")
 
-	// 1. Check if item already exists
-	existingItem, err := s.menuRepo.GetByID(item.ID)
-	if err != nil {
-		s.log.Error("failed to check existing menu item")
-		return err
-	}
+	return s.atomically(ctx, func(s menuService) error {
+		// 1. Check if item already exists
+		existingItem, err := s.menuRepo.GetByID(ctx, item.ID)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing menu item")
+			return err
+		}
 
-	// 2. If item exists, return an error
-	if existingItem != nil {
-		s.log.Error("menu item already exists")
-		return ErrMenuItemAlreadyExists
-	}
+		// 2. If item exists, return an error
+		if existingItem != nil {
+			s.log.ErrorContext(ctx, "menu item already exists")
+			return ErrMenuItemAlreadyExists
+		}
 
-	// 3. Create the item
-	if err := s.menuRepo.Create(item); err != nil {
-		s.log.Error("failed to create menu item")
-		return err
-	}
+		// 3. Make sure the recipe only uses inventory items, in units they convert from
+		if err := s.inventoryService.CheckRecipe(ctx, item.Ingredients); err != nil {
+			s.log.ErrorContext(ctx, "recipe does not match the inventory", "error", err)
+			return err
+		}
 
-	return nil
+		// 4. Create the item
+		if err := s.menuRepo.Create(ctx, item); err != nil {
+			s.log.ErrorContext(ctx, "failed to create menu item")
+			return err
+		}
+
+		return nil
+	})
 }
 
-func (s menuService) GetMenuItem(id string) (*models.MenuItem, error) {
-	s.log.Info("GetMenuItem called")
+// ImportMenuItems creates the items, or with upsert also updates the ones
+// that exist, in a single transaction. items[i] is reported as row i+2, the
+// row after the header. Rows that fail are listed in the result and nothing
+// is saved; a dry run reports the same but never saves.
+func (s menuService) ImportMenuItems(ctx context.Context, items []models.MenuItem, upsert, dryRun bool) (*models.ImportResult, error) {
+	s.log.InfoContext(ctx, "ImportMenuItems called", "count", len(items), "upsert", upsert, "dry_run", dryRun)
+
+	result := models.NewImportResult(dryRun, upsert)
+	err := s.atomically(ctx, func(s menuService) error {
+		for i := range items {
+			item := &items[i]
+
+			existing, err := s.menuRepo.GetByID(ctx, item.ID)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to check existing menu item")
+				return err
+			}
+
+			switch {
+			case existing == nil:
+				if err = s.CreateMenuItem(ctx, item); err == nil {
+					result.Created = append(result.Created, item.ID)
+				}
+			case upsert:
+				if err = s.UpdateMenuItem(ctx, item.ID, item); err == nil {
+					result.Updated = append(result.Updated, item.ID)
+				}
+			default:
+				err = ErrMenuItemAlreadyExists
+			}
+
+			if err != nil {
+				if !isImportRowError(err) {
+					return err
+				}
+				result.AddError(i+2, item.ID, err)
+			}
+		}
+		return endImport(result)
+	})
+	return result, importOutcome(err)
+}
+
+func (s menuService) GetMenuItem(ctx context.Context, id string) (*models.MenuItem, error) {
+	s.log.InfoContext(ctx, "GetMenuItem called")
 
-	item, err := s.menuRepo.GetByID(id)
+	item, err := s.menuRepo.GetByID(ctx, id)
 	if err != nil {
-		s.log.Error("failed to get menu item")
+		s.log.ErrorContext(ctx, "failed to get menu item")
 		return nil, err
 	}
 
 	return item, nil
 }
 
-func (s menuService) GetAllMenuItems() (*[]models.MenuItem, error) {
-	s.log.Info("GetAllMenuItems called")
+func (s menuService) GetAllMenuItems(ctx context.Context) (*[]models.MenuItem, error) {
+	s.log.InfoContext(ctx, "GetAllMenuItems called")
 
-	items, err := s.menuRepo.GetAll()
+	items, err := s.menuRepo.GetAll(ctx)
 	if err != nil {
-		s.log.Error("failed to get all menu items")
+		s.log.ErrorContext(ctx, "failed to get all menu items")
 		return nil, err
 	}
 
 	return items, nil
 }
 
-func (s menuService) GetAvailableMenuItems() (*[]models.MenuItem, error) {
-	s.log.Info("GetAvailableMenuItems called")
+// ListMenuItems returns a page of the menu items that pass the filter and
+// the number of items that pass it
+func (s menuService) ListMenuItems(ctx context.Context, filter models.MenuFilter, opts models.ListOptions) (*[]models.MenuItem, int, error) {
+	s.log.InfoContext(ctx, "ListMenuItems called")
+
+	items, total, err := s.menuRepo.List(ctx, filter, opts)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to list menu items")
+		return nil, 0, err
+	}
 
-	return nil, nil
+	return items, total, nil
 }
 
-func (s menuService) UpdateMenuItem(id string, item *models.MenuItem) error {
-	s.log.Info("UpdateMenuItem called")
+// GetAvailableMenuItems returns every menu item with the number of portions
+// that can be made from the current stock
+func (s menuService) GetAvailableMenuItems(ctx context.Context) (*[]models.AvailableMenuItem, error) {
+	s.log.InfoContext(ctx, "GetAvailableMenuItems called")
 
-	// 1. Check if item exists
-	existingItem, err := s.menuRepo.GetByID(id)
+	items, err := s.menuRepo.GetAll(ctx)
 	if err != nil {
-		s.log.Error("failed to check existing menu item")
-		return err
+		s.log.ErrorContext(ctx, "failed to get all menu items")
+		return nil, err
 	}
 
-	// 2. If item does not exist, return an error
-	if existingItem == nil {
-		s.log.Error("menu item not found")
-		return ErrMenuItemNotFound
-	}
+	available := make([]models.AvailableMenuItem, 0, len(*items))
+	for _, item := range *items {
+		portions, limited, err := s.inventoryService.CountPortions(ctx, item.Ingredients)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to count portions", "error", err, "id", item.ID)
+			return nil, err
+		}
 
-	// 3. Update the item
-	if err := s.menuRepo.Update(item); err != nil {
-		s.log.Error("failed to update menu item")
-		return err
+		entry := models.AvailableMenuItem{MenuItem: item, Available: !limited || portions > 0}
+		if limited {
+			entry.Portions = &portions
+		}
+		available = append(available, entry)
 	}
 
-	return nil
+	return &available, nil
 }
 
-func (s menuService) DeleteMenuItem(id string) error {
-	s.log.Info("DeleteMenuItem called")
+func (s menuService) UpdateMenuItem(ctx context.Context, id string, item *models.MenuItem) error {
+	s.log.InfoContext(ctx, "UpdateMenuItem called")
 
-	// 1. Check if item exists
-	existingItem, err := s.menuRepo.GetByID(id)
-	if err != nil {
-		s.log.Error("failed to check existing menu item")
-		return err
-	}
+	return s.atomically(ctx, func(s menuService) error {
+		// 1. Check if item exists
+		existingItem, err := s.menuRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing menu item")
+			return err
+		}
 
-	// 2. If item does not exist, return an error
-	if existingItem == nil {
-		s.log.Error("menu item not found")
-		return ErrMenuItemNotFound
-	}
+		// 2. If item does not exist, return an error
+		if existingItem == nil {
+			s.log.ErrorContext(ctx, "menu item not found")
+			return ErrMenuItemNotFound
+		}
 
-	// 3. Delete the item
-	if err := s.menuRepo.Delete(id); err != nil {
-		s.log.Error("failed to delete menu item")
-		return err
-	}
+		// 3. Make sure the recipe only uses inventory items, in units they convert from
+		if err := s.inventoryService.CheckRecipe(ctx, item.Ingredients); err != nil {
+			s.log.ErrorContext(ctx, "recipe does not match the inventory", "error", err)
+			return err
+		}
 
-	return nil
+		// 4. Update the item
+		if err := s.menuRepo.Update(ctx, item); err != nil {
+			s.log.ErrorContext(ctx, "failed to update menu item")
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s menuService) DeleteMenuItem(ctx context.Context, id string) error {
+	s.log.InfoContext(ctx, "DeleteMenuItem called")
+
+	return s.atomically(ctx, func(s menuService) error {
+		// 1. Check if item exists
+		existingItem, err := s.menuRepo.GetByID(ctx, id)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to check existing menu item")
+			return err
+		}
+
+		// 2. If item does not exist, return an error
+		if existingItem == nil {
+			s.log.ErrorContext(ctx, "menu item not found")
+			return ErrMenuItemNotFound
+		}
+
+		// 3. Delete the item
+		if err := s.menuRepo.Delete(ctx, id); err != nil {
+			s.log.ErrorContext(ctx, "failed to delete menu item")
+			return err
+		}
+
+		return nil
+	})
 }
 
-func (s menuService) IsMenuAvailable(id string, quantity int) (bool, error) {
-	s.log.Info("IsMenuAvailable called")
+func (s menuService) IsMenuAvailable(ctx context.Context, id string, quantity int) (bool, error) {
+	s.log.InfoContext(ctx, "IsMenuAvailable called")
 
-	item, err := s.menuRepo.GetByID(id)
+	ingredients, err := s.menuRepo.GetRequiredIngredients(ctx, id)
 	if err != nil {
-		s.log.Error("failed to get menu item")
+		s.log.ErrorContext(ctx, "failed to get menu item ingredients")
 		return false, err
 	}
 
-	if item == nil {
-		s.log.Error("menu item not found")
+	if ingredients == nil {
+		s.log.ErrorContext(ctx, "menu item not found")
 		return false, ErrMenuItemNotFound
 	}
 
-	ok, err := s.inventoryService.CheckIngredients(item.Ingredients, quantity)
+	ok, err := s.inventoryService.CheckIngredients(ctx, *ingredients, quantity)
 	if err != nil {
-		s.log.Error("failed to check ingredients availability")
+		s.log.ErrorContext(ctx, "failed to check ingredients availability")
 		return false, err
 	}
 
 	if !ok {
-		s.log.Error("ingredients not available")
+		s.log.ErrorContext(ctx, "ingredients not available")
 		return false, nil
 	}
 
 	return true, nil
 }
 
-func (s menuService) PrepareMenu(id string, quantity int) error {
-	s.log.Info("PrepareMenu called")
+func (s menuService) PrepareMenu(ctx context.Context, id string, quantity int) error {
+	s.log.InfoContext(ctx, "PrepareMenu called")
 
-	item, err := s.menuRepo.GetByID(id)
+	item, err := s.menuRepo.GetByID(ctx, id)
 	if err != nil {
-		s.log.Error("failed to get menu item")
+		s.log.ErrorContext(ctx, "failed to get menu item")
 		return err
 	}
 
 	if item == nil {
-		s.log.Error("menu item not found")
+		s.log.ErrorContext(ctx, "menu item not found")
 		return ErrMenuItemNotFound
 	}
 
-	if err := s.inventoryService.DeductIngredients(item.Ingredients, quantity); err != nil {
-		s.log.Error("failed to use ingredients")
+	if err := s.inventoryService.DeductIngredients(ctx, item.Ingredients, quantity, ""); err != nil {
+		s.log.ErrorContext(ctx, "failed to use ingredients")
 		return err
 	}
 
 	return nil
 }
 
-func (s menuService) GetPriceByID(id string) (float64, error) {
-	menuItem, err := s.menuRepo.GetByID(id)
+// GetOrderIngredients sums the recipe ingredients of every order item into a
+// single list with one entry per ingredient and unit.
+func (s menuService) GetOrderIngredients(ctx context.Context, items []models.OrderItem) ([]models.MenuItemIngredient, error) {
+	s.log.InfoContext(ctx, "GetOrderIngredients called")
+
+	var ingredients []models.MenuItemIngredient
+	index := make(map[models.MenuItemIngredient]int) // keyed by ID and unit
+
+	for _, orderItem := range items {
+		item, err := s.menuRepo.GetByID(ctx, orderItem.ProductID)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to get menu item")
+			return nil, err
+		}
+
+		if item == nil {
+			s.log.ErrorContext(ctx, "menu item not found", "product_id", orderItem.ProductID)
+			return nil, fmt.Errorf("%w: %s", ErrMenuItemNotFound, orderItem.ProductID)
+		}
+
+		for _, ingredient := range item.Ingredients {
+			quantity := ingredient.Quantity * float64(orderItem.Quantity)
+			key := models.MenuItemIngredient{IngredientID: ingredient.IngredientID, Unit: ingredient.Unit}
+			if i, ok := index[key]; ok {
+				ingredients[i].Quantity += quantity
+				continue
+			}
+			index[key] = len(ingredients)
+			ingredients = append(ingredients, models.MenuItemIngredient{
+				IngredientID: ingredient.IngredientID,
+				Quantity:     quantity,
+				Unit:         ingredient.Unit,
+			})
+		}
+	}
+
+	return ingredients, nil
+}
+
+func (s menuService) GetPriceByID(ctx context.Context, id string) (models.Money, error) {
+	menuItem, err := s.menuRepo.GetByID(ctx, id)
 	if err != nil {
-		return 0, err
+		return models.Money{}, err
+	}
+	if menuItem == nil {
+		return models.Money{}, ErrMenuItemNotFound
 	}
 	return menuItem.Price, nil
 }
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestMenuItemRecipe(t *testing.T) {
+	tests := []struct {
+		name       string
+		ingredient models.MenuItemIngredient
+		wantErr    error
+	}{
+		{name: "stocked ingredient", ingredient: models.MenuItemIngredient{IngredientID: "milk", Quantity: 200}},
+		{name: "convertible unit", ingredient: models.MenuItemIngredient{IngredientID: "milk", Quantity: 0.2, Unit: "l"}},
+		{name: "missing ingredient", ingredient: models.MenuItemIngredient{IngredientID: "cocoa", Quantity: 10}, wantErr: ErrInventoryItemNotFound},
+		{name: "incompatible unit", ingredient: models.MenuItemIngredient{IngredientID: "milk", Quantity: 200, Unit: "g"}, wantErr: models.ErrIncompatibleUnits},
+		{name: "unknown unit", ingredient: models.MenuItemIngredient{IngredientID: "milk", Quantity: 1, Unit: "cups"}, wantErr: models.ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t, models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 2000, Unit: "ml"})
+
+			item := models.MenuItem{
+				ID: "latte", Name: "Latte", Price: models.NewMoney(350, "USD"),
+				Ingredients: []models.MenuItemIngredient{tt.ingredient},
+			}
+			err := s.menu.CreateMenuItem(ctx, &item)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateMenuItem() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if stored, _ := s.menu.GetMenuItem(ctx, "latte"); stored != nil {
+					t.Errorf("menu item stored despite the error: %+v", stored)
+				}
+			}
+
+			// Updates are held to the same rule
+			s.addMenu(t, models.MenuItem{ID: "tea", Name: "Tea", Price: models.NewMoney(200, "USD")})
+			update := models.MenuItem{
+				ID: "tea", Name: "Tea", Price: models.NewMoney(200, "USD"),
+				Ingredients: []models.MenuItemIngredient{tt.ingredient},
+			}
+			if err := s.menu.UpdateMenuItem(ctx, "tea", &update); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateMenuItem() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetAvailableMenuItems(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t,
+		models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 0.1, Unit: "kg"},
+		models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 1, Unit: "l"},
+		models.InventoryItem{IngredientID: "shot", Name: "Shot", Quantity: 90, Unit: "ml", ShotSize: 30},
+		models.InventoryItem{IngredientID: "sugar", Name: "Sugar", Quantity: 0, Unit: "g"},
+	)
+	s.addMenu(t,
+		models.MenuItem{ID: "espresso", Name: "Espresso", Price: models.NewMoney(200, "USD"), Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18, Unit: "g"}}},
+		models.MenuItem{ID: "latte", Name: "Latte", Price: models.NewMoney(350, "USD"), Ingredients: []models.MenuItemIngredient{{IngredientID: "shot", Quantity: 2, Unit: "shots"}, {IngredientID: "milk", Quantity: 200, Unit: "ml"}}},
+		models.MenuItem{ID: "sweet", Name: "Sweet", Price: models.NewMoney(100, "USD"), Ingredients: []models.MenuItemIngredient{{IngredientID: "sugar", Quantity: 5}}},
+		models.MenuItem{ID: "water", Name: "Water", Price: models.NewMoney(50, "USD")},
+	)
+	// A recipe whose ingredient has left the inventory since, written past the check
+	if err := s.menu.menuRepo.Create(ctx, &models.MenuItem{
+		ID: "mocha", Name: "Mocha", Price: models.NewMoney(400, "USD"),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "cocoa", Quantity: 10}},
+	}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	items, err := s.menu.GetAvailableMenuItems(ctx)
+	if err != nil {
+		t.Fatalf("GetAvailableMenuItems() error = %v", err)
+	}
+
+	tests := []struct {
+		id            string
+		wantAvailable bool
+		wantPortions  int // -1 when stock does not limit the item
+	}{
+		{id: "espresso", wantAvailable: true, wantPortions: 5},
+		{id: "latte", wantAvailable: true, wantPortions: 1},
+		{id: "sweet", wantAvailable: false, wantPortions: 0},
+		{id: "water", wantAvailable: true, wantPortions: -1},
+		{id: "mocha", wantAvailable: false, wantPortions: 0},
+	}
+	if len(*items) != len(tests) {
+		t.Fatalf("%d menu items, want %d", len(*items), len(tests))
+	}
+	byID := make(map[string]models.AvailableMenuItem, len(*items))
+	for _, item := range *items {
+		byID[item.ID] = item
+	}
+	for _, tt := range tests {
+		item := byID[tt.id]
+		portions := -1
+		if item.Portions != nil {
+			portions = *item.Portions
+		}
+		if item.Available != tt.wantAvailable || portions != tt.wantPortions {
+			t.Errorf("%s: available %v, portions %d, want %v, %d", tt.id, item.Available, portions, tt.wantAvailable, tt.wantPortions)
+		}
+	}
+}
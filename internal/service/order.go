@@ -1,28 +1,39 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/ab-dauletkhan/hot-coffee/internal/metrics"
 	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
 	"github.com/ab-dauletkhan/hot-coffee/models"
 )
 
 type OrderService interface {
-	CreateOrder(order *models.Order) (models.Order, error)
-	GetOrder(id string) (*models.Order, error)
-	GetAllOrders() (*[]models.Order, error)
-	UpdateOrder(id string, order *models.Order) error
-	DeleteOrder(id string) error
-	CloseOrder(id string) error
+	CreateOrder(ctx context.Context, order *models.Order) (models.Order, error)
+	GetOrder(ctx context.Context, id string) (*models.Order, error)
+	GetAllOrders(ctx context.Context) (*[]models.Order, error)
+	ListOrders(ctx context.Context, filter models.OrderFilter, opts models.ListOptions) (*[]models.Order, int, error)
+	UpdateOrder(ctx context.Context, id string, order *models.Order) error
+	DeleteOrder(ctx context.Context, id string) error
+	CloseOrder(ctx context.Context, id string) error
+	StartOrder(ctx context.Context, id string) error
+	MarkOrderReady(ctx context.Context, id string) error
+	CancelOrder(ctx context.Context, id string) error
 
 	NewOrderID(name string) string
 
-	GetTotalSales() (*models.Sales, error)
-	PopularItems() (*models.PopularItems, error)
+	GetTotalSales(ctx context.Context, filter models.ReportFilter) (*models.Sales, error)
+	GetSales(ctx context.Context, filter models.ReportFilter, groupBy string) (*models.SalesReport, error)
+	PopularItems(ctx context.Context, filter models.ReportFilter) (*models.PopularItems, error)
 }
 
 // OrderService handles business logic for orders
@@ -30,6 +41,8 @@ type orderService struct {
 	orderRepo        repository.OrderRepository
 	menuService      MenuService
 	inventoryService InventoryService
+	transactor       repository.Transactor
+	taxRate          float64 // percent
 	log              *slog.Logger
 }
 
@@ -38,85 +51,176 @@ var (
 	ErrOrderExists    = errors.New("order already exists")
 	ErrOrderClosed    = errors.New("order is already closed")
 	ErrOrderNotClosed = errors.New("order is not closed")
+	ErrOrderCancelled = errors.New("order is cancelled")
+
+	ErrInvalidTransition = errors.New("status change not allowed")
+	ErrInvalidGrouping   = errors.New("unknown sales grouping")
 )
 
-// NewOrderService initializes OrderService with repositories and logging
-func NewOrderService(orderRepo repository.OrderRepository, menuService MenuService, inventoryService InventoryService, log *slog.Logger) orderService {
+// NewOrderService initializes OrderService with repositories, transactor and logging.
+// taxRate is the sales tax in percent added to every order.
+func NewOrderService(orderRepo repository.OrderRepository, menuService MenuService, inventoryService InventoryService, transactor repository.Transactor, taxRate float64, log *slog.Logger) orderService {
 	return orderService{
 		orderRepo:        orderRepo,
 		menuService:      menuService,
 		inventoryService: inventoryService,
+		transactor:       transactor,
+		taxRate:          taxRate,
 		log:              log,
 	}
 }
 
-func (r orderService) CreateOrder(order *models.Order) (models.Order, error) {
-	r.log.Info("CreateOrder called")
+// atomically runs fn with a copy of the service bound to a transaction
+func (r orderService) atomically(ctx context.Context, fn func(r orderService) error) error {
+	return r.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		r.orderRepo = r.orderRepo.WithTx(tx)
+		r.menuService = r.menuService.WithTx(tx)
+		r.inventoryService = r.inventoryService.WithTx(tx)
+		r.transactor = tx
+		return fn(r)
+	})
+}
 
-	for _, item := range order.Items {
-		ok, err := r.menuService.IsMenuAvailable(item.ProductID, item.Quantity)
-		if err != nil {
-			if errors.Is(err, ErrMenuItemNotFound) {
-				return models.Order{}, fmt.Errorf("product %s not found", item.ProductID)
-			}
-			return models.Order{}, err
-		}
+func (r orderService) CreateOrder(ctx context.Context, order *models.Order) (models.Order, error) {
+	r.log.InfoContext(ctx, "CreateOrder called")
 
-		if !ok {
-			return models.Order{}, fmt.Errorf("product %s is not available", item.ProductID)
-		}
+	// Reserve the whole order in one step so that concurrent orders cannot
+	// both pass the availability check and overdraw the inventory.
+	ingredients, err := r.menuService.GetOrderIngredients(ctx, order.Items)
+	if err != nil {
+		return models.Order{}, err
 	}
 
-	for _, item := range order.Items {
-		err := r.menuService.PrepareMenu(item.ProductID, item.Quantity)
-		if err != nil {
-			return models.Order{}, err
-		}
+	if err := r.priceOrder(ctx, order, nil); err != nil {
+		return models.Order{}, err
 	}
 
 	customer_name := strings.ReplaceAll(strings.ToLower(order.CustomerName), " ", "_")
+	now := time.Now()
 	order.ID = r.NewOrderID(customer_name)
-	order.Status = models.StatusPending
-	order.CreatedAt = time.Now().Format(time.RFC3339)
-
-	err := r.orderRepo.Create(order)
+	order.CreatedAt = now.Format(time.RFC3339)
+	order.StatusHistory = nil
+	order.SetStatus(models.StatusPending, now)
+	order.Ingredients = ingredients
+
+	// Deduct the ingredients and save the order in one transaction, so the
+	// inventory and the orders never disagree, even across a crash.
+	err = r.atomically(ctx, func(r orderService) error {
+		if err := r.inventoryService.DeductIngredients(ctx, ingredients, 1, order.ID); err != nil {
+			return err
+		}
+		if err := r.orderRepo.Create(ctx, order); err != nil {
+			if errors.Is(err, repository.ErrRecordExists) {
+				return fmt.Errorf("%w: %s", ErrOrderExists, order.ID)
+			}
+			return err
+		}
+		return nil
+	})
 	if err != nil {
 		return models.Order{}, err
 	}
 
+	metrics.OrdersCreated.Inc()
 	return *order, nil
 }
 
-func (r orderService) CloseOrder(id string) error {
-	r.log.Info("CloseOrder called")
+func (r orderService) CloseOrder(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "CloseOrder called")
 
-	order, err := r.orderRepo.GetByID(id)
-	if err != nil {
+	return r.transition(ctx, id, models.StatusCompleted)
+}
+
+func (r orderService) StartOrder(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "StartOrder called")
+
+	return r.transition(ctx, id, models.StatusInProgress)
+}
+
+func (r orderService) MarkOrderReady(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "MarkOrderReady called")
+
+	return r.transition(ctx, id, models.StatusReady)
+}
+
+// CancelOrder cancels the order and returns its ingredients to the inventory
+func (r orderService) CancelOrder(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "CancelOrder called")
+
+	return r.atomically(ctx, func(r orderService) error {
+		order, err := r.transitionOrder(ctx, id, models.StatusCancelled)
+		if err != nil {
+			return err
+		}
+
+		return r.restockOrder(ctx, order)
+	})
+}
+
+// transition moves the order to status if the lifecycle allows it
+func (r orderService) transition(ctx context.Context, id, status string) error {
+	return r.atomically(ctx, func(r orderService) error {
+		_, err := r.transitionOrder(ctx, id, status)
 		return err
+	})
+}
+
+// transitionOrder changes the status of the order and returns the updated
+// order. It must run inside a transaction.
+func (r orderService) transitionOrder(ctx context.Context, id, status string) (*models.Order, error) {
+	order, err := r.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
 	if order == nil {
-		return ErrOrderNotFound
+		return nil, ErrOrderNotFound
+	}
+
+	if !order.CanTransition(status) {
+		r.log.InfoContext(ctx, "order status change rejected", "order_id", id, "from", order.Status, "to", status)
+		if order.Status == models.StatusCompleted {
+			return nil, ErrOrderClosed
+		}
+		return nil, fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, order.Status, status)
 	}
 
-	// for _, item := range order.Items {
-	// 	err := r.menuService.PrepareMenu(item.ProductID, item.Quantity)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// }
+	order.SetStatus(status, time.Now())
+	if err := r.orderRepo.Update(ctx, order); err != nil {
+		return nil, err
+	}
 
-	err = r.orderRepo.Close(id)
+	return order, nil
+}
+
+// orderIngredients returns the ingredients taken for the order. Orders saved
+// before ingredients were recorded fall back to today's recipes.
+func (r orderService) orderIngredients(ctx context.Context, order *models.Order) ([]models.MenuItemIngredient, error) {
+	if order.Ingredients != nil {
+		return order.Ingredients, nil
+	}
+
+	ingredients, err := r.menuService.GetOrderIngredients(ctx, order.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine ingredients of order %s: %w", order.ID, err)
+	}
+	return ingredients, nil
+}
+
+// restockOrder returns the ingredients taken for the order to the inventory
+func (r orderService) restockOrder(ctx context.Context, order *models.Order) error {
+	ingredients, err := r.orderIngredients(ctx, order)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return r.inventoryService.RestockIngredients(ctx, ingredients, 1, order.ID)
 }
 
-func (r orderService) GetOrder(id string) (*models.Order, error) {
-	r.log.Info("GetOrder called")
+func (r orderService) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	r.log.InfoContext(ctx, "GetOrder called")
 
-	order, err := r.orderRepo.GetByID(id)
+	order, err := r.orderRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -124,10 +228,10 @@ func (r orderService) GetOrder(id string) (*models.Order, error) {
 	return order, nil
 }
 
-func (r orderService) GetAllOrders() (*[]models.Order, error) {
-	r.log.Info("GetAllOrders called")
+func (r orderService) GetAllOrders(ctx context.Context) (*[]models.Order, error) {
+	r.log.InfoContext(ctx, "GetAllOrders called")
 
-	orders, err := r.orderRepo.GetAll()
+	orders, err := r.orderRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -135,94 +239,517 @@ func (r orderService) GetAllOrders() (*[]models.Order, error) {
 	return orders, nil
 }
 
-func (r orderService) UpdateOrder(id string, order *models.Order) error {
-	r.log.Info("UpdateOrder called")
+// ListOrders returns a page of the orders that pass the filter and the
+// number of orders that pass it
+func (r orderService) ListOrders(ctx context.Context, filter models.OrderFilter, opts models.ListOptions) (*[]models.Order, int, error) {
+	r.log.InfoContext(ctx, "ListOrders called")
 
-	existing, err := r.GetOrder(id)
-	if err != nil {
-		return err
+	return r.orderRepo.List(ctx, filter, opts)
+}
+
+// UpdateOrder replaces the customer and items of an open order. Only the
+// difference in ingredients is taken from or returned to the inventory; the
+// ID, creation time and status of the order are kept. On success order holds
+// the saved order.
+func (r orderService) UpdateOrder(ctx context.Context, id string, order *models.Order) error {
+	r.log.InfoContext(ctx, "UpdateOrder called")
+
+	return r.atomically(ctx, func(r orderService) error {
+		existing, err := r.orderRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if existing == nil {
+			return ErrOrderNotFound
+		}
+
+		switch existing.Status {
+		case models.StatusCompleted:
+			return ErrOrderClosed
+		case models.StatusCancelled:
+			return ErrOrderCancelled
+		}
+
+		before, err := r.orderIngredients(ctx, existing)
+		if err != nil {
+			return err
+		}
+
+		after, err := r.menuService.GetOrderIngredients(ctx, order.Items)
+		if err != nil {
+			return err
+		}
+
+		if err := r.priceOrder(ctx, order, existing.Items); err != nil {
+			return err
+		}
+
+		more, less := diffIngredients(before, after)
+		if len(more) > 0 {
+			if err := r.inventoryService.DeductIngredients(ctx, more, 1, existing.ID); err != nil {
+				return err
+			}
+		}
+		if len(less) > 0 {
+			if err := r.inventoryService.RestockIngredients(ctx, less, 1, existing.ID); err != nil {
+				return err
+			}
+		}
+
+		existing.CustomerName = order.CustomerName
+		existing.Items = order.Items
+		existing.Ingredients = after
+		existing.Discount = order.Discount
+		existing.Subtotal = order.Subtotal
+		existing.Tax = order.Tax
+		existing.Total = order.Total
+
+		if err := r.orderRepo.Update(ctx, existing); err != nil {
+			return err
+		}
+
+		*order = *existing
+		return nil
+	})
+}
+
+// priceOrder copies the current menu name and price onto every order line
+// and computes the order totals. Lines for products already priced in
+// previous keep their earlier price.
+func (r orderService) priceOrder(ctx context.Context, order *models.Order, previous []models.OrderItem) error {
+	priced := make(map[string]models.OrderItem, len(previous))
+	for _, item := range previous {
+		if item.IsPriced() {
+			priced[item.ProductID] = item
+		}
 	}
 
-	if existing == nil {
-		return ErrOrderNotFound
+	items := make([]models.OrderItem, len(order.Items))
+	for i, item := range order.Items {
+		if snapshot, ok := priced[item.ProductID]; ok {
+			item.ProductName = snapshot.ProductName
+			item.UnitPrice = snapshot.UnitPrice
+			items[i] = item
+			continue
+		}
+
+		menuItem, err := r.menuService.GetMenuItem(ctx, item.ProductID)
+		if err != nil {
+			return err
+		}
+		if menuItem == nil {
+			return fmt.Errorf("%w: %s", ErrMenuItemNotFound, item.ProductID)
+		}
+
+		item.ProductName = menuItem.Name
+		item.UnitPrice = menuItem.Price
+		items[i] = item
 	}
+	order.Items = items
 
-	err = r.orderRepo.Update(order)
-	if err != nil {
-		return err
+	return order.CalculateTotals(r.taxRate)
+}
+
+// diffIngredients compares two ingredient lists and returns what has to be
+// taken from the inventory and what has to be returned to go from before to
+// after. Quantities in different units are kept apart; the inventory
+// converts them when they are applied.
+func diffIngredients(before, after []models.MenuItemIngredient) (more, less []models.MenuItemIngredient) {
+	change := make(map[models.MenuItemIngredient]float64) // keyed by ID and unit
+	var keys []models.MenuItemIngredient
+	add := func(ingredients []models.MenuItemIngredient, sign float64) {
+		for _, ingredient := range ingredients {
+			key := models.MenuItemIngredient{IngredientID: ingredient.IngredientID, Unit: ingredient.Unit}
+			if _, ok := change[key]; !ok {
+				keys = append(keys, key)
+			}
+			change[key] += sign * ingredient.Quantity
+		}
 	}
+	add(before, -1)
+	add(after, 1)
+
+	for _, key := range keys {
+		switch quantity := change[key]; {
+		case quantity > 0:
+			key.Quantity = quantity
+			more = append(more, key)
+		case quantity < 0:
+			key.Quantity = -quantity
+			less = append(less, key)
+		}
+	}
+	return more, less
+}
+
+// DeleteOrder removes an order that has not been closed, returning its
+// ingredients to the inventory
+func (r orderService) DeleteOrder(ctx context.Context, id string) error {
+	r.log.InfoContext(ctx, "DeleteOrder called")
+
+	return r.atomically(ctx, func(r orderService) error {
+		order, err := r.orderRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if order == nil {
+			return ErrOrderNotFound
+		}
+
+		// Closed orders were served and count towards sales; they stay.
+		if order.Status == models.StatusCompleted {
+			return ErrOrderClosed
+		}
+
+		// Cancelled orders have already returned their ingredients
+		if order.Status != models.StatusCancelled {
+			if err := r.restockOrder(ctx, order); err != nil {
+				return err
+			}
+		}
 
-	return nil
+		return r.orderRepo.Delete(ctx, id)
+	})
+}
+
+// NewOrderID returns an ID for an order of the named customer. The random
+// suffix keeps apart orders the same customer places within one second.
+func (r orderService) NewOrderID(name string) string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("order-%s-%d", name, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("order-%s-%d-%s", name, time.Now().Unix(), hex.EncodeToString(b))
 }
 
-func (r orderService) DeleteOrder(id string) error {
-	r.log.Info("DeleteOrder called")
+// GetTotalSales sums the revenue and items of the orders the filter selects.
+// Only closed orders are counted unless the filter asks for other statuses.
+func (r orderService) GetTotalSales(ctx context.Context, filter models.ReportFilter) (*models.Sales, error) {
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []string{models.StatusCompleted}
+	}
 
-	err := r.orderRepo.Delete(id)
+	orders, err := r.orderRepo.GetAll(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
+	sales := models.Sales{
+		Statuses:     filter.Statuses,
+		TotalRevenue: models.Money{Currency: models.DefaultCurrency},
+		TimeReceived: time.Now().Format(time.RFC3339),
+	}
+	sales.From, sales.To = filter.Window()
 
-func (r orderService) NewOrderID(name string) string {
-	return fmt.Sprintf("order-%s-%d", name, time.Now().Unix())
+	for _, order := range *orders {
+		if !filter.Includes(&order) {
+			continue
+		}
+
+		revenue, err := r.orderRevenue(ctx, &order)
+		if err != nil {
+			return nil, err
+		}
+		if !sales.TotalRevenue.SameCurrency(revenue) {
+			r.log.WarnContext(ctx, "order in another currency left out of sales", "order_id", order.ID, "currency", revenue.Currency)
+			continue
+		}
+		sales.TotalRevenue = sales.TotalRevenue.Add(revenue)
+		sales.OrderCount++
+
+		for _, item := range order.Items {
+			sales.TotalItemsSold += item.Quantity
+		}
+	}
+
+	return &sales, nil
 }
 
-func (r orderService) GetTotalSales() (*models.Sales, error) {
-	orders, err := r.orderRepo.GetAll()
+// GetSales breaks down the sales of the orders the filter selects by hour,
+// day, week, product or customer. As with GetTotalSales only closed orders
+// are counted by default. Orders count with what the customer was charged;
+// products, which share the discount and tax of their order, count at the
+// price of their lines.
+func (r orderService) GetSales(ctx context.Context, filter models.ReportFilter, groupBy string) (*models.SalesReport, error) {
+	if !models.IsValidSalesGrouping(groupBy) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGrouping, groupBy)
+	}
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []string{models.StatusCompleted}
+	}
+
+	orders, err := r.orderRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	var totalRevenue float64
-	var totalItemsSold int
+	report := models.SalesReport{
+		Statuses:     filter.Statuses,
+		GroupBy:      groupBy,
+		TotalRevenue: models.Money{Currency: models.DefaultCurrency},
+		Groups:       []models.SalesGroup{},
+	}
+	report.From, report.To = filter.Window()
+
+	groups := make(map[string]*models.SalesGroup)
+	group := func(key string) *models.SalesGroup {
+		g, ok := groups[key]
+		if !ok {
+			g = &models.SalesGroup{Key: key, Revenue: models.Money{Currency: report.TotalRevenue.Currency}}
+			groups[key] = g
+		}
+		return g
+	}
 
 	for _, order := range *orders {
+		if !filter.Includes(&order) {
+			continue
+		}
+
+		if groupBy == models.GroupByProduct {
+			seen := make(map[string]bool, len(order.Items))
+			for _, item := range order.Items {
+				line, err := r.lineSnapshot(ctx, item)
+				if err != nil {
+					return nil, err
+				}
+				if !report.TotalRevenue.SameCurrency(line.UnitPrice) {
+					r.log.WarnContext(ctx, "order line in another currency left out of sales", "order_id", order.ID, "currency", line.UnitPrice.Currency)
+					continue
+				}
+
+				revenue := line.UnitPrice.Mul(item.Quantity)
+				g := group(item.ProductID)
+				if line.ProductName != "" {
+					g.Name = line.ProductName
+				}
+				if !seen[item.ProductID] {
+					g.OrderCount++
+					seen[item.ProductID] = true
+				}
+				g.Revenue = g.Revenue.Add(revenue)
+				g.ItemsSold += item.Quantity
+				report.TotalRevenue = report.TotalRevenue.Add(revenue)
+				report.TotalItemsSold += item.Quantity
+			}
+			if len(seen) > 0 {
+				report.OrderCount++
+			}
+			continue
+		}
+
+		key, ok := salesKey(&order, groupBy)
+		if !ok {
+			r.log.WarnContext(ctx, "order without a readable creation time left out of sales", "order_id", order.ID)
+			continue
+		}
+
+		revenue, err := r.orderRevenue(ctx, &order)
+		if err != nil {
+			return nil, err
+		}
+		if !report.TotalRevenue.SameCurrency(revenue) {
+			r.log.WarnContext(ctx, "order in another currency left out of sales", "order_id", order.ID, "currency", revenue.Currency)
+			continue
+		}
+
+		var items int
 		for _, item := range order.Items {
-			// Assuming we have a method to get the price of a product by its ID
-			price, err := r.menuService.GetPriceByID(item.ProductID)
-			if err != nil {
-				// Handle error appropriately
+			items += item.Quantity
+		}
+
+		g := group(key)
+		g.OrderCount++
+		g.Revenue = g.Revenue.Add(revenue)
+		g.ItemsSold += items
+		report.OrderCount++
+		report.TotalRevenue = report.TotalRevenue.Add(revenue)
+		report.TotalItemsSold += items
+	}
+
+	for _, g := range groups {
+		report.Groups = append(report.Groups, *g)
+	}
+
+	switch groupBy {
+	case models.GroupByProduct, models.GroupByCustomer:
+		sort.Slice(report.Groups, func(i, j int) bool {
+			a, b := report.Groups[i], report.Groups[j]
+			if a.Revenue.Amount != b.Revenue.Amount {
+				return a.Revenue.Amount > b.Revenue.Amount
+			}
+			return a.Key < b.Key
+		})
+	default:
+		// The key formats of time groups sort chronologically
+		sort.Slice(report.Groups, func(i, j int) bool {
+			return report.Groups[i].Key < report.Groups[j].Key
+		})
+	}
+
+	if filter.Limit > 0 && len(report.Groups) > filter.Limit {
+		report.Groups = report.Groups[:filter.Limit]
+	}
+
+	return &report, nil
+}
+
+// salesKey returns the group of a sales report the order belongs to, with
+// times in the local time zone of the server
+func salesKey(order *models.Order, groupBy string) (string, bool) {
+	if groupBy == models.GroupByCustomer {
+		return order.CustomerName, true
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, order.CreatedAt)
+	if err != nil {
+		return "", false
+	}
+	createdAt = createdAt.In(time.Local)
+
+	switch groupBy {
+	case models.GroupByHour:
+		return createdAt.Format("2006-01-02T15:00"), true
+	case models.GroupByWeek:
+		year, week := createdAt.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), true
+	default:
+		return createdAt.Format("2006-01-02"), true
+	}
+}
+
+// orderRevenue returns what the customer was charged for the order. Orders
+// created before prices were recorded on them are valued at today's menu
+// prices; lines whose product is no longer on the menu are left out.
+func (r orderService) orderRevenue(ctx context.Context, order *models.Order) (models.Money, error) {
+	priced := len(order.Items) > 0
+	for _, item := range order.Items {
+		priced = priced && item.IsPriced()
+	}
+	if priced {
+		return order.Total, nil
+	}
+
+	var revenue models.Money
+	for _, item := range order.Items {
+		price, err := r.menuService.GetPriceByID(ctx, item.ProductID)
+		if err != nil {
+			if errors.Is(err, ErrMenuItemNotFound) {
 				continue
 			}
-			totalRevenue += price * float64(item.Quantity)
-			totalItemsSold += item.Quantity
+			return models.Money{}, err
 		}
+		revenue = revenue.Add(price.Mul(item.Quantity))
 	}
-
-	return &models.Sales{
-		TotalRevenue:   totalRevenue,
-		TotalItemsSold: totalItemsSold,
-		TimeReceived:   time.Now().Format(time.RFC3339),
-	}, nil
+	return revenue, nil
 }
 
-func (r orderService) PopularItems() (*models.PopularItems, error) {
-	orders, err := r.orderRepo.GetAll()
+// PopularItems ranks the products sold in the orders the filter selects by
+// quantity, then revenue. Cancelled orders are left out unless the filter
+// asks for them. Lines are valued at the price recorded on the order, so
+// products since removed from the menu are still reported.
+func (r orderService) PopularItems(ctx context.Context, filter models.ReportFilter) (*models.PopularItems, error) {
+	if len(filter.Statuses) == 0 {
+		filter.Statuses = []string{models.StatusPending, models.StatusInProgress, models.StatusReady, models.StatusCompleted}
+	}
+
+	orders, err := r.orderRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	itemCount := make(map[string]int)
+	report := models.PopularItems{
+		Statuses:     filter.Statuses,
+		TotalRevenue: models.Money{Currency: models.DefaultCurrency},
+		List:         []models.PopularItem{},
+	}
+	report.From, report.To = filter.Window()
 
+	byProduct := make(map[string]*models.PopularItem)
 	for _, order := range *orders {
+		if !filter.Includes(&order) {
+			continue
+		}
+
 		for _, item := range order.Items {
-			itemCount[item.ProductID] += item.Quantity
+			line, err := r.lineSnapshot(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			if !report.TotalRevenue.SameCurrency(line.UnitPrice) {
+				r.log.WarnContext(ctx, "order line in another currency left out of report", "order_id", order.ID, "currency", line.UnitPrice.Currency)
+				continue
+			}
+
+			popular, ok := byProduct[item.ProductID]
+			if !ok {
+				popular = &models.PopularItem{
+					ProductID: item.ProductID,
+					Revenue:   models.Money{Currency: report.TotalRevenue.Currency},
+				}
+				byProduct[item.ProductID] = popular
+			}
+			if line.ProductName != "" {
+				popular.ProductName = line.ProductName
+			}
+
+			revenue := line.UnitPrice.Mul(item.Quantity)
+			popular.QuantitySold += item.Quantity
+			popular.Revenue = popular.Revenue.Add(revenue)
+			report.TotalQuantity += item.Quantity
+			report.TotalRevenue = report.TotalRevenue.Add(revenue)
 		}
 	}
 
-	var popularItems []models.MenuItem
-	for productID := range itemCount {
-		menuItem, err := r.menuService.GetMenuItem(productID)
-		if err != nil {
-			return nil, err
+	for _, popular := range byProduct {
+		if report.TotalRevenue.Amount > 0 {
+			popular.Share = math.Round(float64(popular.Revenue.Amount)*10000/float64(report.TotalRevenue.Amount)) / 100
+		}
+		report.List = append(report.List, *popular)
+	}
+
+	sort.Slice(report.List, func(i, j int) bool {
+		a, b := report.List[i], report.List[j]
+		if a.QuantitySold != b.QuantitySold {
+			return a.QuantitySold > b.QuantitySold
 		}
-		popularItems = append(popularItems, *menuItem)
+		if a.Revenue.Amount != b.Revenue.Amount {
+			return a.Revenue.Amount > b.Revenue.Amount
+		}
+		return a.ProductID < b.ProductID
+	})
+
+	if filter.Limit > 0 && len(report.List) > filter.Limit {
+		report.List = report.List[:filter.Limit]
+	}
+	for i := range report.List {
+		report.List[i].Rank = i + 1
+	}
+
+	return &report, nil
+}
+
+// lineSnapshot returns the order line with the product name and price it
+// was sold at. Lines of orders placed before prices were recorded take them
+// from the menu; if the product has since been removed, its price is zero.
+func (r orderService) lineSnapshot(ctx context.Context, item models.OrderItem) (models.OrderItem, error) {
+	if item.IsPriced() {
+		return item, nil
+	}
+
+	menuItem, err := r.menuService.GetMenuItem(ctx, item.ProductID)
+	if err != nil {
+		return item, err
+	}
+	if menuItem == nil {
+		r.log.WarnContext(ctx, "product of unpriced order line no longer on the menu", "product_id", item.ProductID)
+		item.UnitPrice = models.Money{}
+		return item, nil
 	}
 
-	return &models.PopularItems{
-		List: popularItems,
-	}, nil
+	item.ProductName = menuItem.Name
+	item.UnitPrice = menuItem.Price
+	return item, nil
 }
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// newOrderFixture stocks 1000 g of beans, puts an espresso taking 18 g on the
+// menu and places an order for two
+func newOrderFixture(t *testing.T) (testServices, string) {
+	t.Helper()
+
+	s := newTestServices(t)
+	s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+	s.addMenu(t, models.MenuItem{
+		ID: "espresso", Name: "Espresso", Price: models.NewMoney(200, "USD"),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}},
+	})
+
+	order, err := s.order.CreateOrder(context.Background(), &models.Order{
+		CustomerName: "Ann",
+		Items:        []models.OrderItem{{ProductID: "espresso", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+	return s, order.ID
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	type step struct {
+		action  string
+		wantErr error
+	}
+	tests := []struct {
+		name       string
+		steps      []step
+		wantStatus string
+		wantStock  float64
+	}{
+		{
+			name:       "served",
+			steps:      []step{{action: "start"}, {action: "ready"}, {action: "close"}},
+			wantStatus: models.StatusCompleted, wantStock: 964,
+		},
+		{
+			name:       "closed at the counter",
+			steps:      []step{{action: "close"}},
+			wantStatus: models.StatusCompleted, wantStock: 964,
+		},
+		{
+			name:       "cancelled while pending",
+			steps:      []step{{action: "cancel"}},
+			wantStatus: models.StatusCancelled, wantStock: 1000,
+		},
+		{
+			name:       "cancelled in progress",
+			steps:      []step{{action: "start"}, {action: "cancel"}},
+			wantStatus: models.StatusCancelled, wantStock: 1000,
+		},
+		{
+			name:       "ready before it is started",
+			steps:      []step{{action: "ready", wantErr: ErrInvalidTransition}},
+			wantStatus: models.StatusPending, wantStock: 964,
+		},
+		{
+			name:       "cancelled once ready",
+			steps:      []step{{action: "start"}, {action: "ready"}, {action: "cancel", wantErr: ErrInvalidTransition}},
+			wantStatus: models.StatusReady, wantStock: 964,
+		},
+		{
+			name:       "cancelled twice restocks once",
+			steps:      []step{{action: "cancel"}, {action: "cancel", wantErr: ErrInvalidTransition}},
+			wantStatus: models.StatusCancelled, wantStock: 1000,
+		},
+		{
+			name:       "closed order is final",
+			steps:      []step{{action: "close"}, {action: "start", wantErr: ErrOrderClosed}, {action: "cancel", wantErr: ErrOrderClosed}},
+			wantStatus: models.StatusCompleted, wantStock: 964,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, id := newOrderFixture(t)
+
+			actions := map[string]func(context.Context, string) error{
+				"start":  s.order.StartOrder,
+				"ready":  s.order.MarkOrderReady,
+				"close":  s.order.CloseOrder,
+				"cancel": s.order.CancelOrder,
+			}
+			for _, step := range tt.steps {
+				if err := actions[step.action](ctx, id); !errors.Is(err, step.wantErr) {
+					t.Fatalf("%s error = %v, want %v", step.action, err, step.wantErr)
+				}
+			}
+
+			order, err := s.order.GetOrder(ctx, id)
+			if err != nil {
+				t.Fatalf("GetOrder() error = %v", err)
+			}
+			if order.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", order.Status, tt.wantStatus)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantStock {
+				t.Errorf("stock = %v, want %v", got, tt.wantStock)
+			}
+
+			// Every accepted change is in the history, in order
+			var history []string
+			for _, change := range order.StatusHistory {
+				history = append(history, change.Status)
+			}
+			if len(history) == 0 || history[len(history)-1] != tt.wantStatus {
+				t.Errorf("status history = %v, want it to end in %q", history, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOrderUnknown(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newOrderFixture(t)
+
+	for name, action := range map[string]func(context.Context, string) error{
+		"start":  s.order.StartOrder,
+		"cancel": s.order.CancelOrder,
+		"delete": s.order.DeleteOrder,
+	} {
+		if err := action(ctx, "missing"); !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("%s error = %v, want ErrOrderNotFound", name, err)
+		}
+	}
+}
+
+func TestDiffIngredients(t *testing.T) {
+	type in = models.MenuItemIngredient
+	tests := []struct {
+		name     string
+		before   []in
+		after    []in
+		wantMore []in
+		wantLess []in
+	}{
+		{name: "unchanged", before: []in{{IngredientID: "beans", Quantity: 18}}, after: []in{{IngredientID: "beans", Quantity: 18}}},
+		{name: "more", before: []in{{IngredientID: "beans", Quantity: 18}}, after: []in{{IngredientID: "beans", Quantity: 36}}, wantMore: []in{{IngredientID: "beans", Quantity: 18}}},
+		{name: "less", before: []in{{IngredientID: "beans", Quantity: 36}}, after: []in{{IngredientID: "beans", Quantity: 18}}, wantLess: []in{{IngredientID: "beans", Quantity: 18}}},
+		{name: "added", after: []in{{IngredientID: "milk", Quantity: 200}}, wantMore: []in{{IngredientID: "milk", Quantity: 200}}},
+		{name: "removed", before: []in{{IngredientID: "milk", Quantity: 200}}, wantLess: []in{{IngredientID: "milk", Quantity: 200}}},
+		{
+			name:     "repeated ingredient is summed",
+			before:   []in{{IngredientID: "beans", Quantity: 18}, {IngredientID: "beans", Quantity: 18}},
+			after:    []in{{IngredientID: "beans", Quantity: 18}},
+			wantLess: []in{{IngredientID: "beans", Quantity: 18}},
+		},
+		{
+			name:     "units are kept apart",
+			before:   []in{{IngredientID: "milk", Quantity: 200, Unit: "ml"}},
+			after:    []in{{IngredientID: "milk", Quantity: 0.2, Unit: "l"}},
+			wantMore: []in{{IngredientID: "milk", Quantity: 0.2, Unit: "l"}},
+			wantLess: []in{{IngredientID: "milk", Quantity: 200, Unit: "ml"}},
+		},
+		{
+			name:     "mixed",
+			before:   []in{{IngredientID: "beans", Quantity: 18}, {IngredientID: "milk", Quantity: 200}},
+			after:    []in{{IngredientID: "milk", Quantity: 400}, {IngredientID: "sugar", Quantity: 5}},
+			wantMore: []in{{IngredientID: "milk", Quantity: 200}, {IngredientID: "sugar", Quantity: 5}},
+			wantLess: []in{{IngredientID: "beans", Quantity: 18}},
+		},
+	}
+
+	equal := func(a, b []in) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			more, less := diffIngredients(tt.before, tt.after)
+			if !equal(more, tt.wantMore) {
+				t.Errorf("more = %+v, want %+v", more, tt.wantMore)
+			}
+			if !equal(less, tt.wantLess) {
+				t.Errorf("less = %+v, want %+v", less, tt.wantLess)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStock(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantity  int
+		wantErr   error
+		wantStock float64
+	}{
+		{name: "more taken", quantity: 5, wantStock: 910},
+		{name: "some returned", quantity: 1, wantStock: 982},
+		{name: "same", quantity: 2, wantStock: 964},
+		{name: "more than in stock", quantity: 60, wantErr: ErrInsufficientQuantity, wantStock: 964},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, id := newOrderFixture(t)
+
+			err := s.order.UpdateOrder(ctx, id, &models.Order{
+				CustomerName: "Ann",
+				Items:        []models.OrderItem{{ProductID: "espresso", Quantity: tt.quantity}},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantStock {
+				t.Errorf("stock = %v, want %v", got, tt.wantStock)
+			}
+
+			// Cancelling returns what the order holds now, nothing more
+			if err := s.order.CancelOrder(ctx, id); err != nil {
+				t.Fatalf("CancelOrder() error = %v", err)
+			}
+			if got := s.quantity(t, "beans"); got != 1000 {
+				t.Errorf("stock after cancel = %v, want 1000", got)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderFinal(t *testing.T) {
+	tests := []struct {
+		name    string
+		finish  func(s testServices, id string) error
+		wantErr error
+	}{
+		{name: "closed", finish: func(s testServices, id string) error { return s.order.CloseOrder(context.Background(), id) }, wantErr: ErrOrderClosed},
+		{name: "cancelled", finish: func(s testServices, id string) error { return s.order.CancelOrder(context.Background(), id) }, wantErr: ErrOrderCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, id := newOrderFixture(t)
+			if err := tt.finish(s, id); err != nil {
+				t.Fatalf("finishing the order: %v", err)
+			}
+			stock := s.quantity(t, "beans")
+
+			err := s.order.UpdateOrder(context.Background(), id, &models.Order{
+				CustomerName: "Ann",
+				Items:        []models.OrderItem{{ProductID: "espresso", Quantity: 1}},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := s.quantity(t, "beans"); got != stock {
+				t.Errorf("stock = %v, want %v", got, stock)
+			}
+		})
+	}
+}
+
+func TestOrderPriceSnapshot(t *testing.T) {
+	ctx := context.Background()
+	s, id := newOrderFixture(t)
+	s.addMenu(t, models.MenuItem{ID: "tea", Name: "Tea", Price: models.NewMoney(150, "USD")})
+
+	// A price change on the menu does not reach lines already ordered
+	err := s.menu.UpdateMenuItem(ctx, "espresso", &models.MenuItem{
+		ID: "espresso", Name: "Espresso", Price: models.NewMoney(250, "USD"),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMenuItem() error = %v", err)
+	}
+
+	order := &models.Order{
+		CustomerName: "Ann",
+		Items:        []models.OrderItem{{ProductID: "espresso", Quantity: 3}, {ProductID: "tea", Quantity: 1}},
+	}
+	if err := s.order.UpdateOrder(ctx, id, order); err != nil {
+		t.Fatalf("UpdateOrder() error = %v", err)
+	}
+
+	stored, _ := s.order.GetOrder(ctx, id)
+	if got := stored.Items[0].UnitPrice; got != models.NewMoney(200, "USD") {
+		t.Errorf("espresso price = %v, want the price it was ordered at", got)
+	}
+	if got := stored.Items[1].UnitPrice; got != models.NewMoney(150, "USD") {
+		t.Errorf("tea price = %v, want the current menu price", got)
+	}
+	if got := stored.Total; got != models.NewMoney(750, "USD") {
+		t.Errorf("total = %v, want 7.50", got)
+	}
+}
+
+func TestCreateOrderSameCustomer(t *testing.T) {
+	ctx := context.Background()
+	s, first := newOrderFixture(t)
+
+	// Placed straight after the first, within the same second
+	second, err := s.order.CreateOrder(ctx, &models.Order{
+		CustomerName: "Ann",
+		Items:        []models.OrderItem{{ProductID: "espresso", Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+	if second.ID == first {
+		t.Fatalf("both orders got ID %s", first)
+	}
+
+	orders, err := s.order.GetAllOrders(ctx)
+	if err != nil {
+		t.Fatalf("GetAllOrders() error = %v", err)
+	}
+	if len(*orders) != 2 {
+		t.Errorf("stored %d orders, want 2", len(*orders))
+	}
+	if got := s.quantity(t, "beans"); got != 928 {
+		t.Errorf("stock = %v, want 928", got)
+	}
+}
+
+func TestCreateOrderAllOrNothing(t *testing.T) {
+	tests := []struct {
+		name    string
+		items   []models.OrderItem
+		wantErr error
+	}{
+		{
+			name:    "one ingredient short",
+			items:   []models.OrderItem{{ProductID: "espresso", Quantity: 1}, {ProductID: "latte", Quantity: 6}},
+			wantErr: ErrInsufficientQuantity,
+		},
+		{
+			name:    "whole order short",
+			items:   []models.OrderItem{{ProductID: "espresso", Quantity: 30}, {ProductID: "latte", Quantity: 30}},
+			wantErr: ErrInsufficientQuantity,
+		},
+		{
+			name:    "unknown product",
+			items:   []models.OrderItem{{ProductID: "espresso", Quantity: 1}, {ProductID: "mocha", Quantity: 1}},
+			wantErr: ErrMenuItemNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t,
+				models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"},
+				models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 1000, Unit: "ml"},
+			)
+			s.addMenu(t,
+				models.MenuItem{
+					ID: "espresso", Name: "Espresso", Price: models.NewMoney(200, "USD"),
+					Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}},
+				},
+				models.MenuItem{
+					ID: "latte", Name: "Latte", Price: models.NewMoney(350, "USD"),
+					Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}, {IngredientID: "milk", Quantity: 200}},
+				},
+			)
+
+			_, err := s.order.CreateOrder(ctx, &models.Order{CustomerName: "Ann", Items: tt.items})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateOrder() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := s.quantity(t, "beans"); got != 1000 {
+				t.Errorf("beans = %v, want 1000", got)
+			}
+			if got := s.quantity(t, "milk"); got != 1000 {
+				t.Errorf("milk = %v, want 1000", got)
+			}
+			if orders, _ := s.order.GetAllOrders(ctx); len(*orders) != 0 {
+				t.Errorf("stored orders %+v, want none", *orders)
+			}
+		})
+	}
+}
+
+func TestCreateOrderConcurrent(t *testing.T) {
+	const customers = 40
+	ctx := context.Background()
+	s := newTestServices(t)
+	// Enough for 27 espressos
+	s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 500, Unit: "g"})
+	s.addMenu(t, models.MenuItem{
+		ID: "espresso", Name: "Espresso", Price: models.NewMoney(200, "USD"),
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "beans", Quantity: 18}},
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, customers)
+	for i := 0; i < customers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.order.CreateOrder(ctx, &models.Order{
+				CustomerName: "Ann",
+				Items:        []models.OrderItem{{ProductID: "espresso", Quantity: 1}},
+			})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	placed := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrInsufficientQuantity):
+			t.Errorf("CreateOrder() error = %v", err)
+		}
+	}
+	if placed != 27 {
+		t.Errorf("%d orders placed, want 27", placed)
+	}
+
+	orders, _ := s.order.GetAllOrders(ctx)
+	if len(*orders) != placed {
+		t.Errorf("stored %d orders for %d placed", len(*orders), placed)
+	}
+	if got := s.quantity(t, "beans"); got != 500-18*float64(placed) {
+		t.Errorf("stock = %v, want %v", got, 500-18*float64(placed))
+	}
+}
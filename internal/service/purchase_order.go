@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type PurchaseOrderService interface {
+	CreatePurchaseOrder(ctx context.Context, order *models.PurchaseOrder) error
+	GetPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error)
+	GetAllPurchaseOrders(ctx context.Context) (*[]models.PurchaseOrder, error)
+	UpdatePurchaseOrder(ctx context.Context, id string, order *models.PurchaseOrder) error
+	DeletePurchaseOrder(ctx context.Context, id string) error
+
+	SubmitPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error)
+	ReceivePurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error)
+	CancelPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error)
+
+	GenerateDraftPurchaseOrders(ctx context.Context) ([]models.PurchaseOrder, error)
+}
+
+var (
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	ErrPurchaseOrderNotDraft = errors.New("only draft purchase orders can be changed")
+	ErrSupplierRequired      = errors.New("purchase order has no supplier")
+)
+
+const purchaseOrderPrefix = "po-"
+
+// purchaseOrderSequence numbers purchase orders
+const purchaseOrderSequence = "purchase_order"
+
+// purchaseOrderService handles business logic for purchase orders
+type purchaseOrderService struct {
+	purchaseOrderRepo repository.PurchaseOrderRepository
+	sequenceRepo      repository.SequenceRepository
+	supplierService   SupplierService
+	inventoryService  InventoryService
+	transactor        repository.Transactor
+	log               *slog.Logger
+}
+
+// NewPurchaseOrderService initializes PurchaseOrderService with repositories, services, transactor and logging
+func NewPurchaseOrderService(purchaseOrderRepo repository.PurchaseOrderRepository, sequenceRepo repository.SequenceRepository, supplierService SupplierService, inventoryService InventoryService, transactor repository.Transactor, log *slog.Logger) purchaseOrderService {
+	return purchaseOrderService{
+		purchaseOrderRepo: purchaseOrderRepo,
+		sequenceRepo:      sequenceRepo,
+		supplierService:   supplierService,
+		inventoryService:  inventoryService,
+		transactor:        transactor,
+		log:               log,
+	}
+}
+
+// atomically runs fn with a copy of the service bound to a transaction
+func (s purchaseOrderService) atomically(ctx context.Context, fn func(s purchaseOrderService) error) error {
+	return s.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		s.purchaseOrderRepo = s.purchaseOrderRepo.WithTx(tx)
+		s.sequenceRepo = s.sequenceRepo.WithTx(tx)
+		s.supplierService = s.supplierService.WithTx(tx)
+		s.inventoryService = s.inventoryService.WithTx(tx)
+		s.transactor = tx
+		return fn(s)
+	})
+}
+
+// CreatePurchaseOrder saves a new draft purchase order
+func (s purchaseOrderService) CreatePurchaseOrder(ctx context.Context, order *models.PurchaseOrder) error {
+	s.log.InfoContext(ctx, "creating purchase order", "supplier_id", order.SupplierID)
+
+	return s.atomically(ctx, func(s purchaseOrderService) error {
+		if err := s.checkReferences(ctx, order); err != nil {
+			return err
+		}
+
+		id, err := s.nextID(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		order.ID = id
+		order.Status = models.PurchaseOrderDraft
+		order.CreatedAt = now.Format(time.RFC3339)
+		order.OrderedAt = ""
+		order.ReceivedAt = ""
+
+		return s.purchaseOrderRepo.Create(ctx, order)
+	})
+}
+
+func (s purchaseOrderService) GetPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "retrieving purchase order", "id", id)
+
+	order, err := s.purchaseOrderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase order: %w", err)
+	}
+
+	if order == nil {
+		return nil, ErrPurchaseOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (s purchaseOrderService) GetAllPurchaseOrders(ctx context.Context) (*[]models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "retrieving all purchase orders")
+
+	orders, err := s.purchaseOrderRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all purchase orders: %w", err)
+	}
+
+	return orders, nil
+}
+
+// UpdatePurchaseOrder replaces the supplier, items and note of a draft.
+// On success order holds the saved purchase order.
+func (s purchaseOrderService) UpdatePurchaseOrder(ctx context.Context, id string, order *models.PurchaseOrder) error {
+	s.log.InfoContext(ctx, "updating purchase order", "id", id)
+
+	return s.atomically(ctx, func(s purchaseOrderService) error {
+		existing, err := s.GetPurchaseOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if existing.Status != models.PurchaseOrderDraft {
+			return ErrPurchaseOrderNotDraft
+		}
+
+		if err := s.checkReferences(ctx, order); err != nil {
+			return err
+		}
+
+		existing.SupplierID = order.SupplierID
+		existing.Items = order.Items
+		existing.Note = order.Note
+
+		if err := s.purchaseOrderRepo.Update(ctx, existing); err != nil {
+			return err
+		}
+
+		*order = *existing
+		return nil
+	})
+}
+
+// DeletePurchaseOrder removes a draft or cancelled purchase order. Received
+// purchase orders are kept as the record of the stock that came in.
+func (s purchaseOrderService) DeletePurchaseOrder(ctx context.Context, id string) error {
+	s.log.InfoContext(ctx, "deleting purchase order", "id", id)
+
+	return s.atomically(ctx, func(s purchaseOrderService) error {
+		existing, err := s.GetPurchaseOrder(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if existing.Status != models.PurchaseOrderDraft && existing.Status != models.PurchaseOrderCancelled {
+			return fmt.Errorf("%w: purchase order is %s", ErrInvalidTransition, existing.Status)
+		}
+
+		return s.purchaseOrderRepo.Delete(ctx, id)
+	})
+}
+
+// SubmitPurchaseOrder marks a draft as sent to its supplier
+func (s purchaseOrderService) SubmitPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "submitting purchase order", "id", id)
+
+	var order *models.PurchaseOrder
+	err := s.atomically(ctx, func(s purchaseOrderService) error {
+		var err error
+		order, err = s.transition(ctx, id, models.PurchaseOrderOrdered, func(order *models.PurchaseOrder) error {
+			if order.SupplierID == "" {
+				return ErrSupplierRequired
+			}
+			return nil
+		})
+		return err
+	})
+	return order, err
+}
+
+// ReceivePurchaseOrder adds the ordered quantities to the inventory and
+// marks the purchase order received, in one transaction
+func (s purchaseOrderService) ReceivePurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "receiving purchase order", "id", id)
+
+	var order *models.PurchaseOrder
+	err := s.atomically(ctx, func(s purchaseOrderService) error {
+		var err error
+		order, err = s.transition(ctx, id, models.PurchaseOrderReceived, func(order *models.PurchaseOrder) error {
+			return s.inventoryService.ReceiveIngredients(ctx, order.Ingredients(), order.ID)
+		})
+		return err
+	})
+	return order, err
+}
+
+func (s purchaseOrderService) CancelPurchaseOrder(ctx context.Context, id string) (*models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "cancelling purchase order", "id", id)
+
+	var order *models.PurchaseOrder
+	err := s.atomically(ctx, func(s purchaseOrderService) error {
+		var err error
+		order, err = s.transition(ctx, id, models.PurchaseOrderCancelled, nil)
+		return err
+	})
+	return order, err
+}
+
+// transition moves the purchase order to status after running before, if
+// given, and saves it. It must be called inside a transaction.
+func (s purchaseOrderService) transition(ctx context.Context, id, status string, before func(order *models.PurchaseOrder) error) (*models.PurchaseOrder, error) {
+	order, err := s.GetPurchaseOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !order.CanTransition(status) {
+		return nil, fmt.Errorf("%w: from %s to %s", ErrInvalidTransition, order.Status, status)
+	}
+
+	if before != nil {
+		if err := before(order); err != nil {
+			return nil, err
+		}
+	}
+
+	order.SetStatus(status, time.Now())
+	if err := s.purchaseOrderRepo.Update(ctx, order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GenerateDraftPurchaseOrders creates a draft purchase order per supplier for
+// the items at or below their reorder threshold. Items already on an open
+// purchase order are left out. Each item is ordered in its reorder quantity,
+// or, without one, enough to bring it to twice its threshold. Items without
+// a known supplier are collected in a draft without one.
+func (s purchaseOrderService) GenerateDraftPurchaseOrders(ctx context.Context) ([]models.PurchaseOrder, error) {
+	s.log.InfoContext(ctx, "generating draft purchase orders")
+
+	created := []models.PurchaseOrder{}
+	err := s.atomically(ctx, func(s purchaseOrderService) error {
+		low, err := s.inventoryService.GetLowStockItems(ctx)
+		if err != nil {
+			return err
+		}
+
+		orders, err := s.purchaseOrderRepo.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get all purchase orders: %w", err)
+		}
+		onOrder := make(map[string]bool)
+		for _, order := range *orders {
+			if order.IsOpen() {
+				for _, item := range order.Items {
+					onOrder[item.IngredientID] = true
+				}
+			}
+		}
+
+		var suppliers []string
+		drafts := make(map[string]*models.PurchaseOrder)
+		for _, item := range *low {
+			if onOrder[item.IngredientID] {
+				continue
+			}
+
+			supplierID := item.SupplierID
+			if supplierID != "" {
+				if _, err := s.supplierService.GetSupplier(ctx, supplierID); err != nil {
+					if !errors.Is(err, ErrSupplierNotFound) {
+						return err
+					}
+					s.log.WarnContext(ctx, "inventory item refers to unknown supplier", "ingredient_id", item.IngredientID, "supplier_id", supplierID)
+					supplierID = ""
+				}
+			}
+
+			quantity := item.ReorderQuantity
+			if quantity <= 0 {
+				quantity = 2*item.ReorderThreshold - item.Quantity
+			}
+			// Without a reorder quantity or a threshold to top up to there
+			// is nothing sensible to order
+			if quantity <= 0 {
+				s.log.WarnContext(ctx, "low stock item has no reorder quantity, not ordering it", "ingredient_id", item.IngredientID)
+				continue
+			}
+
+			draft, ok := drafts[supplierID]
+			if !ok {
+				draft = &models.PurchaseOrder{SupplierID: supplierID, Note: "generated for low stock"}
+				drafts[supplierID] = draft
+				suppliers = append(suppliers, supplierID)
+			}
+			draft.Items = append(draft.Items, models.PurchaseOrderItem{IngredientID: item.IngredientID, Quantity: quantity})
+		}
+
+		for _, supplierID := range suppliers {
+			draft := drafts[supplierID]
+			if err := s.CreatePurchaseOrder(ctx, draft); err != nil {
+				return err
+			}
+			created = append(created, *draft)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// checkReferences makes sure the supplier and every ingredient of the
+// purchase order exist, and that the ingredients are ordered in units the
+// inventory can convert
+func (s purchaseOrderService) checkReferences(ctx context.Context, order *models.PurchaseOrder) error {
+	if order.SupplierID != "" {
+		if _, err := s.supplierService.GetSupplier(ctx, order.SupplierID); err != nil {
+			return err
+		}
+	}
+
+	return s.inventoryService.CheckRecipe(ctx, order.Ingredients())
+}
+
+// nextID takes the next purchase order number from its sequence, so the
+// number of a deleted purchase order is not used again. Orders numbered
+// before the sequence existed are skipped.
+func (s purchaseOrderService) nextID(ctx context.Context) (string, error) {
+	orders, err := s.purchaseOrderRepo.GetAll(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get all purchase orders: %w", err)
+	}
+
+	last := 0
+	for _, order := range *orders {
+		if n, err := strconv.Atoi(strings.TrimPrefix(order.ID, purchaseOrderPrefix)); err == nil && n > last {
+			last = n
+		}
+	}
+	n, err := s.sequenceRepo.Next(ctx, purchaseOrderSequence, last)
+	if err != nil {
+		return "", fmt.Errorf("failed to number purchase order: %w", err)
+	}
+	return purchaseOrderPrefix + strconv.Itoa(n), nil
+}
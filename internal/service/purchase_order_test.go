@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestPurchaseOrderLifecycle(t *testing.T) {
+	type step struct {
+		action  string
+		wantErr error
+	}
+	tests := []struct {
+		name       string
+		supplierID string
+		steps      []step
+		wantStatus string
+		wantStock  float64
+	}{
+		{
+			name:       "ordered and received",
+			supplierID: "roaster",
+			steps:      []step{{action: "submit"}, {action: "receive"}},
+			wantStatus: models.PurchaseOrderReceived, wantStock: 1500,
+		},
+		{
+			name:       "draft received directly",
+			steps:      []step{{action: "receive"}},
+			wantStatus: models.PurchaseOrderReceived, wantStock: 1500,
+		},
+		{
+			name:       "submitted without supplier",
+			steps:      []step{{action: "submit", wantErr: ErrSupplierRequired}},
+			wantStatus: models.PurchaseOrderDraft, wantStock: 1000,
+		},
+		{
+			name:       "cancelled",
+			supplierID: "roaster",
+			steps:      []step{{action: "submit"}, {action: "cancel"}, {action: "receive", wantErr: ErrInvalidTransition}},
+			wantStatus: models.PurchaseOrderCancelled, wantStock: 1000,
+		},
+		{
+			name:       "received twice",
+			steps:      []step{{action: "receive"}, {action: "receive", wantErr: ErrInvalidTransition}},
+			wantStatus: models.PurchaseOrderReceived, wantStock: 1500,
+		},
+		{
+			name:       "received order is kept",
+			steps:      []step{{action: "receive"}, {action: "delete", wantErr: ErrInvalidTransition}, {action: "cancel", wantErr: ErrInvalidTransition}},
+			wantStatus: models.PurchaseOrderReceived, wantStock: 1500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t)
+			s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+			if err := s.supplier.CreateSupplier(ctx, &models.Supplier{ID: "roaster", Name: "Roaster"}); err != nil {
+				t.Fatalf("CreateSupplier() error = %v", err)
+			}
+
+			order := &models.PurchaseOrder{
+				SupplierID: tt.supplierID,
+				Items:      []models.PurchaseOrderItem{{IngredientID: "beans", Quantity: 0.5, Unit: "kg"}},
+			}
+			if err := s.purchaseOrder.CreatePurchaseOrder(ctx, order); err != nil {
+				t.Fatalf("CreatePurchaseOrder() error = %v", err)
+			}
+
+			actions := map[string]func(ctx context.Context, id string) error{
+				"submit": func(ctx context.Context, id string) error {
+					_, err := s.purchaseOrder.SubmitPurchaseOrder(ctx, id)
+					return err
+				},
+				"receive": func(ctx context.Context, id string) error {
+					_, err := s.purchaseOrder.ReceivePurchaseOrder(ctx, id)
+					return err
+				},
+				"cancel": func(ctx context.Context, id string) error {
+					_, err := s.purchaseOrder.CancelPurchaseOrder(ctx, id)
+					return err
+				},
+				"delete": s.purchaseOrder.DeletePurchaseOrder,
+			}
+			for _, step := range tt.steps {
+				if err := actions[step.action](ctx, order.ID); !errors.Is(err, step.wantErr) {
+					t.Fatalf("%s error = %v, want %v", step.action, err, step.wantErr)
+				}
+			}
+
+			stored, err := s.purchaseOrder.GetPurchaseOrder(ctx, order.ID)
+			if err != nil {
+				t.Fatalf("GetPurchaseOrder() error = %v", err)
+			}
+			if stored.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", stored.Status, tt.wantStatus)
+			}
+			if got := s.quantity(t, "beans"); got != tt.wantStock {
+				t.Errorf("stock = %v, want %v", got, tt.wantStock)
+			}
+		})
+	}
+}
+
+func TestPurchaseOrderNumbers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	s.addInventory(t, models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 1000, Unit: "g"})
+
+	create := func() string {
+		t.Helper()
+		order := &models.PurchaseOrder{Items: []models.PurchaseOrderItem{{IngredientID: "beans", Quantity: 500}}}
+		if err := s.purchaseOrder.CreatePurchaseOrder(ctx, order); err != nil {
+			t.Fatalf("CreatePurchaseOrder() error = %v", err)
+		}
+		return order.ID
+	}
+
+	first, second := create(), create()
+	if err := s.purchaseOrder.DeletePurchaseOrder(ctx, second); err != nil {
+		t.Fatalf("DeletePurchaseOrder() error = %v", err)
+	}
+
+	// The number of a deleted purchase order is not handed out again
+	third := create()
+	if got := []string{first, second, third}; got[0] != "po-1" || got[1] != "po-2" || got[2] != "po-3" {
+		t.Errorf("purchase order IDs = %v, want [po-1 po-2 po-3]", got)
+	}
+}
+
+func TestGenerateDraftPurchaseOrders(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServices(t)
+	if err := s.supplier.CreateSupplier(ctx, &models.Supplier{ID: "roaster", Name: "Roaster"}); err != nil {
+		t.Fatalf("CreateSupplier() error = %v", err)
+	}
+	s.addInventory(t,
+		// Low, ordered in its reorder quantity from its supplier
+		models.InventoryItem{IngredientID: "beans", Name: "Beans", Quantity: 100, Unit: "g", ReorderThreshold: 200, ReorderQuantity: 1000, SupplierID: "roaster"},
+		// Low, topped up to twice its threshold, no supplier
+		models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 300, Unit: "ml", ReorderThreshold: 500},
+		// Low, but already on an open purchase order
+		models.InventoryItem{IngredientID: "sugar", Name: "Sugar", Quantity: 10, Unit: "g", ReorderThreshold: 50},
+		// Stocked well enough
+		models.InventoryItem{IngredientID: "cocoa", Name: "Cocoa", Quantity: 900, Unit: "g", ReorderThreshold: 100},
+	)
+	if err := s.purchaseOrder.CreatePurchaseOrder(ctx, &models.PurchaseOrder{Items: []models.PurchaseOrderItem{{IngredientID: "sugar", Quantity: 100}}}); err != nil {
+		t.Fatalf("CreatePurchaseOrder() error = %v", err)
+	}
+
+	drafts, err := s.purchaseOrder.GenerateDraftPurchaseOrders(ctx)
+	if err != nil {
+		t.Fatalf("GenerateDraftPurchaseOrders() error = %v", err)
+	}
+
+	got := make(map[string]models.PurchaseOrderItem)
+	for _, draft := range drafts {
+		if draft.Status != models.PurchaseOrderDraft {
+			t.Errorf("%s status = %q, want draft", draft.ID, draft.Status)
+		}
+		for _, item := range draft.Items {
+			got[draft.SupplierID+"/"+item.IngredientID] = item
+		}
+	}
+	want := map[string]float64{"roaster/beans": 1000, "/milk": 700}
+	if len(got) != len(want) {
+		t.Errorf("drafted %v, want %v", got, want)
+	}
+	for key, quantity := range want {
+		if got[key].Quantity != quantity {
+			t.Errorf("%s quantity = %v, want %v", key, got[key].Quantity, quantity)
+		}
+	}
+
+	// Everything low is now on order, so a second run drafts nothing
+	again, err := s.purchaseOrder.GenerateDraftPurchaseOrders(ctx)
+	if err != nil {
+		t.Fatalf("GenerateDraftPurchaseOrders() error = %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("second run drafted %+v", again)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// newReportFixture stores orders placed over a week in March 2024, as they
+// would be after being served or cancelled
+func newReportFixture(t *testing.T) testServices {
+	t.Helper()
+
+	usd := func(amount int64) models.Money { return models.NewMoney(amount, "USD") }
+	espresso := func(quantity int) models.OrderItem {
+		return models.OrderItem{ProductID: "espresso", ProductName: "Espresso", Quantity: quantity, UnitPrice: usd(200)}
+	}
+	latte := func(quantity int) models.OrderItem {
+		return models.OrderItem{ProductID: "latte", ProductName: "Latte", Quantity: quantity, UnitPrice: usd(350)}
+	}
+	tea := models.OrderItem{ProductID: "tea", ProductName: "Tea", Quantity: 1, UnitPrice: usd(150)}
+
+	orders := []models.Order{
+		{ID: "o1", CustomerName: "Ann", Status: models.StatusCompleted, CreatedAt: "2024-03-01T09:15:00Z", Items: []models.OrderItem{espresso(2)}, Total: usd(400)},
+		{ID: "o2", CustomerName: "Bob", Status: models.StatusCompleted, CreatedAt: "2024-03-01T14:40:00Z", Items: []models.OrderItem{latte(1), espresso(1)}, Total: usd(550)},
+		{ID: "o3", CustomerName: "Ann", Status: models.StatusCompleted, CreatedAt: "2024-03-05T12:00:00Z", Items: []models.OrderItem{latte(2)}, Discount: usd(100), Total: usd(600)},
+		{ID: "o4", CustomerName: "Cid", Status: models.StatusCancelled, CreatedAt: "2024-03-02T12:00:00Z", Items: []models.OrderItem{espresso(5)}, Total: usd(1000)},
+		{ID: "o5", CustomerName: "Dan", Status: models.StatusPending, CreatedAt: "2024-03-06T12:00:00Z", Items: []models.OrderItem{tea}, Total: usd(150)},
+	}
+
+	s := newTestServices(t)
+	for i := range orders {
+		if err := s.order.orderRepo.Create(context.Background(), &orders[i]); err != nil {
+			t.Fatalf("Create(%s) error = %v", orders[i].ID, err)
+		}
+	}
+	return s
+}
+
+func TestPopularItems(t *testing.T) {
+	type row struct {
+		id       string
+		quantity int
+		revenue  int64
+		share    float64
+	}
+	tests := []struct {
+		name         string
+		filter       models.ReportFilter
+		want         []row
+		wantQuantity int
+		wantRevenue  int64
+	}{
+		{
+			name: "cancelled orders left out",
+			want: []row{
+				{id: "latte", quantity: 3, revenue: 1050, share: 58.33},
+				{id: "espresso", quantity: 3, revenue: 600, share: 33.33},
+				{id: "tea", quantity: 1, revenue: 150, share: 8.33},
+			},
+			wantQuantity: 7, wantRevenue: 1800,
+		},
+		{
+			name:   "limited",
+			filter: models.ReportFilter{Limit: 1},
+			want:   []row{{id: "latte", quantity: 3, revenue: 1050, share: 58.33}},
+			// Totals cover every product, not just the rows shown
+			wantQuantity: 7, wantRevenue: 1800,
+		},
+		{
+			name:         "cancelled only",
+			filter:       models.ReportFilter{Statuses: []string{models.StatusCancelled}},
+			want:         []row{{id: "espresso", quantity: 5, revenue: 1000, share: 100}},
+			wantQuantity: 5, wantRevenue: 1000,
+		},
+		{
+			name:         "nothing sold",
+			filter:       models.ReportFilter{Statuses: []string{models.StatusReady}},
+			want:         []row{},
+			wantQuantity: 0, wantRevenue: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReportFixture(t)
+			report, err := s.order.PopularItems(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("PopularItems() error = %v", err)
+			}
+
+			if report.TotalQuantity != tt.wantQuantity || report.TotalRevenue.Amount != tt.wantRevenue {
+				t.Errorf("totals = %d, %v, want %d, %d", report.TotalQuantity, report.TotalRevenue, tt.wantQuantity, tt.wantRevenue)
+			}
+			if len(report.List) != len(tt.want) {
+				t.Fatalf("list = %+v, want %d rows", report.List, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := report.List[i]
+				if got.Rank != i+1 || got.ProductID != want.id || got.QuantitySold != want.quantity ||
+					got.Revenue.Amount != want.revenue || got.Share != want.share {
+					t.Errorf("row %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTotalSales(t *testing.T) {
+	march := func(day int) time.Time { return time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name        string
+		filter      models.ReportFilter
+		wantOrders  int
+		wantRevenue int64
+		wantItems   int
+	}{
+		{name: "closed orders by default", wantOrders: 3, wantRevenue: 1550, wantItems: 6},
+		{name: "cancelled", filter: models.ReportFilter{Statuses: []string{models.StatusCancelled}}, wantOrders: 1, wantRevenue: 1000, wantItems: 5},
+		{name: "one day", filter: models.ReportFilter{From: march(1), To: march(2)}, wantOrders: 2, wantRevenue: 950, wantItems: 4},
+		{name: "end of the window is left out", filter: models.ReportFilter{To: march(5).Add(12 * time.Hour)}, wantOrders: 2, wantRevenue: 950, wantItems: 4},
+		{
+			name:       "open window over every status",
+			filter:     models.ReportFilter{From: march(5), Statuses: []string{models.StatusCompleted, models.StatusPending}},
+			wantOrders: 2, wantRevenue: 750, wantItems: 3,
+		},
+		{name: "nothing", filter: models.ReportFilter{From: march(10)}, wantOrders: 0, wantRevenue: 0, wantItems: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReportFixture(t)
+			sales, err := s.order.GetTotalSales(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetTotalSales() error = %v", err)
+			}
+			if sales.OrderCount != tt.wantOrders || sales.TotalRevenue != models.NewMoney(tt.wantRevenue, "USD") || sales.TotalItemsSold != tt.wantItems {
+				t.Errorf("sales = %d orders, %v, %d items, want %d, %d, %d",
+					sales.OrderCount, sales.TotalRevenue, sales.TotalItemsSold, tt.wantOrders, tt.wantRevenue, tt.wantItems)
+			}
+		})
+	}
+}
+
+func TestGetSales(t *testing.T) {
+	// Time groups are taken in the time zone of the server
+	local := func(createdAt, layout string) string {
+		at, _ := time.Parse(time.RFC3339, createdAt)
+		return at.In(time.Local).Format(layout)
+	}
+
+	type group struct {
+		key     string
+		orders  int
+		revenue int64
+		items   int
+	}
+	tests := []struct {
+		name        string
+		groupBy     string
+		filter      models.ReportFilter
+		want        []group
+		wantRevenue int64
+		wantErr     error
+	}{
+		{
+			name:    "hour",
+			groupBy: models.GroupByHour,
+			want: []group{
+				{key: local("2024-03-01T09:15:00Z", "2006-01-02T15:00"), orders: 1, revenue: 400, items: 2},
+				{key: local("2024-03-01T14:40:00Z", "2006-01-02T15:00"), orders: 1, revenue: 550, items: 2},
+				{key: local("2024-03-05T12:00:00Z", "2006-01-02T15:00"), orders: 1, revenue: 600, items: 2},
+			},
+			wantRevenue: 1550,
+		},
+		{
+			name:    "week",
+			groupBy: models.GroupByWeek,
+			want: []group{
+				{key: "2024-W09", orders: 2, revenue: 950, items: 4},
+				{key: "2024-W10", orders: 1, revenue: 600, items: 2},
+			},
+			wantRevenue: 1550,
+		},
+		{
+			name:    "customer by revenue",
+			groupBy: models.GroupByCustomer,
+			want: []group{
+				{key: "Ann", orders: 2, revenue: 1000, items: 4},
+				{key: "Bob", orders: 1, revenue: 550, items: 2},
+			},
+			wantRevenue: 1550,
+		},
+		{
+			name:    "product at line prices",
+			groupBy: models.GroupByProduct,
+			want: []group{
+				{key: "latte", orders: 2, revenue: 1050, items: 3},
+				{key: "espresso", orders: 2, revenue: 600, items: 3},
+			},
+			wantRevenue: 1650,
+		},
+		{
+			name:        "limited",
+			groupBy:     models.GroupByCustomer,
+			filter:      models.ReportFilter{Limit: 1},
+			want:        []group{{key: "Ann", orders: 2, revenue: 1000, items: 4}},
+			wantRevenue: 1550,
+		},
+		{name: "unknown grouping", groupBy: "month", wantErr: ErrInvalidGrouping},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReportFixture(t)
+			report, err := s.order.GetSales(context.Background(), tt.filter, tt.groupBy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetSales() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if report.TotalRevenue.Amount != tt.wantRevenue {
+				t.Errorf("total revenue = %v, want %d", report.TotalRevenue, tt.wantRevenue)
+			}
+			if len(report.Groups) != len(tt.want) {
+				t.Fatalf("groups = %+v, want %d", report.Groups, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := report.Groups[i]
+				if got.Key != want.key || got.OrderCount != want.orders || got.Revenue.Amount != want.revenue || got.ItemsSold != want.items {
+					t.Errorf("group %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+var discardLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// testServices is the service layer wired the way the server wires it, on
+// storages kept in memory
+type testServices struct {
+	inventory     inventoryService
+	menu          menuService
+	order         orderService
+	supplier      supplierService
+	purchaseOrder purchaseOrderService
+	user          userService
+}
+
+func newTestServices(t *testing.T) testServices {
+	t.Helper()
+
+	storage := func(name string) repository.Storage {
+		s, err := repository.NewStorage(core.StorageMemory, "", name)
+		if err != nil {
+			t.Fatalf("NewStorage(%s) error = %v", name, err)
+		}
+		return s
+	}
+	inventoryStorage := storage(core.InventoryFile)
+	menuStorage := storage(core.MenuFile)
+	orderStorage := storage(core.OrderFile)
+	movementStorage, err := repository.NewLedgerStorage(core.StorageMemory, "", core.MovementFile)
+	if err != nil {
+		t.Fatalf("NewLedgerStorage() error = %v", err)
+	}
+	supplierStorage := storage(core.SupplierFile)
+	purchaseOrderStorage := storage(core.PurchaseFile)
+	userStorage := storage(core.UserFile)
+	sequenceStorage := storage(core.SequenceFile)
+
+	journal, err := repository.NewJournal("", discardLog, inventoryStorage, menuStorage, orderStorage,
+		movementStorage, supplierStorage, purchaseOrderStorage, userStorage, sequenceStorage)
+	if err != nil {
+		t.Fatalf("NewJournal() error = %v", err)
+	}
+
+	inventoryRepo := repository.NewInventoryRepository(inventoryStorage, discardLog)
+	menuRepo := repository.NewMenuRepository(menuStorage, discardLog)
+	orderRepo := repository.NewOrderRepository(orderStorage, discardLog)
+	movementRepo := repository.NewMovementRepository(movementStorage, discardLog)
+	supplierRepo := repository.NewSupplierRepository(supplierStorage, discardLog)
+	purchaseOrderRepo := repository.NewPurchaseOrderRepository(purchaseOrderStorage, discardLog)
+	userRepo := repository.NewUserRepository(userStorage, discardLog)
+	sequenceRepo := repository.NewSequenceRepository(sequenceStorage, discardLog)
+
+	inventory := NewInventoryService(inventoryRepo, movementRepo, menuRepo, orderRepo, purchaseOrderRepo, nil, journal, discardLog)
+	menu := NewMenuService(menuRepo, inventory, journal, discardLog)
+	supplier := NewSupplierService(supplierRepo, purchaseOrderRepo, journal, discardLog)
+	return testServices{
+		inventory:     inventory,
+		menu:          menu,
+		order:         NewOrderService(orderRepo, menu, inventory, journal, 0, discardLog),
+		supplier:      supplier,
+		purchaseOrder: NewPurchaseOrderService(purchaseOrderRepo, sequenceRepo, supplier, inventory, journal, discardLog),
+		user:          NewUserService(userRepo, journal, discardLog),
+	}
+}
+
+// addInventory creates inventory items, failing the test on error
+func (s testServices) addInventory(t *testing.T, items ...models.InventoryItem) {
+	t.Helper()
+	for i := range items {
+		if err := s.inventory.CreateInventoryItem(context.Background(), &items[i]); err != nil {
+			t.Fatalf("CreateInventoryItem(%s) error = %v", items[i].IngredientID, err)
+		}
+	}
+}
+
+// addMenu creates menu items, failing the test on error
+func (s testServices) addMenu(t *testing.T, items ...models.MenuItem) {
+	t.Helper()
+	for i := range items {
+		if err := s.menu.CreateMenuItem(context.Background(), &items[i]); err != nil {
+			t.Fatalf("CreateMenuItem(%s) error = %v", items[i].ID, err)
+		}
+	}
+}
+
+// quantity returns the stored quantity of an inventory item
+func (s testServices) quantity(t *testing.T, id string) float64 {
+	t.Helper()
+	item, err := s.inventory.GetInventoryItem(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetInventoryItem(%s) error = %v", id, err)
+	}
+	return item.Quantity
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// Notifier delivers low-stock alerts
+type Notifier interface {
+	Notify(ctx context.Context, alert models.StockAlert) error
+}
+
+// StockMonitor checks inventory levels in the background and raises an
+// alert when an item drops to its reorder threshold. An item is reported
+// once per crossing: it must be restocked above the threshold before it can
+// raise another alert. Which items were reported is only kept in memory, so
+// items already low when the monitor starts are reported again: a restart
+// may repeat an alert, but never loses one that was not delivered.
+type StockMonitor struct {
+	inventoryRepo repository.InventoryRepository
+	notifier      Notifier
+	interval      time.Duration
+	trigger       chan struct{}
+	alerted       map[string]bool // items reported as low and not restocked since
+	log           *slog.Logger
+}
+
+// NewStockMonitor creates a monitor that checks the inventory whenever it is
+// triggered and at least once every interval
+func NewStockMonitor(inventoryRepo repository.InventoryRepository, notifier Notifier, interval time.Duration, log *slog.Logger) *StockMonitor {
+	return &StockMonitor{
+		inventoryRepo: inventoryRepo,
+		notifier:      notifier,
+		interval:      interval,
+		trigger:       make(chan struct{}, 1),
+		alerted:       make(map[string]bool),
+		log:           log,
+	}
+}
+
+// Trigger asks for a check as soon as possible. It never blocks; triggers
+// arriving while a check is pending are merged into it.
+func (m *StockMonitor) Trigger() {
+	select {
+	case m.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the inventory until ctx is cancelled
+func (m *StockMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.check(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.trigger:
+			m.check(ctx)
+		case <-ticker.C:
+			m.check(ctx)
+		}
+	}
+}
+
+// check raises an alert for every item that became low since the last check
+func (m *StockMonitor) check(ctx context.Context) {
+	items, err := m.inventoryRepo.GetAll(ctx)
+	if err != nil {
+		m.log.ErrorContext(ctx, "stock check failed", "error", err)
+		return
+	}
+
+	present := make(map[string]bool, len(*items))
+	for _, item := range *items {
+		present[item.IngredientID] = true
+
+		if !item.IsLowStock() {
+			delete(m.alerted, item.IngredientID)
+			continue
+		}
+		if m.alerted[item.IngredientID] {
+			continue
+		}
+
+		alert := models.StockAlert{
+			IngredientID:     item.IngredientID,
+			Name:             item.Name,
+			Quantity:         item.Quantity,
+			Unit:             item.Unit,
+			ReorderThreshold: item.ReorderThreshold,
+			ReorderQuantity:  item.ReorderQuantity,
+			RaisedAt:         time.Now().Format(time.RFC3339),
+		}
+		if err := m.notifier.Notify(ctx, alert); err != nil {
+			// Not marked as alerted, so the next check tries again
+			m.log.ErrorContext(ctx, "failed to send low stock alert", "error", err, "ingredient_id", item.IngredientID)
+			continue
+		}
+		m.alerted[item.IngredientID] = true
+	}
+
+	for id := range m.alerted {
+		if !present[id] {
+			delete(m.alerted, id)
+		}
+	}
+}
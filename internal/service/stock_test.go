@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/core"
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+// recordingNotifier keeps the alerts it delivers and fails while err is set
+type recordingNotifier struct {
+	alerts []models.StockAlert
+	err    error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert models.StockAlert) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+// notifyFunc delivers alerts by calling itself
+type notifyFunc func(alert models.StockAlert)
+
+func (f notifyFunc) Notify(ctx context.Context, alert models.StockAlert) error {
+	f(alert)
+	return nil
+}
+
+func waitForAlert(t *testing.T, alerts <-chan models.StockAlert) models.StockAlert {
+	t.Helper()
+	select {
+	case alert := <-alerts:
+		return alert
+	case <-time.After(time.Second):
+		t.Fatal("no alert raised")
+		return models.StockAlert{}
+	}
+}
+
+func TestStockMonitorCheck(t *testing.T) {
+	errDelivery := errors.New("webhook responded with status 503")
+
+	type step struct {
+		quantity   float64
+		failing    bool // the notifier cannot deliver during this check
+		wantAlerts int  // delivered so far
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{name: "threshold crossed", steps: []step{{quantity: 500}, {quantity: 100, wantAlerts: 1}}},
+		{name: "no repeat while low", steps: []step{{quantity: 90, wantAlerts: 1}, {quantity: 80, wantAlerts: 1}, {quantity: 70, wantAlerts: 1}}},
+		{name: "re-armed by a restock", steps: []step{{quantity: 90, wantAlerts: 1}, {quantity: 500, wantAlerts: 1}, {quantity: 90, wantAlerts: 2}}},
+		{name: "failed delivery is retried", steps: []step{{quantity: 90, failing: true}, {quantity: 90, failing: true}, {quantity: 90, wantAlerts: 1}, {quantity: 90, wantAlerts: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := repository.NewInventoryRepository(repository.NewMemoryStorage(core.InventoryFile), discardLog)
+			item := &models.InventoryItem{IngredientID: "beans", Name: "Beans", Unit: "g", ReorderThreshold: 100, ReorderQuantity: 1000}
+			if err := repo.Create(ctx, item); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			notifier := &recordingNotifier{}
+			m := NewStockMonitor(repo, notifier, time.Hour, discardLog)
+
+			for i, step := range tt.steps {
+				item.Quantity = step.quantity
+				if err := repo.Update(ctx, item); err != nil {
+					t.Fatalf("Update() error = %v", err)
+				}
+				notifier.err = nil
+				if step.failing {
+					notifier.err = errDelivery
+				}
+
+				m.check(ctx)
+				if len(notifier.alerts) != step.wantAlerts {
+					t.Fatalf("after check %d at %v: %d alerts, want %d", i+1, step.quantity, len(notifier.alerts), step.wantAlerts)
+				}
+			}
+
+			if len(notifier.alerts) > 0 {
+				alert := notifier.alerts[0]
+				if alert.IngredientID != "beans" || alert.ReorderThreshold != 100 || alert.ReorderQuantity != 1000 || alert.RaisedAt == "" {
+					t.Errorf("alert = %+v", alert)
+				}
+			}
+		})
+	}
+}
+
+func TestStockMonitorRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := repository.NewInventoryRepository(repository.NewMemoryStorage(core.InventoryFile), discardLog)
+	for _, item := range []models.InventoryItem{
+		{IngredientID: "beans", Name: "Beans", Quantity: 50, Unit: "g", ReorderThreshold: 100},
+		{IngredientID: "milk", Name: "Milk", Quantity: 5000, Unit: "ml", ReorderThreshold: 1000},
+	} {
+		if err := repo.Create(ctx, &item); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	alerts := make(chan models.StockAlert, 2)
+	m := NewStockMonitor(repo, notifyFunc(func(alert models.StockAlert) { alerts <- alert }), time.Hour, discardLog)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx)
+	}()
+
+	// An item already low at startup is reported, not taken as reported
+	// before a restart
+	if alert := waitForAlert(t, alerts); alert.IngredientID != "beans" {
+		t.Errorf("first alert for %s, want beans", alert.IngredientID)
+	}
+
+	// A trigger checks right away rather than at the next interval
+	if err := repo.Update(ctx, &models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 800, Unit: "ml", ReorderThreshold: 1000}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	m.Trigger()
+	if alert := waitForAlert(t, alerts); alert.IngredientID != "milk" {
+		t.Errorf("second alert for %s, want milk", alert.IngredientID)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
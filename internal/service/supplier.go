@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type SupplierService interface {
+	CreateSupplier(ctx context.Context, supplier *models.Supplier) error
+	GetSupplier(ctx context.Context, id string) (*models.Supplier, error)
+	GetAllSuppliers(ctx context.Context) (*[]models.Supplier, error)
+	UpdateSupplier(ctx context.Context, id string, supplier *models.Supplier) error
+	DeleteSupplier(ctx context.Context, id string) error
+
+	WithTx(tx *repository.Tx) SupplierService
+}
+
+var (
+	ErrSupplierExists   = errors.New("supplier already exists")
+	ErrSupplierNotFound = errors.New("supplier not found")
+	ErrSupplierInUse    = errors.New("supplier has open purchase orders")
+)
+
+// supplierService handles business logic for suppliers
+type supplierService struct {
+	supplierRepo      repository.SupplierRepository
+	purchaseOrderRepo repository.PurchaseOrderRepository
+	transactor        repository.Transactor
+	log               *slog.Logger
+}
+
+// NewSupplierService initializes SupplierService with repositories, transactor and logging
+func NewSupplierService(supplierRepo repository.SupplierRepository, purchaseOrderRepo repository.PurchaseOrderRepository, transactor repository.Transactor, log *slog.Logger) supplierService {
+	return supplierService{
+		supplierRepo:      supplierRepo,
+		purchaseOrderRepo: purchaseOrderRepo,
+		transactor:        transactor,
+		log:               log,
+	}
+}
+
+// WithTx returns a service whose changes become part of tx
+func (s supplierService) WithTx(tx *repository.Tx) SupplierService {
+	return s.withTx(tx)
+}
+
+func (s supplierService) withTx(tx *repository.Tx) supplierService {
+	s.supplierRepo = s.supplierRepo.WithTx(tx)
+	s.purchaseOrderRepo = s.purchaseOrderRepo.WithTx(tx)
+	s.transactor = tx
+	return s
+}
+
+// atomically runs fn with a copy of the service bound to a transaction
+func (s supplierService) atomically(ctx context.Context, fn func(s supplierService) error) error {
+	return s.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		return fn(s.withTx(tx))
+	})
+}
+
+func (s supplierService) CreateSupplier(ctx context.Context, supplier *models.Supplier) error {
+	s.log.InfoContext(ctx, "creating supplier", "id", supplier.ID)
+
+	return s.atomically(ctx, func(s supplierService) error {
+		existing, err := s.supplierRepo.GetByID(ctx, supplier.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check existing supplier: %w", err)
+		}
+
+		if existing != nil {
+			return ErrSupplierExists
+		}
+
+		return s.supplierRepo.Create(ctx, supplier)
+	})
+}
+
+func (s supplierService) GetSupplier(ctx context.Context, id string) (*models.Supplier, error) {
+	s.log.InfoContext(ctx, "retrieving supplier", "id", id)
+
+	supplier, err := s.supplierRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get supplier: %w", err)
+	}
+
+	if supplier == nil {
+		return nil, ErrSupplierNotFound
+	}
+
+	return supplier, nil
+}
+
+func (s supplierService) GetAllSuppliers(ctx context.Context) (*[]models.Supplier, error) {
+	s.log.InfoContext(ctx, "retrieving all suppliers")
+
+	suppliers, err := s.supplierRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all suppliers: %w", err)
+	}
+
+	return suppliers, nil
+}
+
+func (s supplierService) UpdateSupplier(ctx context.Context, id string, supplier *models.Supplier) error {
+	s.log.InfoContext(ctx, "updating supplier", "id", id)
+
+	return s.atomically(ctx, func(s supplierService) error {
+		existing, err := s.supplierRepo.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to check existing supplier: %w", err)
+		}
+
+		if existing == nil {
+			return ErrSupplierNotFound
+		}
+
+		return s.supplierRepo.Update(ctx, supplier)
+	})
+}
+
+// DeleteSupplier removes a supplier that no open purchase order is waiting on
+func (s supplierService) DeleteSupplier(ctx context.Context, id string) error {
+	s.log.InfoContext(ctx, "deleting supplier", "id", id)
+
+	return s.atomically(ctx, func(s supplierService) error {
+		existing, err := s.supplierRepo.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to check existing supplier: %w", err)
+		}
+
+		if existing == nil {
+			return ErrSupplierNotFound
+		}
+
+		orders, err := s.purchaseOrderRepo.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check purchase orders: %w", err)
+		}
+		for _, order := range *orders {
+			if order.SupplierID == id && order.IsOpen() {
+				return fmt.Errorf("%w: %s", ErrSupplierInUse, order.ID)
+			}
+		}
+
+		return s.supplierRepo.Delete(ctx, id)
+	})
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ab-dauletkhan/hot-coffee/internal/repository"
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+type UserService interface {
+	CreateUser(ctx context.Context, user *models.User) (string, error)
+	GetUser(ctx context.Context, username string) (*models.User, error)
+	GetAllUsers(ctx context.Context) (*[]models.User, error)
+	UpdateUser(ctx context.Context, username string, user *models.User) error
+	DeleteUser(ctx context.Context, username string) error
+	RotateKey(ctx context.Context, username string) (string, error)
+
+	Authenticate(ctx context.Context, key string) (*models.User, error)
+	EnsureAdmin(ctx context.Context, key string) (string, error)
+
+	WithTx(tx *repository.Tx) UserService
+}
+
+var (
+	ErrInvalidKey    = errors.New("API key must be at least 20 characters")
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrLastAdmin     = errors.New("the last admin cannot be removed or demoted")
+)
+
+// adminUsername is the user created when there are no users yet
+const adminUsername = "admin"
+
+// minAPIKeyLength is the shortest key an admin may be given from outside
+const minAPIKeyLength = 20
+
+// userService handles API users and their keys
+type userService struct {
+	userRepo   repository.UserRepository
+	transactor repository.Transactor
+	log        *slog.Logger
+}
+
+// NewUserService initializes UserService with repository, transactor and logging
+func NewUserService(userRepo repository.UserRepository, transactor repository.Transactor, log *slog.Logger) userService {
+	return userService{
+		userRepo:   userRepo,
+		transactor: transactor,
+		log:        log,
+	}
+}
+
+// WithTx returns a service whose changes become part of tx
+func (s userService) WithTx(tx *repository.Tx) UserService {
+	return s.withTx(tx)
+}
+
+func (s userService) withTx(tx *repository.Tx) userService {
+	s.userRepo = s.userRepo.WithTx(tx)
+	s.transactor = tx
+	return s
+}
+
+// atomically runs fn with a copy of the service bound to a transaction
+func (s userService) atomically(ctx context.Context, fn func(s userService) error) error {
+	return s.transactor.Atomically(ctx, func(tx *repository.Tx) error {
+		return fn(s.withTx(tx))
+	})
+}
+
+// CreateUser adds a user and returns its API key, which is not stored and
+// cannot be shown again
+func (s userService) CreateUser(ctx context.Context, user *models.User) (string, error) {
+	s.log.InfoContext(ctx, "creating user", "username", user.Username, "role", user.Role)
+
+	key, err := newAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.createUser(ctx, user, key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// createUser adds a user whose API key is key
+func (s userService) createUser(ctx context.Context, user *models.User, key string) error {
+	err := s.atomically(ctx, func(s userService) error {
+		existing, err := s.userRepo.GetByID(ctx, user.Username)
+		if err != nil {
+			return fmt.Errorf("failed to check existing user: %w", err)
+		}
+
+		if existing != nil {
+			return ErrUserExists
+		}
+
+		user.KeyHash = hashAPIKey(key)
+		user.CreatedAt = time.Now().Format(time.RFC3339)
+		return s.userRepo.Create(ctx, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	user.KeyHash = ""
+	return nil
+}
+
+func (s userService) GetUser(ctx context.Context, username string) (*models.User, error) {
+	s.log.InfoContext(ctx, "retrieving user", "username", username)
+
+	user, err := s.userRepo.GetByID(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	user.KeyHash = ""
+	return user, nil
+}
+
+func (s userService) GetAllUsers(ctx context.Context) (*[]models.User, error) {
+	s.log.InfoContext(ctx, "retrieving all users")
+
+	users, err := s.userRepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all users: %w", err)
+	}
+
+	for i := range *users {
+		(*users)[i].KeyHash = ""
+	}
+	return users, nil
+}
+
+// UpdateUser changes the role of a user. The last admin keeps its role.
+func (s userService) UpdateUser(ctx context.Context, username string, user *models.User) error {
+	s.log.InfoContext(ctx, "updating user", "username", username, "role", user.Role)
+
+	return s.atomically(ctx, func(s userService) error {
+		existing, err := s.userRepo.GetByID(ctx, username)
+		if err != nil {
+			return fmt.Errorf("failed to check existing user: %w", err)
+		}
+
+		if existing == nil {
+			return ErrUserNotFound
+		}
+
+		if existing.Role == models.RoleAdmin && user.Role != models.RoleAdmin {
+			if err := s.keepAnAdmin(ctx, username); err != nil {
+				return err
+			}
+		}
+
+		existing.Role = user.Role
+		if err := s.userRepo.Update(ctx, existing); err != nil {
+			return err
+		}
+
+		*user = *existing
+		user.KeyHash = ""
+		return nil
+	})
+}
+
+func (s userService) DeleteUser(ctx context.Context, username string) error {
+	s.log.InfoContext(ctx, "deleting user", "username", username)
+
+	return s.atomically(ctx, func(s userService) error {
+		existing, err := s.userRepo.GetByID(ctx, username)
+		if err != nil {
+			return fmt.Errorf("failed to check existing user: %w", err)
+		}
+
+		if existing == nil {
+			return ErrUserNotFound
+		}
+
+		if existing.Role == models.RoleAdmin {
+			if err := s.keepAnAdmin(ctx, username); err != nil {
+				return err
+			}
+		}
+
+		return s.userRepo.Delete(ctx, username)
+	})
+}
+
+// RotateKey issues a new API key for the user; the old one stops working
+func (s userService) RotateKey(ctx context.Context, username string) (string, error) {
+	s.log.InfoContext(ctx, "rotating API key", "username", username)
+
+	key, err := newAPIKey()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.atomically(ctx, func(s userService) error {
+		existing, err := s.userRepo.GetByID(ctx, username)
+		if err != nil {
+			return fmt.Errorf("failed to check existing user: %w", err)
+		}
+
+		if existing == nil {
+			return ErrUserNotFound
+		}
+
+		existing.KeyHash = hashAPIKey(key)
+		return s.userRepo.Update(ctx, existing)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// Authenticate returns the user an API key belongs to
+func (s userService) Authenticate(ctx context.Context, key string) (*models.User, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByKeyHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user.KeyHash = ""
+	return user, nil
+}
+
+// EnsureAdmin creates an admin user when there are no users at all, so a
+// new installation can be set up. The admin gets key, or a new key when key
+// is empty. It returns the key it made up, or an empty string if it was
+// given one or users already exist.
+func (s userService) EnsureAdmin(ctx context.Context, key string) (string, error) {
+	if key != "" && len(key) < minAPIKeyLength {
+		return "", ErrInvalidKey
+	}
+
+	var created string
+	err := s.atomically(ctx, func(s userService) error {
+		users, err := s.userRepo.GetAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get all users: %w", err)
+		}
+
+		if len(*users) > 0 {
+			return nil
+		}
+
+		admin := models.User{Username: adminUsername, Role: models.RoleAdmin}
+		if key != "" {
+			return s.createUser(ctx, &admin, key)
+		}
+		created, err = s.CreateUser(ctx, &admin)
+		return err
+	})
+	return created, err
+}
+
+// keepAnAdmin fails unless an admin other than username exists
+func (s userService) keepAnAdmin(ctx context.Context, username string) error {
+	users, err := s.userRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get all users: %w", err)
+	}
+
+	for _, user := range *users {
+		if user.Role == models.RoleAdmin && user.Username != username {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
+
+// newAPIKey returns a random API key
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	return "hc_" + hex.EncodeToString(b), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ab-dauletkhan/hot-coffee/models"
+)
+
+func TestLastAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		users   map[string]string // username to role
+		change  func(s userService) error
+		wantErr error
+		want    map[string]string // roles afterwards, "" for deleted
+	}{
+		{
+			name:  "demote the only admin",
+			users: map[string]string{"ada": models.RoleAdmin, "bea": models.RoleBarista},
+			change: func(s userService) error {
+				return s.UpdateUser(context.Background(), "ada", &models.User{Role: models.RoleManager})
+			},
+			wantErr: ErrLastAdmin,
+			want:    map[string]string{"ada": models.RoleAdmin},
+		},
+		{
+			name:    "delete the only admin",
+			users:   map[string]string{"ada": models.RoleAdmin, "bea": models.RoleBarista},
+			change:  func(s userService) error { return s.DeleteUser(context.Background(), "ada") },
+			wantErr: ErrLastAdmin,
+			want:    map[string]string{"ada": models.RoleAdmin},
+		},
+		{
+			name:  "admin keeps the admin role",
+			users: map[string]string{"ada": models.RoleAdmin},
+			change: func(s userService) error {
+				return s.UpdateUser(context.Background(), "ada", &models.User{Role: models.RoleAdmin})
+			},
+			want: map[string]string{"ada": models.RoleAdmin},
+		},
+		{
+			name:  "demote one of two admins",
+			users: map[string]string{"ada": models.RoleAdmin, "abe": models.RoleAdmin},
+			change: func(s userService) error {
+				return s.UpdateUser(context.Background(), "ada", &models.User{Role: models.RoleBarista})
+			},
+			want: map[string]string{"ada": models.RoleBarista, "abe": models.RoleAdmin},
+		},
+		{
+			name:   "delete one of two admins",
+			users:  map[string]string{"ada": models.RoleAdmin, "abe": models.RoleAdmin},
+			change: func(s userService) error { return s.DeleteUser(context.Background(), "ada") },
+			want:   map[string]string{"ada": "", "abe": models.RoleAdmin},
+		},
+		{
+			name:   "delete a barista",
+			users:  map[string]string{"ada": models.RoleAdmin, "bea": models.RoleBarista},
+			change: func(s userService) error { return s.DeleteUser(context.Background(), "bea") },
+			want:   map[string]string{"ada": models.RoleAdmin, "bea": ""},
+		},
+		{
+			name:    "delete a missing user",
+			users:   map[string]string{"ada": models.RoleAdmin},
+			change:  func(s userService) error { return s.DeleteUser(context.Background(), "zed") },
+			wantErr: ErrUserNotFound,
+			want:    map[string]string{"ada": models.RoleAdmin},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestServices(t).user
+			for username, role := range tt.users {
+				if _, err := s.CreateUser(ctx, &models.User{Username: username, Role: role}); err != nil {
+					t.Fatalf("CreateUser(%s) error = %v", username, err)
+				}
+			}
+
+			if err := tt.change(s); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			for username, want := range tt.want {
+				user, err := s.GetUser(ctx, username)
+				switch {
+				case want == "" && !errors.Is(err, ErrUserNotFound):
+					t.Errorf("GetUser(%s) = %+v, %v, want it deleted", username, user, err)
+				case want != "" && (err != nil || user.Role != want):
+					t.Errorf("GetUser(%s) = %+v, %v, want role %s", username, user, err, want)
+				}
+			}
+		})
+	}
+}
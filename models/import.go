@@ -0,0 +1,35 @@
+package models
+
+// ImportResult reports what a bulk import did, or would do in a dry run.
+// When any row has errors nothing is saved.
+type ImportResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Upsert  bool          `json:"upsert"`
+	Created []string      `json:"created"`
+	Updated []string      `json:"updated"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ImportError is a problem with one row of an import. Rows are counted as
+// in a spreadsheet, with the header as row 1.
+type ImportError struct {
+	Row   int    `json:"row"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+// NewImportResult returns an empty result for an import with the given options
+func NewImportResult(dryRun, upsert bool) *ImportResult {
+	return &ImportResult{
+		DryRun:  dryRun,
+		Upsert:  upsert,
+		Created: []string{},
+		Updated: []string{},
+		Errors:  []ImportError{},
+	}
+}
+
+// AddError records err against a row
+func (r *ImportResult) AddError(row int, id string, err error) {
+	r.Errors = append(r.Errors, ImportError{Row: row, ID: id, Error: err.Error()})
+}
@@ -17,6 +17,30 @@ type InventoryItem struct {
 	Name         string  `json:"name"`
 	Quantity     float64 `json:"quantity"`
 	Unit         string  `json:"unit"`
+
+	// ReorderThreshold is the quantity at or below which the item is low on
+	// stock; zero disables the check. ReorderQuantity is how much to order
+	// when that happens.
+	ReorderThreshold float64 `json:"reorder_threshold,omitempty"`
+	ReorderQuantity  float64 `json:"reorder_quantity,omitempty"`
+
+	// SupplierID is the supplier draft purchase orders for the item go to
+	SupplierID string `json:"supplier_id,omitempty"`
+
+	// ShotSize is the volume of one shot in ml, letting recipes measured in
+	// shots use an item stocked by volume and the other way round
+	ShotSize float64 `json:"shot_size,omitempty"`
+}
+
+// StockAlert reports an inventory item that has dropped to its reorder threshold
+type StockAlert struct {
+	IngredientID     string  `json:"ingredient_id"`
+	Name             string  `json:"name"`
+	Quantity         float64 `json:"quantity"`
+	Unit             string  `json:"unit"`
+	ReorderThreshold float64 `json:"reorder_threshold"`
+	ReorderQuantity  float64 `json:"reorder_quantity,omitempty"`
+	RaisedAt         string  `json:"raised_at"`
 }
 
 // IsValid performs validation and normalization on the InventoryItem.
@@ -44,9 +68,26 @@ func (i *InventoryItem) validateFields() error {
 	if !isValidUnit(i.Unit) {
 		return fmt.Errorf("unit must be one of %v", strings.Join(validUnits, ", "))
 	}
+	if i.ReorderThreshold < 0 {
+		return errors.New("reorder_threshold should not be negative")
+	}
+	if i.ReorderQuantity < 0 {
+		return errors.New("reorder_quantity should not be negative")
+	}
+	if i.ShotSize < 0 {
+		return errors.New("shot_size should not be negative")
+	}
+	if i.SupplierID != "" && !validIngredientID.MatchString(i.SupplierID) {
+		return errors.New("supplier_id must be alphanumeric with underscores only")
+	}
 	return nil
 }
 
+// IsLowStock reports whether the item has dropped to its reorder threshold
+func (i *InventoryItem) IsLowStock() bool {
+	return i.ReorderThreshold > 0 && i.Quantity <= i.ReorderThreshold
+}
+
 func (i *InventoryItem) normalizeFields() {
 	i.Name = strings.Title(strings.TrimSpace(i.Name))
 	i.Unit = strings.ToLower(strings.TrimSpace(i.Unit))
@@ -57,14 +98,3 @@ func (i *InventoryItem) normalizeFields() {
 // func generateID(name string) string {
 // 	return strings.ToLower(strings.ReplaceAll(name, " ", "_"))
 // }
-
-var validUnits = []string{"g", "ml", "shots"}
-
-func isValidUnit(unit string) bool {
-	for _, u := range validUnits {
-		if u == unit {
-			return true
-		}
-	}
-	return false
-}
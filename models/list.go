@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListOptions pages and orders a list. Without a sort field the list is
+// ordered by ID.
+type ListOptions struct {
+	Offset int
+	Limit  int // 0 means no limit
+	Sort   string
+	Desc   bool
+}
+
+// Fields lists can be sorted by
+var (
+	OrderSortFields     = []string{"order_id", "customer_name", "status", "created_at", "total"}
+	InventorySortFields = []string{"ingredient_id", "name", "quantity"}
+	MenuSortFields      = []string{"product_id", "name", "price"}
+)
+
+// CheckSort makes sure the sort field is one of fields
+func (o ListOptions) CheckSort(fields []string) error {
+	if o.Sort == "" {
+		return nil
+	}
+	for _, field := range fields {
+		if o.Sort == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("sort must be one of: %s", strings.Join(fields, ", "))
+}
+
+// OrderFilter selects orders by status, customer and creation time
+type OrderFilter struct {
+	Statuses []string  // empty means any status
+	Customer string    // matched case-insensitively against part of the name
+	From     time.Time // orders created at or after From; zero means no bound
+	To       time.Time // orders created before To; zero means no bound
+}
+
+// Includes reports whether the order passes the filter
+func (f OrderFilter) Includes(o *Order) bool {
+	if f.Customer != "" && !strings.Contains(strings.ToLower(o.CustomerName), strings.ToLower(f.Customer)) {
+		return false
+	}
+	return ReportFilter{From: f.From, To: f.To, Statuses: f.Statuses}.Includes(o)
+}
+
+// InventoryFilter selects inventory items
+type InventoryFilter struct {
+	LowStock bool // only items at or below their reorder threshold
+}
+
+// Includes reports whether the item passes the filter
+func (f InventoryFilter) Includes(i *InventoryItem) bool {
+	return !f.LowStock || i.IsLowStock()
+}
+
+// MenuFilter selects menu items
+type MenuFilter struct {
+	IngredientID string // only items whose recipe uses the ingredient
+}
+
+// Includes reports whether the item passes the filter
+func (f MenuFilter) Includes(m *MenuItem) bool {
+	if f.IngredientID == "" {
+		return true
+	}
+	for _, ingredient := range m.Ingredients {
+		if ingredient.IngredientID == f.IngredientID {
+			return true
+		}
+	}
+	return false
+}
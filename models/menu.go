@@ -10,13 +10,25 @@ type MenuItem struct {
 	ID          string               `json:"product_id"`
 	Name        string               `json:"name"`
 	Description string               `json:"description"`
-	Price       float64              `json:"price"`
+	Price       Money                `json:"price"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
 }
 
+// AvailableMenuItem is a menu item with the number of portions the current
+// stock can make. Portions is nil for an item whose recipe uses no
+// ingredients, as stock does not limit it.
+type AvailableMenuItem struct {
+	MenuItem
+	Available bool `json:"available"`
+	Portions  *int `json:"portions"`
+}
+
+// MenuItemIngredient is an amount of an inventory item. Without a unit the
+// quantity is in the unit the item is stocked in.
 type MenuItemIngredient struct {
 	IngredientID string  `json:"ingredient_id"`
 	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"`
 }
 
 func (m *MenuItem) IsValid() error {
@@ -34,14 +46,17 @@ func (m *MenuItem) validateFields() error {
 	if m.Name == "" || !validNameRegex.MatchString(m.Name) {
 		return errors.New("name must contain only letters and spaces")
 	}
-	if m.Price < 0 {
+	if m.Price.IsNegative() {
 		return errors.New("price must be non-negative")
 	}
+	if m.Price.Currency != "" && m.Price.Currency != DefaultCurrency {
+		return fmt.Errorf("price must be in %s", DefaultCurrency)
+	}
 	if len(m.Description) > 500 {
 		return errors.New("description cannot exceed 500 characters")
 	}
-	for _, ingredient := range m.Ingredients {
-		if err := ingredient.IsValid(); err != nil {
+	for i := range m.Ingredients {
+		if err := m.Ingredients[i].IsValid(); err != nil {
 			return fmt.Errorf("invalid ingredient in menu item: %w", err)
 		}
 	}
@@ -51,6 +66,9 @@ func (m *MenuItem) validateFields() error {
 func (m *MenuItem) normalizeFields() {
 	m.Name = strings.Title(strings.TrimSpace(m.Name))
 	m.Description = strings.TrimSpace(m.Description)
+	if m.Price.Currency == "" {
+		m.Price.Currency = DefaultCurrency
+	}
 }
 
 func (mi *MenuItemIngredient) IsValid() error {
@@ -60,5 +78,9 @@ func (mi *MenuItemIngredient) IsValid() error {
 	if mi.Quantity <= 0 {
 		return errors.New("quantity must be a positive number")
 	}
+	mi.Unit = strings.ToLower(strings.TrimSpace(mi.Unit))
+	if mi.Unit != "" && !isValidUnit(mi.Unit) {
+		return fmt.Errorf("unit must be one of %v", strings.Join(validUnits, ", "))
+	}
 	return nil
 }
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// DefaultCurrency is the currency of the shop. Amounts stored as plain
+// numbers, as older data files do, are read in this currency.
+var DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("amounts are in different currencies")
+	ErrInvalidAmount    = errors.New("invalid money amount")
+
+	validCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+	validDecimal  = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]{1,3})?$`)
+
+	// maxAmount bounds parsed amounts, so that sums of them fit in an int64
+	maxAmount = new(big.Rat).SetInt64(1 << 53)
+)
+
+// currencyExponents holds the number of decimals of the ISO 4217 currencies
+// whose minor unit is not a hundredth. Every other currency has two.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// Exponent returns the number of decimals of currency, 2 for a dollar
+func Exponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// minorUnits returns the number of minor units in one major unit of
+// currency, e.g. 100 cents in a dollar and 1 yen in a yen
+func minorUnits(currency string) int64 {
+	units := int64(1)
+	for i := 0; i < Exponent(currency); i++ {
+		units *= 10
+	}
+	return units
+}
+
+// Money is an amount in minor units of a currency, so sums are exact.
+// It is written to JSON as {"amount": 350, "currency": "USD"} with amount in
+// minor units. A plain number such as 3.5 is also accepted and read as major
+// units of DefaultCurrency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+type moneyJSON struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// NewMoney returns amount minor units of currency
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads a decimal amount in major units of currency, such as
+// "3.5" for 3.50 USD. Digits past the decimals of the currency are rounded
+// half away from zero.
+func ParseMoney(amount, currency string) (Money, error) {
+	if !validDecimal.MatchString(amount) {
+		return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, amount)
+	}
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, amount)
+	}
+	r.Mul(r, big.NewRat(minorUnits(currency), 1))
+	if new(big.Rat).Abs(r).Cmp(maxAmount) > 0 {
+		return Money{}, fmt.Errorf("%w: %s is too large", ErrInvalidAmount, amount)
+	}
+	return Money{Amount: roundRat(r), Currency: currency}, nil
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns m + other. A zero Money without a currency takes the currency
+// of the other operand, so it can be used as the start of a sum.
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyWith(other)}
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyWith(other)}
+}
+
+// Mul returns m multiplied by n
+func (m Money) Mul(n int) Money {
+	return Money{Amount: m.Amount * int64(n), Currency: m.Currency}
+}
+
+// Percent returns rate percent of m, rounded half away from zero to a
+// whole minor unit
+func (m Money) Percent(rate float64) Money {
+	r, ok := new(big.Rat).SetString(fmt.Sprint(rate))
+	if !ok {
+		return Money{Currency: m.Currency}
+	}
+	r.Mul(r, new(big.Rat).SetInt64(m.Amount))
+	r.Quo(r, big.NewRat(100, 1))
+	return Money{Amount: roundRat(r), Currency: m.Currency}
+}
+
+// SameCurrency reports whether m and other can be added together
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == "" || other.Currency == "" || m.Currency == other.Currency
+}
+
+func (m Money) currencyWith(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// Decimal formats the amount in major units without the currency, with as
+// many decimals as the currency has, e.g. "3.50" USD or "350" JPY. Money
+// without a currency is formatted in DefaultCurrency.
+func (m Money) Decimal() string {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	exponent, units := Exponent(currency), minorUnits(currency)
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/units, exponent, amount%units)
+}
+
+// String formats the amount in major units, e.g. "3.50 USD"
+func (m Money) String() string {
+	s := m.Decimal()
+	if m.Currency != "" {
+		s += " " + m.Currency
+	}
+	return s
+}
+
+// Validate checks that the amount is not negative and the currency is a
+// three letter code
+func (m Money) Validate() error {
+	if m.IsNegative() {
+		return errors.New("must be non-negative")
+	}
+	if !validCurrency.MatchString(m.Currency) {
+		return fmt.Errorf("currency must be a three letter code, got %q", m.Currency)
+	}
+	return nil
+}
+
+// MarshalJSON writes the amount and currency. Money without a currency has
+// never been set and is written as null.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.Currency == "" && m.Amount == 0 {
+		return []byte("null"), nil
+	}
+	return json.Marshal(moneyJSON{Amount: m.Amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON reads either the object form or a plain number in major
+// units of DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*m = Money{}
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		var v moneyJSON
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+		if v.Currency == "" {
+			v.Currency = DefaultCurrency
+		}
+		*m = Money{Amount: v.Amount, Currency: v.Currency}
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+	}
+	money, err := ParseMoney(number.String(), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+// roundRat rounds r half away from zero to an integer
+func roundRat(r *big.Rat) int64 {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	neg := num.Sign() < 0
+	num.Abs(num)
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if neg {
+		quo.Neg(quo)
+	}
+	return quo.Int64()
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"3.5", "USD", 350, false},
+		{"3.50", "USD", 350, false},
+		{"0", "USD", 0, false},
+		{"-1.25", "USD", -125, false},
+		{"0.005", "USD", 1, false},
+		{"0.004", "USD", 0, false},
+		{"-0.005", "USD", -1, false},
+		{"2.675", "USD", 268, false},
+		{"3.5e2", "USD", 35000, false},
+		{"350", "JPY", 350, false},
+		{"350.5", "JPY", 351, false},
+		{"1.234", "KWD", 1234, false},
+		{"1.2345", "KWD", 1235, false},
+		{"1", "CLF", 10000, false},
+		{"", "USD", 0, true},
+		{"abc", "USD", 0, true},
+		{"1/3", "USD", 0, true},
+		{"0x10", "USD", 0, true},
+		{"1e400", "USD", 0, true},
+		{"99999999999999999999", "USD", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.amount, tt.currency)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Fatalf("ParseMoney() error = %v, want ErrInvalidAmount", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney() error = %v", err)
+			}
+			if got.Amount != tt.want || got.Currency != tt.currency {
+				t.Errorf("ParseMoney() = %+v, want %d %s", got, tt.want, tt.currency)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{NewMoney(350, "USD"), "3.50"},
+		{NewMoney(5, "USD"), "0.05"},
+		{NewMoney(0, "USD"), "0.00"},
+		{NewMoney(-125, "USD"), "-1.25"},
+		{NewMoney(-5, "USD"), "-0.05"},
+		{NewMoney(350, "JPY"), "350"},
+		{NewMoney(-350, "KRW"), "-350"},
+		{NewMoney(1234, "KWD"), "1.234"},
+		{NewMoney(5, "BHD"), "0.005"},
+		{NewMoney(10000, "CLF"), "1.0000"},
+		{Money{Amount: 350}, "3.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.money.Decimal(); got != tt.want {
+				t.Errorf("Decimal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount int64
+		rate   float64
+		want   int64
+	}{
+		{1000, 10, 100},
+		{999, 8.25, 82},
+		{1000, 8.25, 83},
+		{150, 10, 15},
+		{5, 10, 1},
+		{4, 10, 0},
+		{-5, 10, -1},
+		{1000, 0, 0},
+	}
+
+	for _, tt := range tests {
+		got := NewMoney(tt.amount, "USD").Percent(tt.rate)
+		if got.Amount != tt.want {
+			t.Errorf("%d.Percent(%v) = %d, want %d", tt.amount, tt.rate, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	defer func(currency string) { DefaultCurrency = currency }(DefaultCurrency)
+
+	tests := []struct {
+		name     string
+		currency string
+		data     string
+		want     Money
+		wantErr  bool
+	}{
+		{"object", "USD", `{"amount": 350, "currency": "EUR"}`, NewMoney(350, "EUR"), false},
+		{"object without currency", "USD", `{"amount": 350}`, NewMoney(350, "USD"), false},
+		{"number", "USD", `3.5`, NewMoney(350, "USD"), false},
+		{"number rounded", "USD", `3.505`, NewMoney(351, "USD"), false},
+		{"number in yen", "JPY", `350`, NewMoney(350, "JPY"), false},
+		{"number in dinar", "KWD", `1.5`, NewMoney(1500, "KWD"), false},
+		{"null", "USD", `null`, Money{}, false},
+		{"quoted number", "USD", `"3.5"`, NewMoney(350, "USD"), false},
+		{"word", "USD", `"abc"`, Money{}, true},
+		{"bad object", "USD", `{"amount": "x"}`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DefaultCurrency = tt.currency
+
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unmarshal() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+	for _, m := range []Money{NewMoney(350, "USD"), NewMoney(350, "JPY"), NewMoney(1234, "KWD"), NewMoney(-5, "USD")} {
+		got, err := ParseMoney(m.Decimal(), m.Currency)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q) error = %v", m.Decimal(), err)
+		}
+		if got != m {
+			t.Errorf("ParseMoney(%q) = %+v, want %+v", m.Decimal(), got, m)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Inventory movement types
+const (
+	MovementReceipt          = "receipt"
+	MovementOrderConsumption = "order_consumption"
+	MovementOrderRestock     = "order_restock"
+	MovementAdjustment       = "adjustment"
+	MovementWaste            = "waste"
+
+	// MovementOpening brings stock that was never recorded into the ledger
+	MovementOpening = "opening"
+)
+
+// InventoryMovement is an entry of the inventory ledger: a single change to
+// the quantity of an ingredient. Entries are never changed or removed, so
+// the quantity of an item is the sum of the deltas of its movements.
+type InventoryMovement struct {
+	ID              string  `json:"movement_id"`
+	IngredientID    string  `json:"ingredient_id"`
+	Type            string  `json:"type"`
+	Delta           float64 `json:"delta"`
+	Unit            string  `json:"unit,omitempty"` // the unit of the item when recorded
+	Reason          string  `json:"reason,omitempty"`
+	OrderID         string  `json:"order_id,omitempty"`
+	PurchaseOrderID string  `json:"purchase_order_id,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+// IsValid checks a movement recorded by hand. Order movements are only
+// recorded by the server.
+func (m *InventoryMovement) IsValid() error {
+	m.Reason = strings.TrimSpace(m.Reason)
+	m.Unit = strings.ToLower(strings.TrimSpace(m.Unit))
+
+	switch m.Type {
+	case MovementReceipt:
+		if m.Delta <= 0 {
+			return errors.New("delta of a receipt must be positive")
+		}
+	case MovementWaste:
+		if m.Delta >= 0 {
+			return errors.New("delta of waste must be negative")
+		}
+	case MovementAdjustment:
+		if m.Delta == 0 {
+			return errors.New("delta must be non-zero")
+		}
+	default:
+		return errors.New("type must be one of: receipt, adjustment, waste")
+	}
+
+	if m.OrderID != "" || m.PurchaseOrderID != "" {
+		return errors.New("order_id and purchase_order_id must not be provided")
+	}
+	if len(m.Reason) > 500 {
+		return errors.New("reason cannot exceed 500 characters")
+	}
+	return nil
+}
+
+// InventoryLedger is the movement history of an ingredient together with the
+// quantity the history adds up to, for reconciliation with the stored quantity
+type InventoryLedger struct {
+	IngredientID   string              `json:"ingredient_id"`
+	Quantity       float64             `json:"quantity"`
+	LedgerQuantity float64             `json:"ledger_quantity"`
+	Discrepancy    float64             `json:"discrepancy"`
+	Movements      []InventoryMovement `json:"movements"`
+}
+
+// NewInventoryLedger sums movements and compares the result with quantity
+func NewInventoryLedger(ingredientID string, quantity float64, movements []InventoryMovement) InventoryLedger {
+	var sum float64
+	for _, movement := range movements {
+		sum += movement.Delta
+	}
+	if movements == nil {
+		movements = []InventoryMovement{}
+	}
+
+	return InventoryLedger{
+		IngredientID:   ingredientID,
+		Quantity:       quantity,
+		LedgerQuantity: RoundQuantity(sum),
+		Discrepancy:    RoundQuantity(quantity - sum),
+		Movements:      movements,
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import "testing"
+
+func TestNewInventoryLedger(t *testing.T) {
+	tests := []struct {
+		name            string
+		quantity        float64
+		deltas          []float64
+		wantLedger      float64
+		wantDiscrepancy float64
+	}{
+		{name: "no movements", quantity: 0},
+		{name: "balanced", quantity: 882, deltas: []float64{1000, -18, -100}, wantLedger: 882},
+		{name: "stock changed by hand", quantity: 900, deltas: []float64{1000, -18}, wantLedger: 982, wantDiscrepancy: -82},
+		{name: "stock never recorded", quantity: 500, wantDiscrepancy: 500},
+		{name: "float residue is rounded", quantity: 0.3, deltas: []float64{0.1, 0.2}, wantLedger: 0.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var movements []InventoryMovement
+			for _, delta := range tt.deltas {
+				movements = append(movements, InventoryMovement{IngredientID: "beans", Delta: delta})
+			}
+
+			ledger := NewInventoryLedger("beans", tt.quantity, movements)
+			if ledger.LedgerQuantity != tt.wantLedger || ledger.Discrepancy != tt.wantDiscrepancy {
+				t.Errorf("ledger quantity %v, discrepancy %v, want %v, %v", ledger.LedgerQuantity, ledger.Discrepancy, tt.wantLedger, tt.wantDiscrepancy)
+			}
+			if ledger.Movements == nil {
+				t.Error("movements = nil, want an empty list")
+			}
+		})
+	}
+}
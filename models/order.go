@@ -3,28 +3,89 @@ package models
 import (
 	"errors"
 	"strings"
+	"time"
 )
 
 type Order struct {
-	ID           string      `json:"order_id,omitempty"`
-	CustomerName string      `json:"customer_name"`
-	Items        []OrderItem `json:"items"`
-	Status       string      `json:"status,omitempty"`
-	CreatedAt    string      `json:"created_at,omitempty"`
+	ID            string         `json:"order_id,omitempty"`
+	CustomerName  string         `json:"customer_name"`
+	Items         []OrderItem    `json:"items"`
+	Status        string         `json:"status,omitempty"`
+	CreatedAt     string         `json:"created_at,omitempty"`
+	StatusHistory []StatusChange `json:"status_history,omitempty"`
+
+	// Ingredients are the inventory quantities taken for the order, kept so
+	// exactly these amounts can be returned if the order is cancelled
+	Ingredients []MenuItemIngredient `json:"ingredients,omitempty"`
+
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount"`
+	Tax      Money `json:"tax"`
+	Total    Money `json:"total"`
+}
+
+// StatusChange records when an order entered a status
+type StatusChange struct {
+	Status    string `json:"status"`
+	ChangedAt string `json:"changed_at"`
 }
 
+// OrderItem is a line of an order. ProductName and UnitPrice are copied from
+// the menu when the order is placed, so later menu changes do not alter it.
 type OrderItem struct {
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name,omitempty"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unit_price"`
 }
 
 var (
 	ErrItemNotAvailable = errors.New("ingridient not available")
+	ErrDiscountTooLarge = errors.New("discount cannot exceed the order subtotal")
 
-	StatusPending   = "pending"
-	StatusCompleted = "closed"
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusReady      = "ready"
+	StatusCompleted  = "closed"
+	StatusCancelled  = "cancelled"
 )
 
+// orderTransitions lists the statuses an order may move to from each status.
+// Closed and cancelled orders are final.
+var orderTransitions = map[string][]string{
+	StatusPending:    {StatusInProgress, StatusCompleted, StatusCancelled},
+	StatusInProgress: {StatusReady, StatusCancelled},
+	StatusReady:      {StatusCompleted},
+}
+
+// IsValidOrderStatus reports whether status is one an order can have
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusInProgress, StatusReady, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransition reports whether the order may move to the given status
+func (o *Order) CanTransition(status string) bool {
+	for _, next := range orderTransitions[o.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the order to status and records the change in its history
+func (o *Order) SetStatus(status string, at time.Time) {
+	o.Status = status
+	o.StatusHistory = append(o.StatusHistory, StatusChange{
+		Status:    status,
+		ChangedAt: at.Format(time.RFC3339),
+	})
+}
+
 func (o *Order) IsValid() error {
 	if err := o.validateFields(); err != nil {
 		return err
@@ -45,6 +106,9 @@ func (o *Order) validateFields() error {
 			return err
 		}
 	}
+	if o.Discount.IsNegative() {
+		return errors.New("discount must be non-negative")
+	}
 	return nil
 }
 
@@ -52,6 +116,40 @@ func (o *Order) normalizeFields() {
 	o.CustomerName = strings.Title(strings.TrimSpace(o.CustomerName))
 }
 
+// IsPriced reports whether the line carries a snapshot of the menu item.
+// Orders created before snapshots were taken have unpriced lines.
+func (oi *OrderItem) IsPriced() bool {
+	return oi.ProductName != ""
+}
+
+// CalculateTotals sets the subtotal, tax and total from the priced lines
+// and the discount. taxRate is a percentage applied after the discount.
+func (o *Order) CalculateTotals(taxRate float64) error {
+	subtotal := Money{Currency: DefaultCurrency}
+	for _, item := range o.Items {
+		if !subtotal.SameCurrency(item.UnitPrice) {
+			return ErrCurrencyMismatch
+		}
+		subtotal = subtotal.Add(item.UnitPrice.Mul(item.Quantity))
+	}
+
+	if !subtotal.SameCurrency(o.Discount) {
+		return ErrCurrencyMismatch
+	}
+	if o.Discount.Currency == "" {
+		o.Discount.Currency = subtotal.Currency
+	}
+	if o.Discount.Amount > subtotal.Amount {
+		return ErrDiscountTooLarge
+	}
+
+	discounted := subtotal.Sub(o.Discount)
+	o.Subtotal = subtotal
+	o.Tax = discounted.Percent(taxRate)
+	o.Total = discounted.Add(o.Tax)
+	return nil
+}
+
 func (oi *OrderItem) IsValid() error {
 	if oi.ProductID == "" || !validIngredientID.MatchString(oi.ProductID) {
 		return errors.New("product_id must be non-empty and alphanumeric with underscores only")
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrderCanTransition(t *testing.T) {
+	statuses := []string{StatusPending, StatusInProgress, StatusReady, StatusCompleted, StatusCancelled}
+	allowed := map[[2]string]bool{
+		{StatusPending, StatusInProgress}:   true,
+		{StatusPending, StatusCompleted}:    true,
+		{StatusPending, StatusCancelled}:    true,
+		{StatusInProgress, StatusReady}:     true,
+		{StatusInProgress, StatusCancelled}: true,
+		{StatusReady, StatusCompleted}:      true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			order := Order{Status: from}
+			if got, want := order.CanTransition(to), allowed[[2]string{from, to}]; got != want {
+				t.Errorf("CanTransition(%s -> %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestOrderSetStatus(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	order := Order{Status: StatusPending}
+	order.SetStatus(StatusInProgress, at)
+	order.SetStatus(StatusReady, at.Add(time.Minute))
+
+	want := []StatusChange{
+		{Status: StatusInProgress, ChangedAt: "2024-03-01T09:30:00Z"},
+		{Status: StatusReady, ChangedAt: "2024-03-01T09:31:00Z"},
+	}
+	if order.Status != StatusReady {
+		t.Errorf("Status = %q, want %q", order.Status, StatusReady)
+	}
+	if len(order.StatusHistory) != len(want) {
+		t.Fatalf("StatusHistory = %+v, want %+v", order.StatusHistory, want)
+	}
+	for i := range want {
+		if order.StatusHistory[i] != want[i] {
+			t.Errorf("StatusHistory[%d] = %+v, want %+v", i, order.StatusHistory[i], want[i])
+		}
+	}
+}
+
+func TestOrderCalculateTotals(t *testing.T) {
+	usd := func(amount int64) Money { return NewMoney(amount, "USD") }
+	line := func(price int64, quantity int) OrderItem {
+		return OrderItem{ProductID: "p", ProductName: "P", Quantity: quantity, UnitPrice: usd(price)}
+	}
+
+	tests := []struct {
+		name         string
+		items        []OrderItem
+		discount     Money
+		taxRate      float64
+		wantSubtotal int64
+		wantTax      int64
+		wantTotal    int64
+		wantErr      error
+	}{
+		{name: "no lines", wantSubtotal: 0, wantTax: 0, wantTotal: 0},
+		{name: "lines", items: []OrderItem{line(350, 2), line(200, 1)}, taxRate: 8, wantSubtotal: 900, wantTax: 72, wantTotal: 972},
+		{name: "tax after discount", items: []OrderItem{line(350, 2), line(200, 1)}, discount: usd(100), taxRate: 8, wantSubtotal: 900, wantTax: 64, wantTotal: 864},
+		{name: "discount without currency", items: []OrderItem{line(500, 1)}, discount: Money{Amount: 50}, wantSubtotal: 500, wantTotal: 450},
+		{name: "tax rounds half up", items: []OrderItem{line(125, 1)}, taxRate: 10, wantSubtotal: 125, wantTax: 13, wantTotal: 138},
+		{name: "whole subtotal discounted", items: []OrderItem{line(300, 1)}, discount: usd(300), taxRate: 8, wantSubtotal: 300},
+		{name: "discount above subtotal", items: []OrderItem{line(300, 1)}, discount: usd(301), wantErr: ErrDiscountTooLarge},
+		{name: "line in another currency", items: []OrderItem{line(300, 1), {ProductID: "e", Quantity: 1, UnitPrice: NewMoney(300, "EUR")}}, wantErr: ErrCurrencyMismatch},
+		{name: "discount in another currency", items: []OrderItem{line(300, 1)}, discount: NewMoney(50, "EUR"), wantErr: ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := Order{Items: tt.items, Discount: tt.discount}
+			err := order.CalculateTotals(tt.taxRate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CalculateTotals() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if order.Subtotal != usd(tt.wantSubtotal) || order.Tax != usd(tt.wantTax) || order.Total != usd(tt.wantTotal) {
+				t.Errorf("subtotal, tax, total = %v, %v, %v, want %d, %d, %d",
+					order.Subtotal, order.Tax, order.Total, tt.wantSubtotal, tt.wantTax, tt.wantTotal)
+			}
+			if order.Discount.Currency != "USD" {
+				t.Errorf("discount currency = %q, want USD", order.Discount.Currency)
+			}
+		})
+	}
+}
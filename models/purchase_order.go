@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	PurchaseOrderDraft     = "draft"
+	PurchaseOrderOrdered   = "ordered"
+	PurchaseOrderReceived  = "received"
+	PurchaseOrderCancelled = "cancelled"
+)
+
+// PurchaseOrder is stock ordered from a supplier. Drafts may be edited;
+// once ordered, the purchase order can only be received or cancelled.
+type PurchaseOrder struct {
+	ID         string              `json:"purchase_order_id,omitempty"`
+	SupplierID string              `json:"supplier_id"`
+	Items      []PurchaseOrderItem `json:"items"`
+	Status     string              `json:"status,omitempty"`
+	Note       string              `json:"note,omitempty"`
+	CreatedAt  string              `json:"created_at,omitempty"`
+	OrderedAt  string              `json:"ordered_at,omitempty"`
+	ReceivedAt string              `json:"received_at,omitempty"`
+}
+
+type PurchaseOrderItem struct {
+	IngredientID string  `json:"ingredient_id"`
+	Quantity     float64 `json:"quantity"`
+	Unit         string  `json:"unit,omitempty"`
+	UnitCost     Money   `json:"unit_cost"`
+}
+
+// purchaseOrderTransitions lists the statuses a purchase order may move to.
+// A draft may be received directly when the goods arrive without a formal order.
+var purchaseOrderTransitions = map[string][]string{
+	PurchaseOrderDraft:   {PurchaseOrderOrdered, PurchaseOrderReceived, PurchaseOrderCancelled},
+	PurchaseOrderOrdered: {PurchaseOrderReceived, PurchaseOrderCancelled},
+}
+
+// CanTransition reports whether the purchase order may move to the given status
+func (p *PurchaseOrder) CanTransition(status string) bool {
+	for _, next := range purchaseOrderTransitions[p.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the purchase order to status and stamps the time
+func (p *PurchaseOrder) SetStatus(status string, at time.Time) {
+	p.Status = status
+	switch status {
+	case PurchaseOrderOrdered:
+		p.OrderedAt = at.Format(time.RFC3339)
+	case PurchaseOrderReceived:
+		p.ReceivedAt = at.Format(time.RFC3339)
+	}
+}
+
+// IsOpen reports whether the purchase order is still expected to arrive
+func (p *PurchaseOrder) IsOpen() bool {
+	return p.Status == PurchaseOrderDraft || p.Status == PurchaseOrderOrdered
+}
+
+// Ingredients returns the ordered quantities as ingredients
+func (p *PurchaseOrder) Ingredients() []MenuItemIngredient {
+	ingredients := make([]MenuItemIngredient, len(p.Items))
+	for i, item := range p.Items {
+		ingredients[i] = MenuItemIngredient{IngredientID: item.IngredientID, Quantity: item.Quantity, Unit: item.Unit}
+	}
+	return ingredients
+}
+
+func (p *PurchaseOrder) IsValid() error {
+	if err := p.validateFields(); err != nil {
+		return err
+	}
+	p.Note = strings.TrimSpace(p.Note)
+	return nil
+}
+
+func (p *PurchaseOrder) validateFields() error {
+	if p.ID != "" {
+		return errors.New("purchase_order_id must not be provided")
+	}
+	if p.SupplierID != "" && !validIngredientID.MatchString(p.SupplierID) {
+		return errors.New("supplier_id must be alphanumeric with underscores only")
+	}
+	if len(p.Items) == 0 {
+		return errors.New("items cannot be empty")
+	}
+	seen := make(map[string]bool, len(p.Items))
+	for i := range p.Items {
+		item := &p.Items[i]
+		if err := item.IsValid(); err != nil {
+			return err
+		}
+		if seen[item.IngredientID] {
+			return fmt.Errorf("ingredient %s is listed more than once", item.IngredientID)
+		}
+		seen[item.IngredientID] = true
+	}
+	if len(p.Note) > 500 {
+		return errors.New("note cannot exceed 500 characters")
+	}
+	return nil
+}
+
+func (pi *PurchaseOrderItem) IsValid() error {
+	if pi.IngredientID == "" || !validIngredientID.MatchString(pi.IngredientID) {
+		return errors.New("ingredient_id must be non-empty and alphanumeric with underscores only")
+	}
+	if pi.Quantity <= 0 {
+		return errors.New("quantity must be a positive number")
+	}
+	pi.Unit = strings.ToLower(strings.TrimSpace(pi.Unit))
+	if pi.Unit != "" && !isValidUnit(pi.Unit) {
+		return fmt.Errorf("unit must be one of %v", strings.Join(validUnits, ", "))
+	}
+	if pi.UnitCost.IsNegative() {
+		return errors.New("unit_cost must be non-negative")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurchaseOrderCanTransition(t *testing.T) {
+	statuses := []string{PurchaseOrderDraft, PurchaseOrderOrdered, PurchaseOrderReceived, PurchaseOrderCancelled}
+	allowed := map[[2]string]bool{
+		{PurchaseOrderDraft, PurchaseOrderOrdered}:     true,
+		{PurchaseOrderDraft, PurchaseOrderReceived}:    true,
+		{PurchaseOrderDraft, PurchaseOrderCancelled}:   true,
+		{PurchaseOrderOrdered, PurchaseOrderReceived}:  true,
+		{PurchaseOrderOrdered, PurchaseOrderCancelled}: true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			order := PurchaseOrder{Status: from}
+			if got, want := order.CanTransition(to), allowed[[2]string{from, to}]; got != want {
+				t.Errorf("CanTransition(%s -> %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestPurchaseOrderSetStatus(t *testing.T) {
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		status       string
+		wantOrdered  string
+		wantReceived string
+		wantOpen     bool
+	}{
+		{status: PurchaseOrderDraft, wantOpen: true},
+		{status: PurchaseOrderOrdered, wantOrdered: "2024-03-01T09:30:00Z", wantOpen: true},
+		{status: PurchaseOrderReceived, wantReceived: "2024-03-01T09:30:00Z"},
+		{status: PurchaseOrderCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			var order PurchaseOrder
+			order.SetStatus(tt.status, at)
+			if order.OrderedAt != tt.wantOrdered || order.ReceivedAt != tt.wantReceived {
+				t.Errorf("OrderedAt, ReceivedAt = %q, %q, want %q, %q", order.OrderedAt, order.ReceivedAt, tt.wantOrdered, tt.wantReceived)
+			}
+			if order.IsOpen() != tt.wantOpen {
+				t.Errorf("IsOpen() = %v, want %v", order.IsOpen(), tt.wantOpen)
+			}
+		})
+	}
+}
@@ -1,11 +1,124 @@
 package models
 
+import "time"
+
 type Sales struct {
-	TotalRevenue   float64 `json:"total_revenue"`
-	TotalItemsSold int     `json:"total_items_sold"`
-	TimeReceived   string  `json:"time_reseived"`
+	From           string   `json:"from,omitempty"`
+	To             string   `json:"to,omitempty"`
+	Statuses       []string `json:"statuses"`
+	OrderCount     int      `json:"order_count"`
+	TotalRevenue   Money    `json:"total_revenue"`
+	TotalItemsSold int      `json:"total_items_sold"`
+	TimeReceived   string   `json:"time_reseived"`
 }
 
+// Sales report groupings
+const (
+	GroupByHour     = "hour"
+	GroupByDay      = "day"
+	GroupByWeek     = "week"
+	GroupByProduct  = "product"
+	GroupByCustomer = "customer"
+)
+
+// IsValidSalesGrouping reports whether groupBy is a known grouping
+func IsValidSalesGrouping(groupBy string) bool {
+	switch groupBy {
+	case GroupByHour, GroupByDay, GroupByWeek, GroupByProduct, GroupByCustomer:
+		return true
+	}
+	return false
+}
+
+// SalesReport is the sales of the orders a report covers, broken down into
+// groups. Time groups are in chronological order, the others by revenue.
+type SalesReport struct {
+	From           string       `json:"from,omitempty"`
+	To             string       `json:"to,omitempty"`
+	Statuses       []string     `json:"statuses"`
+	GroupBy        string       `json:"group_by"`
+	OrderCount     int          `json:"order_count"`
+	TotalRevenue   Money        `json:"total_revenue"`
+	TotalItemsSold int          `json:"total_items_sold"`
+	Groups         []SalesGroup `json:"groups"`
+}
+
+// SalesGroup is one row of a sales report. Key is the start of the hour
+// (2006-01-02T15:00), the day (2006-01-02), the ISO week (2006-W01), the
+// product ID or the customer name.
+type SalesGroup struct {
+	Key        string `json:"key"`
+	Name       string `json:"name,omitempty"`
+	OrderCount int    `json:"order_count"`
+	Revenue    Money  `json:"revenue"`
+	ItemsSold  int    `json:"items_sold"`
+}
+
+// PopularItems ranks the products sold in the orders a report covers
 type PopularItems struct {
-	List []MenuItem `json:"popular_items_list"`
+	From          string        `json:"from,omitempty"`
+	To            string        `json:"to,omitempty"`
+	Statuses      []string      `json:"statuses"`
+	TotalQuantity int           `json:"total_quantity"`
+	TotalRevenue  Money         `json:"total_revenue"`
+	List          []PopularItem `json:"popular_items_list"`
+}
+
+// PopularItem is a product in the popular items report. Share is its
+// percentage of the revenue of the report.
+type PopularItem struct {
+	Rank         int     `json:"rank"`
+	ProductID    string  `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	QuantitySold int     `json:"quantity_sold"`
+	Revenue      Money   `json:"revenue"`
+	Share        float64 `json:"share"`
+}
+
+// ReportFilter selects the orders a report covers
+type ReportFilter struct {
+	From     time.Time // orders created at or after From; zero means no bound
+	To       time.Time // orders created before To; zero means no bound
+	Statuses []string  // empty means any status
+	Limit    int       // maximum number of rows; 0 means no limit
+}
+
+// Window returns the bounds of the filter formatted for a report
+func (f ReportFilter) Window() (from, to string) {
+	if !f.From.IsZero() {
+		from = f.From.Format(time.RFC3339)
+	}
+	if !f.To.IsZero() {
+		to = f.To.Format(time.RFC3339)
+	}
+	return from, to
+}
+
+// Includes reports whether the order falls within the filter. Orders without
+// a readable creation time are left out of any date window.
+func (f ReportFilter) Includes(o *Order) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, status := range f.Statuses {
+			found = found || o.Status == status
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.From.IsZero() && f.To.IsZero() {
+		return true
+	}
+	createdAt, err := time.Parse(time.RFC3339, o.CreatedAt)
+	if err != nil {
+		return false
+	}
+	if !f.From.IsZero() && createdAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !createdAt.Before(f.To) {
+		return false
+	}
+	return true
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportFilterIncludes(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ReportFilter
+		order  Order
+		want   bool
+	}{
+		{name: "no filter", order: Order{Status: StatusPending}, want: true},
+		{name: "status matches", filter: ReportFilter{Statuses: []string{StatusCompleted, StatusReady}}, order: Order{Status: StatusReady}, want: true},
+		{name: "status differs", filter: ReportFilter{Statuses: []string{StatusCompleted}}, order: Order{Status: StatusCancelled}},
+		{name: "start of window", filter: ReportFilter{From: from, To: to}, order: Order{CreatedAt: "2024-03-01T00:00:00Z"}, want: true},
+		{name: "end of window", filter: ReportFilter{From: from, To: to}, order: Order{CreatedAt: "2024-03-02T00:00:00Z"}},
+		{name: "before window", filter: ReportFilter{From: from}, order: Order{CreatedAt: "2024-02-29T23:59:59Z"}},
+		{name: "other time zone", filter: ReportFilter{To: to}, order: Order{CreatedAt: "2024-03-02T01:00:00+02:00"}, want: true},
+		{name: "unreadable time outside window", filter: ReportFilter{From: from}, order: Order{CreatedAt: "yesterday"}},
+		{name: "unreadable time without window", order: Order{CreatedAt: "yesterday"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Includes(&tt.order); got != tt.want {
+				t.Errorf("Includes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
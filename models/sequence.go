@@ -0,0 +1,8 @@
+package models
+
+// Sequence is a named counter. Its value only grows, so numbers handed out
+// from it are never handed out again, even once what they named is deleted.
+type Sequence struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
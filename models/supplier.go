@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+type Supplier struct {
+	ID      string `json:"supplier_id"`
+	Name    string `json:"name"`
+	Contact string `json:"contact,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+}
+
+func (s *Supplier) IsValid() error {
+	if err := s.validateFields(); err != nil {
+		return err
+	}
+	s.normalizeFields()
+	return nil
+}
+
+func (s *Supplier) validateFields() error {
+	if s.ID == "" || !validIngredientID.MatchString(s.ID) {
+		return errors.New("supplier_id must be non-empty and alphanumeric with underscores only")
+	}
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name cannot be empty")
+	}
+	if len(s.Name) > 100 {
+		return errors.New("name cannot exceed 100 characters")
+	}
+	if s.Email != "" && !strings.Contains(s.Email, "@") {
+		return errors.New("email is not a valid address")
+	}
+	return nil
+}
+
+func (s *Supplier) normalizeFields() {
+	s.Name = strings.TrimSpace(s.Name)
+	s.Contact = strings.TrimSpace(s.Contact)
+	s.Email = strings.ToLower(strings.TrimSpace(s.Email))
+	s.Phone = strings.TrimSpace(s.Phone)
+}
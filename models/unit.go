@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("units cannot be converted")
+)
+
+// Unit dimensions. Quantities convert freely within a dimension; shots
+// convert to volume only through the shot size of an inventory item.
+const (
+	dimensionMass   = "mass"
+	dimensionVolume = "volume"
+	dimensionShots  = "shots"
+)
+
+type unit struct {
+	dimension string
+	factor    float64 // size in the base unit of the dimension: g, ml or shots
+}
+
+// units is the conversion registry
+var units = map[string]unit{
+	"g":     {dimensionMass, 1},
+	"kg":    {dimensionMass, 1000},
+	"oz":    {dimensionMass, 28.349523125},
+	"lb":    {dimensionMass, 453.59237},
+	"ml":    {dimensionVolume, 1},
+	"l":     {dimensionVolume, 1000},
+	"fl_oz": {dimensionVolume, 29.5735295625},
+	"shots": {dimensionShots, 1},
+}
+
+// validUnits lists the registered units in a stable order for messages
+var validUnits = func() []string {
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+func isValidUnit(name string) bool {
+	_, ok := units[name]
+	return ok
+}
+
+// ConvertFrom converts quantity, given in unit, to the unit of the item. An
+// empty unit means the quantity is already in the unit of the item. Shots
+// and volumes convert into each other when the item has a shot size.
+func (i *InventoryItem) ConvertFrom(quantity float64, unitName string) (float64, error) {
+	if unitName == "" || unitName == i.Unit {
+		return quantity, nil
+	}
+
+	from, ok := units[unitName]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownUnit, unitName)
+	}
+	to, ok := units[i.Unit]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownUnit, i.Unit)
+	}
+
+	base := quantity * from.factor
+	switch {
+	case from.dimension == to.dimension:
+	case from.dimension == dimensionShots && to.dimension == dimensionVolume && i.ShotSize > 0:
+		base *= i.ShotSize
+	case from.dimension == dimensionVolume && to.dimension == dimensionShots && i.ShotSize > 0:
+		base /= i.ShotSize
+	default:
+		return 0, fmt.Errorf("%w: %s to %s for %s", ErrIncompatibleUnits, unitName, i.Unit, i.IngredientID)
+	}
+
+	return base / to.factor, nil
+}
+
+// RoundQuantity rounds a quantity to six decimal places, dropping the
+// floating point noise that unit conversions and long sums leave behind
+func RoundQuantity(q float64) float64 {
+	return math.Round(q*1e6) / 1e6
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConvertFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     InventoryItem
+		quantity float64
+		unit     string
+		want     float64
+		wantErr  error
+	}{
+		{name: "no unit", item: InventoryItem{Unit: "kg"}, quantity: 18, want: 18},
+		{name: "same unit", item: InventoryItem{Unit: "g"}, quantity: 18, unit: "g", want: 18},
+		{name: "grams to kilograms", item: InventoryItem{Unit: "kg"}, quantity: 18, unit: "g", want: 0.018},
+		{name: "kilograms to grams", item: InventoryItem{Unit: "g"}, quantity: 1.5, unit: "kg", want: 1500},
+		{name: "pounds to grams", item: InventoryItem{Unit: "g"}, quantity: 1, unit: "lb", want: 453.59237},
+		{name: "litres to millilitres", item: InventoryItem{Unit: "ml"}, quantity: 0.25, unit: "l", want: 250},
+		{name: "fluid ounces to litres", item: InventoryItem{Unit: "l"}, quantity: 2, unit: "fl_oz", want: 0.059147},
+		{name: "shots to millilitres", item: InventoryItem{Unit: "ml", ShotSize: 30}, quantity: 2, unit: "shots", want: 60},
+		{name: "litres to shots", item: InventoryItem{Unit: "shots", ShotSize: 25}, quantity: 0.1, unit: "l", want: 4},
+		{name: "shots without shot size", item: InventoryItem{Unit: "ml"}, quantity: 2, unit: "shots", wantErr: ErrIncompatibleUnits},
+		{name: "mass to volume", item: InventoryItem{Unit: "ml"}, quantity: 18, unit: "g", wantErr: ErrIncompatibleUnits},
+		{name: "shots to mass", item: InventoryItem{Unit: "g", ShotSize: 30}, quantity: 1, unit: "shots", wantErr: ErrIncompatibleUnits},
+		{name: "unknown unit", item: InventoryItem{Unit: "g"}, quantity: 1, unit: "cups", wantErr: ErrUnknownUnit},
+		{name: "unknown item unit", item: InventoryItem{Unit: "cups"}, quantity: 1, unit: "g", wantErr: ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.item.ConvertFrom(tt.quantity, tt.unit)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConvertFrom() error = %v, want %v", err, tt.wantErr)
+			}
+			if RoundQuantity(got) != tt.want {
+				t.Errorf("ConvertFrom(%v, %q) = %v, want %v", tt.quantity, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// User roles, from least to most privileged
+const (
+	RoleBarista = "barista"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
+
+// roleRank orders the roles; a role may do everything a lower role may
+var roleRank = map[string]int{
+	RoleBarista: 1,
+	RoleManager: 2,
+	RoleAdmin:   3,
+}
+
+var validUsername = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+// User is an API client. Only a hash of its API key is stored; the key
+// itself is shown once, when it is issued.
+type User struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	KeyHash   string `json:"key_hash,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// UserKey is a user together with a newly issued API key
+type UserKey struct {
+	User
+	APIKey string `json:"api_key"`
+}
+
+// IsValidRole reports whether role is a known role
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole reports whether the user has role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	return roleRank[u.Role] >= roleRank[role] && roleRank[u.Role] > 0
+}
+
+func (u *User) IsValid() error {
+	u.normalizeFields()
+	return u.validateFields()
+}
+
+func (u *User) validateFields() error {
+	if !validUsername.MatchString(u.Username) {
+		return errors.New("username must be 3 to 32 lowercase letters, digits or underscores")
+	}
+	if !IsValidRole(u.Role) {
+		return errors.New("role must be one of: barista, manager, admin")
+	}
+	if u.KeyHash != "" || u.CreatedAt != "" {
+		return errors.New("key_hash and created_at must not be provided")
+	}
+	return nil
+}
+
+func (u *User) normalizeFields() {
+	u.Username = strings.ToLower(strings.TrimSpace(u.Username))
+	u.Role = strings.ToLower(strings.TrimSpace(u.Role))
+}